@@ -0,0 +1,51 @@
+// Command calibrate estimates item parameters from the stored answers and
+// writes them onto the questions, like POST /api/v1/calibration/runs. It
+// suits large answer sets, which take too long for a request.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/joho/godotenv"
+
+	"uedu-api/internal/database"
+	"uedu-api/internal/handlers"
+)
+
+func main() {
+	model := flag.String("model", "2pl", "item response model: rasch or 2pl")
+	minResponses := flag.Int("min-responses", handlers.DefaultMinResponses, "responses an item needs to be calibrated")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	if err := database.Connect(); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer database.Close()
+
+	if err := database.RunMigrations(); err != nil {
+		log.Fatal("Failed to run migrations:", err)
+	}
+
+	run, err := handlers.RunCalibration(database.DB, *model, *minResponses, nil)
+	if err != nil {
+		log.Fatal("Failed to calibrate items:", err)
+	}
+
+	fmt.Printf("Calibration run %d (%s): %d items calibrated, %d flagged, %d skipped from %d responses by %d respondents\n",
+		run.ID, run.Model, run.ItemsCalibrated, run.ItemsFlagged, run.ItemsSkipped, run.Responses, run.Respondents)
+	if !run.Converged {
+		fmt.Printf("Warning: did not converge within %d iterations\n", run.Iterations)
+	}
+	for _, it := range run.Items {
+		if it.Flagged {
+			fmt.Printf("  question %d: %s\n", it.QuestionID, strings.Join(it.FlagReasons, "; "))
+		}
+	}
+}
@@ -3,13 +3,17 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
+	"uedu-api/internal/auth"
 	"uedu-api/internal/database"
 	"uedu-api/internal/handlers"
+	"uedu-api/internal/middleware"
 )
 
 func main() {
@@ -17,6 +21,10 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	if err := auth.Init(); err != nil {
+		log.Fatal("Failed to initialize auth:", err)
+	}
+
 	if err := database.Connect(); err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -26,8 +34,43 @@ func main() {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	if err := database.SeedAdmin(); err != nil {
+		log.Fatal("Failed to seed admin account:", err)
+	}
+
+	// Close exam attempts whose time ran out even if the student never
+	// comes back to submit.
+	go func() {
+		for range time.Tick(time.Minute) {
+			if _, err := handlers.ExpireAttempts(database.DB); err != nil {
+				log.Println("Failed to expire exam attempts:", err)
+			}
+		}
+	}()
+
+	// Keep exam analytics current as results are submitted and graded.
+	go func() {
+		for range time.Tick(15 * time.Minute) {
+			if _, err := handlers.RefreshStaleAnalytics(database.DB); err != nil {
+				log.Println("Failed to refresh exam analytics:", err)
+			}
+		}
+	}()
+
 	r := gin.Default()
 
+	// Forwarded client addresses are only believed from the proxies named in
+	// TRUSTED_PROXIES; without it the address of the connection is used.
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:3001", "http://localhost:3002"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
@@ -36,68 +79,197 @@ func main() {
 		AllowCredentials: true,
 	}))
 
-	api := r.Group("/api/v1")
+	v1 := r.Group("/api/v1")
+	authHandler := handlers.NewAuthHandler(database.DB)
+	v1.POST("/auth/login", authHandler.Login)
+	v1.POST("/auth/refresh", authHandler.Refresh)
+	v1.POST("/auth/logout", authHandler.Logout)
+	v1.POST("/auth/forgot-password", authHandler.ForgotPassword)
+	v1.POST("/auth/reset-password", authHandler.ResetPassword)
+	v1.POST("/auth/accept-invite", authHandler.AcceptInvite)
+
+	// Calendar clients cannot send bearer tokens; the feed link is the credential.
+	calendarHandler := handlers.NewCalendarHandler(database.DB)
+	v1.GET("/calendar/feed/:token", calendarHandler.GetFeed)
+
+	adminOnly := middleware.RequireRole(auth.RoleAdmin)
+	staffOnly := middleware.RequireRole(auth.RoleAdmin, auth.RoleTeacher)
+
+	api := v1.Group("", middleware.RequireAuth())
 	{
+		api.GET("/auth/me", authHandler.Me)
+		api.POST("/auth/change-password", authHandler.ChangePassword)
+
+		userHandler := handlers.NewUserHandler(database.DB)
+		api.GET("/users", adminOnly, userHandler.GetUsers)
+		api.GET("/users/:id", adminOnly, userHandler.GetUser)
+		api.POST("/users", adminOnly, userHandler.CreateUser)
+		api.PUT("/users/:id", adminOnly, userHandler.UpdateUser)
+		api.DELETE("/users/:id", adminOnly, userHandler.DeleteUser)
+		api.POST("/users/:id/unlock", adminOnly, userHandler.UnlockUser)
+		api.POST("/users/:id/invite", adminOnly, userHandler.ResendInvite)
+
 		studentHandler := handlers.NewStudentHandler(database.DB)
-		api.GET("/students", studentHandler.GetStudents)
-		api.GET("/students/:id", studentHandler.GetStudent)
-		api.POST("/students", studentHandler.CreateStudent)
-		api.PUT("/students/:id", studentHandler.UpdateStudent)
-		api.DELETE("/students/:id", studentHandler.DeleteStudent)
+		api.GET("/students", staffOnly, studentHandler.GetStudents)
+		api.GET("/students/:id", middleware.OwnStudentParam("id"), studentHandler.GetStudent)
+		api.GET("/students/:id/analytics", middleware.OwnStudentParam("id"), studentHandler.GetStudentAnalytics)
+		api.POST("/students", adminOnly, studentHandler.CreateStudent)
+		api.PUT("/students/:id", adminOnly, studentHandler.UpdateStudent)
+		api.DELETE("/students/:id", adminOnly, studentHandler.DeleteStudent)
 
 		teacherHandler := handlers.NewTeacherHandler(database.DB)
 		api.GET("/teachers", teacherHandler.GetTeachers)
 		api.GET("/teachers/:id", teacherHandler.GetTeacher)
-		api.POST("/teachers", teacherHandler.CreateTeacher)
-		api.PUT("/teachers/:id", teacherHandler.UpdateTeacher)
-		api.DELETE("/teachers/:id", teacherHandler.DeleteTeacher)
+		api.POST("/teachers", adminOnly, teacherHandler.CreateTeacher)
+		api.PUT("/teachers/:id", adminOnly, teacherHandler.UpdateTeacher)
+		api.DELETE("/teachers/:id", adminOnly, teacherHandler.DeleteTeacher)
 
 		courseHandler := handlers.NewCourseHandler(database.DB)
 		api.GET("/courses", courseHandler.GetCourses)
 		api.GET("/courses/:id", courseHandler.GetCourse)
-		api.POST("/courses", courseHandler.CreateCourse)
-		api.PUT("/courses/:id", courseHandler.UpdateCourse)
-		api.DELETE("/courses/:id", courseHandler.DeleteCourse)
+		api.POST("/courses", adminOnly, courseHandler.CreateCourse)
+		api.PUT("/courses/:id", adminOnly, courseHandler.UpdateCourse)
+		api.DELETE("/courses/:id", adminOnly, courseHandler.DeleteCourse)
+
+		enrollmentHandler := handlers.NewEnrollmentHandler(database.DB)
+		api.GET("/enrollments", middleware.OwnStudentQuery("student_id"), enrollmentHandler.GetEnrollments)
+		api.GET("/enrollments/:id", enrollmentHandler.GetEnrollment)
+		api.POST("/enrollments", enrollmentHandler.CreateEnrollment)
+		api.POST("/enrollments/:id/drop", enrollmentHandler.DropEnrollment)
+		api.PUT("/enrollments/:id/status", adminOnly, enrollmentHandler.UpdateEnrollmentStatus)
+		api.POST("/enrollments/:id/transfer", adminOnly, enrollmentHandler.TransferEnrollment)
+		api.GET("/courses/:id/waitlist", staffOnly, enrollmentHandler.GetCourseWaitlist)
 
 		examHandler := handlers.NewExamHandler(database.DB)
 		api.GET("/exams", examHandler.GetExams)
 		api.GET("/exams/:id", examHandler.GetExam)
-		api.GET("/exams/:id/with-questions", examHandler.GetExamWithQuestions)
-		api.POST("/exams", examHandler.CreateExam)
-		api.PUT("/exams/:id", examHandler.UpdateExam)
-		api.DELETE("/exams/:id", examHandler.DeleteExam)
+		api.GET("/exams/:id/with-questions", staffOnly, examHandler.GetExamWithQuestions)
+		api.POST("/exams", staffOnly, examHandler.CreateExam)
+		api.PUT("/exams/:id", staffOnly, examHandler.UpdateExam)
+		api.DELETE("/exams/:id", staffOnly, examHandler.DeleteExam)
+		api.POST("/exams/:id/publish", staffOnly, examHandler.PublishExam)
+		api.GET("/exams/:id/versions", staffOnly, examHandler.GetExamVersions)
+		api.GET("/exams/:id/versions/:version", staffOnly, examHandler.GetExamVersion)
 
 		questionHandler := handlers.NewQuestionHandler(database.DB)
-		api.GET("/exams/:exam_id/questions", questionHandler.GetQuestions)
-		api.GET("/questions/:id", questionHandler.GetQuestion)
-		api.POST("/questions", questionHandler.CreateQuestion)
-		api.PUT("/questions/:id", questionHandler.UpdateQuestion)
-		api.DELETE("/questions/:id", questionHandler.DeleteQuestion)
+		api.GET("/exams/:id/questions", staffOnly, questionHandler.GetQuestions)
+		api.GET("/questions/:id", staffOnly, questionHandler.GetQuestion)
+		api.POST("/questions", staffOnly, questionHandler.CreateQuestion)
+		api.PUT("/questions/:id", staffOnly, questionHandler.UpdateQuestion)
+		api.DELETE("/questions/:id", staffOnly, questionHandler.DeleteQuestion)
+		api.GET("/question-bank", staffOnly, questionHandler.GetQuestionBank)
+
+		blueprintHandler := handlers.NewBlueprintHandler(database.DB)
+		api.GET("/exams/:id/blueprint", staffOnly, blueprintHandler.GetBlueprint)
+		api.PUT("/exams/:id/blueprint", staffOnly, blueprintHandler.SaveBlueprint)
+
+		placementHandler := handlers.NewPlacementHandler(database.DB)
+		api.GET("/exams/:id/placement", staffOnly, placementHandler.GetPlacementConfig)
+		api.PUT("/exams/:id/placement", staffOnly, placementHandler.SavePlacementConfig)
+		api.GET("/exam-results/:id/placement", placementHandler.GetResultPlacement)
+
+		adaptiveHandler := handlers.NewAdaptiveHandler(database.DB)
+		api.GET("/exams/:id/adaptive", staffOnly, adaptiveHandler.GetAdaptiveSettings)
+		api.PUT("/exams/:id/adaptive", staffOnly, adaptiveHandler.SaveAdaptiveSettings)
+		api.DELETE("/exams/:id/adaptive", staffOnly, adaptiveHandler.DeleteAdaptiveSettings)
 
 		examResultHandler := handlers.NewExamResultHandler(database.DB)
 		api.POST("/exam-results/submit", examResultHandler.SubmitExam)
-		api.GET("/exam-results", examResultHandler.GetExamResults)
+		api.GET("/exam-results", middleware.OwnStudentQuery("student_id"), examResultHandler.GetExamResults)
 		api.GET("/exam-results/:id/details", examResultHandler.GetExamResultDetails)
+		api.POST("/exams/:id/attempts", examResultHandler.StartAttempt)
+		api.GET("/exams/:id/standing", middleware.OwnStudentQuery("student_id"), examResultHandler.GetExamStanding)
+		api.GET("/exam-attempts/:id", examResultHandler.GetAttempt)
+		api.PUT("/exam-attempts/:id/answers", examResultHandler.SaveAnswers)
+		api.POST("/exam-attempts/:id/submit", examResultHandler.SubmitAttempt)
+		api.GET("/exam-attempts/:id/questions", examResultHandler.GetAttemptQuestions)
+		api.GET("/exam-attempts/:id/adaptive", examResultHandler.GetAdaptiveAttempt)
+		api.POST("/exam-attempts/:id/adaptive", examResultHandler.AnswerAdaptiveItem)
+		api.POST("/exam-results/:id/release", staffOnly, examResultHandler.ReleaseResult)
+		api.POST("/exams/:id/release-results", staffOnly, examResultHandler.ReleaseExamResults)
+
+		analyticsHandler := handlers.NewAnalyticsHandler(database.DB)
+		api.GET("/analytics/exams", staffOnly, analyticsHandler.GetExamsAnalytics)
+		api.GET("/exams/:id/analytics", staffOnly, analyticsHandler.GetExamAnalytics)
+
+		calibrationHandler := handlers.NewCalibrationHandler(database.DB)
+		api.GET("/calibration/runs", staffOnly, calibrationHandler.GetCalibrationRuns)
+		api.POST("/calibration/runs", adminOnly, calibrationHandler.StartCalibration)
+		api.GET("/calibration/runs/:id", staffOnly, calibrationHandler.GetCalibrationRun)
+		api.GET("/calibration/items", staffOnly, calibrationHandler.GetCalibratedItems)
+		api.POST("/calibration/items/:id/review", adminOnly, calibrationHandler.ReviewCalibratedItem)
+
+		integrityHandler := handlers.NewIntegrityHandler(database.DB)
+		api.POST("/exam-attempts/:id/integrity-events", integrityHandler.RecordEvents)
+		api.GET("/exam-results/:id/integrity", staffOnly, integrityHandler.GetResultIntegrity)
+		api.GET("/proctoring/flagged", staffOnly, integrityHandler.GetFlagged)
+
+		accommodationHandler := handlers.NewAccommodationHandler(database.DB)
+		api.GET("/accommodations", middleware.OwnStudentQuery("student_id"), accommodationHandler.GetAccommodations)
+		api.POST("/accommodations", adminOnly, accommodationHandler.CreateAccommodation)
+		api.PUT("/accommodations/:id", adminOnly, accommodationHandler.UpdateAccommodation)
+		api.DELETE("/accommodations/:id", adminOnly, accommodationHandler.DeleteAccommodation)
+
+		gradingHandler := handlers.NewGradingHandler(database.DB)
+		api.GET("/grading/queue", staffOnly, gradingHandler.GetQueue)
+		api.POST("/grading/answers/:id", staffOnly, gradingHandler.GradeAnswer)
+		api.POST("/questions/:id/regrade", staffOnly, gradingHandler.RegradeQuestion)
+		api.POST("/exams/:id/regrade", staffOnly, gradingHandler.RegradeExam)
+		api.GET("/exams/:id/regrades", staffOnly, gradingHandler.GetExamRegrades)
 
 		aiHandler := handlers.NewAIHandler()
 		ai := api.Group("/ai")
 		{
-			ai.POST("/exam-generator", aiHandler.GenerateExam)
+			ai.POST("/exam-generator", staffOnly, aiHandler.GenerateExam)
 			ai.POST("/chatbot", aiHandler.ChatWithBot)
-			ai.DELETE("/chatbot/:student_id", aiHandler.ClearChatHistory)
-			ai.POST("/grading/writing", aiHandler.EvaluateWriting)
-			ai.POST("/grading/rubric", aiHandler.GenerateRubric)
-			ai.POST("/adaptive-difficulty", aiHandler.AdaptiveDifficulty)
+			ai.DELETE("/chatbot/:student_id", middleware.OwnStudentParam("student_id"), aiHandler.ClearChatHistory)
+			ai.POST("/grading/writing", staffOnly, aiHandler.EvaluateWriting)
+			ai.POST("/grading/rubric", staffOnly, aiHandler.GenerateRubric)
+			ai.POST("/adaptive-difficulty", staffOnly, aiHandler.AdaptiveDifficulty)
 		}
+		timetableHandler := handlers.NewTimetableHandler(database.DB)
+		api.POST("/timetable/preview", adminOnly, timetableHandler.PreviewTimetable)
+		api.POST("/timetable/commit", adminOnly, timetableHandler.CommitTimetable)
+
+		roomHandler := handlers.NewRoomHandler(database.DB)
+		api.GET("/rooms", roomHandler.GetRooms)
+		api.GET("/rooms/availability", staffOnly, roomHandler.GetAvailableRooms)
+		api.GET("/rooms/:id", roomHandler.GetRoom)
+		api.POST("/rooms", adminOnly, roomHandler.CreateRoom)
+		api.PUT("/rooms/:id", adminOnly, roomHandler.UpdateRoom)
+		api.DELETE("/rooms/:id", adminOnly, roomHandler.DeleteRoom)
+
 		classHandler := handlers.NewClassHandler(database.DB)
 		api.GET("/classes", classHandler.GetClasses)
 		api.GET("/classes/:id", classHandler.GetClass)
-		api.POST("/classes", classHandler.CreateClass)
-		api.PUT("/classes/:id", classHandler.UpdateClass)
-		api.DELETE("/classes/:id", classHandler.DeleteClass)
-		api.GET("/classes/teacher/:teacher_id", classHandler.GetClassesByTeacher)
-		api.GET("/classes/student/:student_id", classHandler.GetClassesByStudent)
-		api.GET("/events", classHandler.GetAllEvents)
+		api.POST("/classes/conflicts", staffOnly, classHandler.CheckConflicts)
+		api.POST("/classes", adminOnly, classHandler.CreateClass)
+		api.PUT("/classes/:id", adminOnly, classHandler.UpdateClass)
+		api.DELETE("/classes/:id", adminOnly, classHandler.DeleteClass)
+		api.POST("/classes/:id/cancel", adminOnly, classHandler.CancelClass)
+		api.POST("/classes/:id/restore", adminOnly, classHandler.RestoreClass)
+		api.GET("/classes/teacher/:teacher_id", middleware.OwnTeacherParam("teacher_id"), classHandler.GetClassesByTeacher)
+		api.GET("/classes/student/:student_id", middleware.OwnStudentParam("student_id"), classHandler.GetClassesByStudent)
+		api.GET("/events", middleware.ScopeEventsToCaller(), classHandler.GetAllEvents)
+		api.POST("/calendar/feed-token", calendarHandler.CreateFeedToken)
+		api.DELETE("/calendar/feed-token", calendarHandler.RevokeFeedToken)
+
+		classSeriesHandler := handlers.NewClassSeriesHandler(database.DB)
+		api.GET("/class-series", classSeriesHandler.GetSeriesList)
+		api.GET("/class-series/:id", classSeriesHandler.GetSeries)
+		api.POST("/class-series/preview", adminOnly, classSeriesHandler.PreviewSeries)
+		api.POST("/class-series", adminOnly, classSeriesHandler.CreateSeries)
+		api.PUT("/class-series/:id", adminOnly, classSeriesHandler.UpdateSeries)
+		api.PUT("/class-series/:id/following", adminOnly, classSeriesHandler.SplitSeries)
+		api.POST("/class-series/:id/exceptions", adminOnly, classSeriesHandler.AddException)
+		api.DELETE("/class-series/:id", adminOnly, classSeriesHandler.DeleteSeries)
+
+		attendanceHandler := handlers.NewAttendanceHandler(database.DB)
+		api.GET("/classes/:id/attendance", staffOnly, attendanceHandler.GetClassRoster)
+		api.PUT("/classes/:id/attendance", staffOnly, attendanceHandler.TakeRollCall)
+		api.GET("/attendance/students/:student_id", middleware.OwnStudentParam("student_id"), attendanceHandler.GetStudentAttendance)
+		api.GET("/attendance/courses/:course_id", staffOnly, attendanceHandler.GetCourseAttendance)
+		api.GET("/attendance/teachers/:teacher_id", middleware.OwnTeacherParam("teacher_id"), attendanceHandler.GetTeacherAttendance)
 	}
 
 	port := os.Getenv("PORT")
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const claimsKey = "auth_claims"
+
+func SetClaims(c *gin.Context, claims *Claims) {
+	c.Set(claimsKey, claims)
+}
+
+func ClaimsFromContext(c *gin.Context) *Claims {
+	v, ok := c.Get(claimsKey)
+	if !ok {
+		return nil
+	}
+	claims, _ := v.(*Claims)
+	return claims
+}
+
+// CanAccessStudent reports whether the caller may read or act on data that
+// belongs to the given student. Staff can see every student; a student only
+// themselves.
+func CanAccessStudent(c *gin.Context, studentID int) bool {
+	claims := ClaimsFromContext(c)
+	if claims == nil {
+		return false
+	}
+	switch claims.Role {
+	case RoleAdmin, RoleTeacher:
+		return true
+	case RoleStudent:
+		return claims.StudentID != 0 && claims.StudentID == studentID
+	}
+	return false
+}
+
+// CanAccessTeacher reports whether the caller may act on behalf of the given
+// teacher. Only admins and the teacher themselves qualify.
+func CanAccessTeacher(c *gin.Context, teacherID int) bool {
+	claims := ClaimsFromContext(c)
+	if claims == nil {
+		return false
+	}
+	switch claims.Role {
+	case RoleAdmin:
+		return true
+	case RoleTeacher:
+		return claims.TeacherID != 0 && claims.TeacherID == teacherID
+	}
+	return false
+}
+
+func paramID(value string) int {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+func CanAccessStudentParam(c *gin.Context, value string) bool {
+	id := paramID(value)
+	return id != 0 && CanAccessStudent(c, id)
+}
+
+func CanAccessTeacherParam(c *gin.Context, value string) bool {
+	id := paramID(value)
+	return id != 0 && CanAccessTeacher(c, id)
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	RoleAdmin   = "admin"
+	RoleTeacher = "teacher"
+	RoleStudent = "student"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+var secret []byte
+
+type Claims struct {
+	UserID    int    `json:"uid"`
+	Role      string `json:"role"`
+	StudentID int    `json:"student_id,omitempty"`
+	TeacherID int    `json:"teacher_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func Init() error {
+	key := os.Getenv("JWT_SECRET")
+	if key == "" {
+		return fmt.Errorf("JWT_SECRET environment variable is not set")
+	}
+	if len(key) < 32 {
+		return fmt.Errorf("JWT_SECRET must be at least 32 characters")
+	}
+	secret = []byte(key)
+	return nil
+}
+
+func IsValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleTeacher || role == RoleStudent
+}
+
+// GenerateAccessToken signs a short-lived HS256 token carrying the caller's
+// role and the student/teacher profile the account is linked to.
+func GenerateAccessToken(userID int, role string, studentID, teacherID int) (string, time.Time, error) {
+	expiresAt := time.Now().Add(AccessTokenTTL)
+	claims := Claims{
+		UserID:    userID,
+		Role:      role,
+		StudentID: studentID,
+		TeacherID: teacherID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			Issuer:    "uedu-api",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithIssuer("uedu-api"))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if !IsValidRole(claims.Role) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// NewOpaqueToken returns a random token for the client together with the
+// SHA-256 hash that is stored server-side. Used for refresh tokens.
+func NewOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	raw := hex.EncodeToString(buf)
+	return raw, HashToken(raw), nil
+}
+
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,199 @@
+package cat
+
+import (
+	"math"
+	"testing"
+)
+
+// pool is a fixed 2PL pool with difficulties from -2 to 2.
+var pool = []Item{
+	{ID: 1, Discrimination: 1.0, Difficulty: -2},
+	{ID: 2, Discrimination: 1.2, Difficulty: -1},
+	{ID: 3, Discrimination: 0.8, Difficulty: 0},
+	{ID: 4, Discrimination: 1.5, Difficulty: 0},
+	{ID: 5, Discrimination: 1.2, Difficulty: 1},
+	{ID: 6, Discrimination: 1.0, Difficulty: 2},
+}
+
+func item(id int) Item {
+	for _, it := range pool {
+		if it.ID == id {
+			return it
+		}
+	}
+	panic("no such item")
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []Response
+		theta     float64 // want within 0.01
+		se        float64
+	}{
+		{"prior", nil, 0, 1},
+		{"one right at 0", []Response{{item(4), true}}, 0.53, 0.85},
+		{"one wrong at 0", []Response{{item(4), false}}, -0.53, 0.85},
+		{"right and wrong at 0 cancel", []Response{{item(4), true}, {item(4), false}}, 0, 0.73},
+		{"all right stays finite", []Response{{item(1), true}, {item(2), true}, {item(3), true}, {item(4), true}, {item(5), true}, {item(6), true}}, 1.54, 0.72},
+		{"all wrong stays finite", []Response{{item(1), false}, {item(2), false}, {item(3), false}, {item(4), false}, {item(5), false}, {item(6), false}}, -1.54, 0.72},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			theta, se := Estimate(tt.responses)
+			if math.Abs(theta-tt.theta) > 0.01 || math.Abs(se-tt.se) > 0.01 {
+				t.Errorf("Estimate = (%.3f, %.3f), want (%.2f, %.2f)", theta, se, tt.theta, tt.se)
+			}
+		})
+	}
+}
+
+func TestEstimateOrdering(t *testing.T) {
+	// A right answer to a harder item says more than one to an easier item,
+	// and every answer makes the estimate more precise.
+	easy, _ := Estimate([]Response{{item(1), true}})
+	hard, _ := Estimate([]Response{{item(6), true}})
+	if hard <= easy {
+		t.Errorf("right on the hard item gives %.3f, not above %.3f for the easy one", hard, easy)
+	}
+	prev := 1.0
+	var responses []Response
+	for _, it := range pool {
+		responses = append(responses, Response{it, it.Difficulty <= 0})
+		_, se := Estimate(responses)
+		if se >= prev {
+			t.Fatalf("se rose to %.3f after item %d", se, it.ID)
+		}
+		prev = se
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		pool   []Item
+		theta  float64
+		wantID int
+		wantOK bool
+	}{
+		{"empty pool", nil, 0, 0, false},
+		{"steepest item at its difficulty", pool, 0, 4, true},
+		{"easy item for a weak student", pool, -2.5, 1, true},
+		{"hard item for a strong student", pool, 2.2, 6, true},
+		{"a flatter item wins at its own difficulty", pool, 1, 5, true},
+		{"equal information goes to the closer difficulty",
+			[]Item{{ID: 1, Discrimination: 1, Difficulty: -1}, {ID: 2, Discrimination: 1, Difficulty: 1.0}}, 0.5, 2, true},
+		{"full tie goes to the lowest id",
+			[]Item{{ID: 9, Discrimination: 1, Difficulty: 1}, {ID: 3, Discrimination: 1, Difficulty: 1}, {ID: 5, Discrimination: 1, Difficulty: 1}}, 0, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Next(tt.pool, tt.theta)
+			if ok != tt.wantOK || got.ID != tt.wantID {
+				t.Errorf("Next = (%d, %v), want (%d, %v)", got.ID, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestStop(t *testing.T) {
+	rules := Rules{MinItems: 3, MaxItems: 5, SETarget: 0.4}
+	tests := []struct {
+		name     string
+		answered int
+		se       float64
+		left     int
+		want     string
+	}{
+		{"keep going", 2, 0.5, 4, ""},
+		{"precise but too few items", 2, 0.3, 4, ""},
+		{"precise after the minimum", 3, 0.4, 4, StopPrecision},
+		{"not precise enough", 4, 0.41, 4, ""},
+		{"item cap", 5, 0.6, 4, StopMaxItems},
+		{"item cap before precision", 5, 0.3, 4, StopMaxItems},
+		{"pool empty", 2, 0.6, 0, StopExhausted},
+		{"precision before pool empty", 3, 0.3, 0, StopPrecision},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, stop := Stop(rules, tt.answered, tt.se, tt.left)
+			if reason != tt.want || stop != (tt.want != "") {
+				t.Errorf("Stop = (%q, %v), want %q", reason, stop, tt.want)
+			}
+		})
+	}
+	if _, stop := Stop(Rules{MinItems: 1, SETarget: 0.1}, 1000, 0.5, 10); stop {
+		t.Error("a zero MaxItems stopped the test")
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		theta float64
+		want  string
+	}{
+		{-4, "A1"}, {-2.01, "A1"}, {-2, "A2"}, {-0.5, "B1"}, {0, "B2"}, {1.99, "C1"}, {2, "C2"}, {5, "C2"},
+	}
+	for _, tt := range tests {
+		if got := Level(DefaultCuts, tt.theta); got != tt.want {
+			t.Errorf("Level(%v) = %s, want %s", tt.theta, got, tt.want)
+		}
+	}
+	if got := Level(nil, 1); got != "" {
+		t.Errorf("Level with no cuts = %q, want empty", got)
+	}
+}
+
+// TestSession walks a whole test over the fixed pool for a student who gets
+// right every item easier than 0.5, checking it is adaptive and repeatable.
+func TestSession(t *testing.T) {
+	run := func() ([]int, float64, string) {
+		rules := Rules{MinItems: 2, MaxItems: 5, SETarget: 0.5}
+		left := append([]Item(nil), pool...)
+		var given []int
+		var responses []Response
+		theta := 0.0
+		for {
+			next, ok := Next(left, theta)
+			if !ok {
+				t.Fatal("pool ran out")
+			}
+			given = append(given, next.ID)
+			for i := range left {
+				if left[i].ID == next.ID {
+					left = append(left[:i], left[i+1:]...)
+					break
+				}
+			}
+			responses = append(responses, Response{next, next.Difficulty < 0.5})
+			var se float64
+			theta, se = Estimate(responses)
+			if reason, stop := Stop(rules, len(responses), se, len(left)); stop {
+				return given, theta, reason
+			}
+		}
+	}
+
+	given, theta, reason := run()
+	if given[0] != 4 {
+		t.Errorf("first item %d, want 4, the most informative at 0", given[0])
+	}
+	if given[1] != 5 {
+		t.Errorf("second item %d, want 5, harder after a right answer", given[1])
+	}
+	if theta < 0 || theta > 1 {
+		t.Errorf("final theta %.3f, want between 0 and 1", theta)
+	}
+	if reason != StopMaxItems {
+		t.Errorf("stopped for %s, want %s", reason, StopMaxItems)
+	}
+	again, againTheta, _ := run()
+	if len(again) != len(given) || againTheta != theta {
+		t.Fatalf("second run gave %v at %.4f, first %v at %.4f", again, againTheta, given, theta)
+	}
+	for i := range given {
+		if again[i] != given[i] {
+			t.Fatalf("second run gave %v, first %v", again, given)
+		}
+	}
+}
@@ -179,6 +179,339 @@ func RunMigrations() error {
 			recommended_level VARCHAR(50),
 			last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`CREATE TABLE IF NOT EXISTS users (
+			id SERIAL PRIMARY KEY,
+			email VARCHAR(255) UNIQUE NOT NULL,
+			password_hash VARCHAR(255) NOT NULL,
+			role VARCHAR(20) NOT NULL CHECK (role IN ('admin', 'teacher', 'student')),
+			student_id INTEGER UNIQUE REFERENCES students(id) ON DELETE CASCADE,
+			teacher_id INTEGER UNIQUE REFERENCES teachers(id) ON DELETE CASCADE,
+			is_active BOOLEAN DEFAULT TRUE,
+			last_login_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE users ALTER COLUMN password_hash DROP NOT NULL`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_attempts INTEGER DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS account_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			purpose VARCHAR(20) NOT NULL CHECK (purpose IN ('password_reset', 'invite')),
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS waitlisted_at TIMESTAMP`,
+		`ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS transferred_to_course_id INTEGER REFERENCES courses(id)`,
+		`CREATE INDEX IF NOT EXISTS idx_enrollments_course_status ON enrollments(course_id, status)`,
+		`CREATE TABLE IF NOT EXISTS class_series (
+			id SERIAL PRIMARY KEY,
+			course_id INTEGER REFERENCES courses(id),
+			teacher_id INTEGER REFERENCES teachers(id),
+			title VARCHAR(255) NOT NULL,
+			description TEXT,
+			starts_at TIMESTAMP NOT NULL,
+			duration INTEGER DEFAULT 60,
+			room VARCHAR(50),
+			rrule VARCHAR(255) NOT NULL,
+			exception_dates JSONB DEFAULT '[]',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE classes ADD COLUMN IF NOT EXISTS series_id INTEGER REFERENCES class_series(id) ON DELETE CASCADE`,
+		`ALTER TABLE classes ADD COLUMN IF NOT EXISTS occurrence_date DATE`,
+		`ALTER TABLE classes ADD COLUMN IF NOT EXISTS is_override BOOLEAN DEFAULT FALSE`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_classes_series_occurrence ON classes(series_id, occurrence_date)`,
+		`ALTER TABLE exams ADD COLUMN IF NOT EXISTS room VARCHAR(50)`,
+		`CREATE INDEX IF NOT EXISTS idx_classes_teacher_date ON classes(teacher_id, class_date)`,
+		`CREATE INDEX IF NOT EXISTS idx_classes_room_date ON classes(room, class_date)`,
+		`ALTER TABLE classes ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS calendar_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS rooms (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(50) NOT NULL,
+			building VARCHAR(100),
+			branch VARCHAR(100),
+			capacity INTEGER DEFAULT 0,
+			equipment JSONB DEFAULT '[]',
+			is_active BOOLEAN DEFAULT TRUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_rooms_name ON rooms(LOWER(name))`,
+		`ALTER TABLE classes ADD COLUMN IF NOT EXISTS room_id INTEGER REFERENCES rooms(id) ON DELETE SET NULL`,
+		`ALTER TABLE class_series ADD COLUMN IF NOT EXISTS room_id INTEGER REFERENCES rooms(id) ON DELETE SET NULL`,
+		`ALTER TABLE exams ADD COLUMN IF NOT EXISTS room_id INTEGER REFERENCES rooms(id) ON DELETE SET NULL`,
+		// Link bookings made with a free-text room to the matching room,
+		// creating rooms for names not seen before.
+		`INSERT INTO rooms (name)
+			SELECT DISTINCT TRIM(room) FROM classes WHERE TRIM(COALESCE(room, '')) <> ''
+			UNION
+			SELECT DISTINCT TRIM(room) FROM exams WHERE TRIM(COALESCE(room, '')) <> ''
+			ON CONFLICT (LOWER(name)) DO NOTHING`,
+		`UPDATE classes SET room_id = r.id FROM rooms r
+			WHERE classes.room_id IS NULL AND LOWER(TRIM(classes.room)) = LOWER(r.name)`,
+		`UPDATE class_series SET room_id = r.id FROM rooms r
+			WHERE class_series.room_id IS NULL AND LOWER(TRIM(class_series.room)) = LOWER(r.name)`,
+		`UPDATE exams SET room_id = r.id FROM rooms r
+			WHERE exams.room_id IS NULL AND LOWER(TRIM(exams.room)) = LOWER(r.name)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS deadline_at TIMESTAMP`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS last_saved_at TIMESTAMP`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS auto_submitted BOOLEAN DEFAULT FALSE`,
+		// Older versions could leave a student several open attempts at one
+		// exam. All but the latest started are closed as abandoned so the
+		// one-open-attempt index can be built.
+		`UPDATE exam_results er
+			SET status = 'abandoned', auto_submitted = TRUE,
+			    completed_at = COALESCE(er.completed_at, er.last_saved_at, er.started_at)
+			WHERE er.status = 'in_progress' AND EXISTS (
+				SELECT 1 FROM exam_results newer
+				WHERE newer.exam_id = er.exam_id AND newer.student_id = er.student_id
+				  AND newer.status = 'in_progress'
+				  AND (newer.started_at, newer.id) > (er.started_at, er.id))`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_exam_results_open_attempt ON exam_results(exam_id, student_id) WHERE status = 'in_progress'`,
+		`CREATE INDEX IF NOT EXISTS idx_exam_results_deadline ON exam_results(deadline_at) WHERE status = 'in_progress'`,
+		`ALTER TABLE answers ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP`,
+		// Keep only the last answer saved for each question of a result.
+		`DELETE FROM answers a USING answers newer
+			WHERE newer.exam_result_id = a.exam_result_id AND newer.question_id = a.question_id
+			  AND newer.id > a.id`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_answers_result_question ON answers(exam_result_id, question_id)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS released_at TIMESTAMP`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS shuffle_seed BIGINT`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS question_order JSONB`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS option_order JSONB`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS skill VARCHAR(30)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS cefr_level VARCHAR(2)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS topic VARCHAR(100)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS difficulty INTEGER`,
+		`CREATE INDEX IF NOT EXISTS idx_questions_bank ON questions(cefr_level, skill) WHERE exam_id IS NULL`,
+		// An exam's questions are deleted with it. An earlier migration had
+		// them fall back into the bank instead; put the cascade back once.
+		`DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM pg_constraint
+			           WHERE conname = 'questions_exam_id_fkey' AND conrelid = 'questions'::regclass
+			             AND confdeltype <> 'c') THEN
+				ALTER TABLE questions DROP CONSTRAINT questions_exam_id_fkey;
+				ALTER TABLE questions ADD CONSTRAINT questions_exam_id_fkey
+					FOREIGN KEY (exam_id) REFERENCES exams(id) ON DELETE CASCADE;
+			END IF;
+		END $$`,
+		`CREATE TABLE IF NOT EXISTS exam_blueprint_sections (
+			id SERIAL PRIMARY KEY,
+			exam_id INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL DEFAULT 0,
+			question_type VARCHAR(50),
+			skill VARCHAR(30),
+			cefr_level VARCHAR(2),
+			topic VARCHAR(100),
+			difficulty INTEGER,
+			item_count INTEGER NOT NULL,
+			passage_count INTEGER DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE answers ALTER COLUMN points_earned TYPE DECIMAL(6,2)`,
+		`ALTER TABLE answers ADD COLUMN IF NOT EXISTS grading_status VARCHAR(20) DEFAULT 'auto'`,
+		`CREATE INDEX IF NOT EXISTS idx_answers_pending ON answers(exam_result_id) WHERE grading_status = 'pending'`,
+		`ALTER TABLE writing_evaluations ADD COLUMN IF NOT EXISTS criteria_scores JSONB`,
+		`ALTER TABLE writing_evaluations ADD COLUMN IF NOT EXISTS graded_by INTEGER REFERENCES users(id) ON DELETE SET NULL`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_writing_evaluations_answer ON writing_evaluations(answer_id)`,
+		`CREATE TABLE IF NOT EXISTS regrades (
+			id SERIAL PRIMARY KEY,
+			exam_id INTEGER REFERENCES exams(id) ON DELETE CASCADE,
+			question_id INTEGER REFERENCES questions(id) ON DELETE SET NULL,
+			reason TEXT,
+			regraded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS regrade_results (
+			id SERIAL PRIMARY KEY,
+			regrade_id INTEGER NOT NULL REFERENCES regrades(id) ON DELETE CASCADE,
+			exam_result_id INTEGER NOT NULL REFERENCES exam_results(id) ON DELETE CASCADE,
+			old_score DECIMAL(5,2),
+			new_score DECIMAL(5,2),
+			old_status VARCHAR(20),
+			new_status VARCHAR(20)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_regrade_results_result ON regrade_results(exam_result_id)`,
+		`CREATE TABLE IF NOT EXISTS exam_versions (
+			id SERIAL PRIMARY KEY,
+			exam_id INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+			version INTEGER NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'draft',
+			title VARCHAR(255),
+			duration INTEGER,
+			passing_score INTEGER,
+			total_points INTEGER,
+			is_random BOOLEAN,
+			blueprint JSONB,
+			published_at TIMESTAMP,
+			published_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(exam_id, version)
+		)`,
+		`CREATE TABLE IF NOT EXISTS exam_version_questions (
+			version_id INTEGER NOT NULL REFERENCES exam_versions(id) ON DELETE CASCADE,
+			question_id INTEGER NOT NULL,
+			drawn BOOLEAN NOT NULL DEFAULT FALSE,
+			exam_id INTEGER,
+			question_text TEXT NOT NULL,
+			question_type VARCHAR(50),
+			options JSONB,
+			correct_answer VARCHAR(500) NOT NULL,
+			points INTEGER,
+			order_num INTEGER,
+			passage TEXT,
+			audio_url VARCHAR(500),
+			explanation TEXT,
+			grading_rubric JSONB,
+			skill VARCHAR(30),
+			cefr_level VARCHAR(2),
+			topic VARCHAR(100),
+			difficulty INTEGER,
+			created_at TIMESTAMP,
+			updated_at TIMESTAMP,
+			PRIMARY KEY (version_id, question_id)
+		)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS exam_version_id INTEGER REFERENCES exam_versions(id)`,
+		`ALTER TABLE exams ADD COLUMN IF NOT EXISTS max_attempts INTEGER DEFAULT 0`,
+		`ALTER TABLE exams ADD COLUMN IF NOT EXISTS cooldown_minutes INTEGER DEFAULT 0`,
+		`ALTER TABLE exams ADD COLUMN IF NOT EXISTS attempt_scoring VARCHAR(10) DEFAULT 'best'`,
+		`CREATE INDEX IF NOT EXISTS idx_exam_results_exam_student ON exam_results(exam_id, student_id)`,
+		`CREATE TABLE IF NOT EXISTS exam_accommodations (
+			id SERIAL PRIMARY KEY,
+			student_id INTEGER NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+			enrollment_id INTEGER REFERENCES enrollments(id) ON DELETE CASCADE,
+			exam_id INTEGER REFERENCES exams(id) ON DELETE CASCADE,
+			time_multiplier NUMERIC(4,2) DEFAULT 1,
+			extra_minutes INTEGER DEFAULT 0,
+			opens_at TIMESTAMP,
+			closes_at TIMESTAMP,
+			reason TEXT,
+			created_by INTEGER REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_exam_accommodations_student ON exam_accommodations(student_id)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS accommodation_id INTEGER REFERENCES exam_accommodations(id) ON DELETE SET NULL`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS accommodated BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE exam_integrity_logs ADD COLUMN IF NOT EXISTS duration_ms INTEGER DEFAULT 0`,
+		`ALTER TABLE exam_integrity_logs ADD COLUMN IF NOT EXISTS occurred_at TIMESTAMP`,
+		`CREATE INDEX IF NOT EXISTS idx_exam_integrity_logs_result ON exam_integrity_logs(exam_result_id)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS client_ip VARCHAR(45)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS risk_score INTEGER DEFAULT 0`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS risk_flagged BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS integrity_summary JSONB`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_exam_analytics_exam ON exam_analytics(exam_id)`,
+		`ALTER TABLE exam_analytics ADD COLUMN IF NOT EXISTS pending_count INTEGER DEFAULT 0`,
+		`ALTER TABLE exam_analytics ADD COLUMN IF NOT EXISTS reliability DECIMAL(6,4)`,
+		`ALTER TABLE exam_analytics ADD COLUMN IF NOT EXISTS reliability_method VARCHAR(10)`,
+		`ALTER TABLE exam_analytics ADD COLUMN IF NOT EXISTS reliability_items INTEGER DEFAULT 0`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_student_analytics_student ON student_analytics(student_id)`,
+		`ALTER TABLE student_analytics ADD COLUMN IF NOT EXISTS level_breakdown JSONB`,
+		`CREATE TABLE IF NOT EXISTS placement_bands (
+			id SERIAL PRIMARY KEY,
+			exam_id INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+			min_score NUMERIC(5,2) NOT NULL,
+			cefr_level VARCHAR(2) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (exam_id, min_score)
+		)`,
+		`CREATE TABLE IF NOT EXISTS placement_skill_weights (
+			exam_id INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+			skill VARCHAR(30) NOT NULL,
+			weight NUMERIC(6,2) NOT NULL,
+			PRIMARY KEY (exam_id, skill)
+		)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS placement_score DECIMAL(5,2)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS placement_level VARCHAR(2)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_difficulty NUMERIC(7,4)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_discrimination NUMERIC(7,4)`,
+		`CREATE TABLE IF NOT EXISTS exam_adaptive_settings (
+			exam_id INTEGER PRIMARY KEY REFERENCES exams(id) ON DELETE CASCADE,
+			model VARCHAR(10) NOT NULL DEFAULT '2pl',
+			skill VARCHAR(30),
+			min_items INTEGER NOT NULL,
+			max_items INTEGER NOT NULL,
+			se_target NUMERIC(4,2) NOT NULL,
+			level_cuts JSONB,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE exam_versions ADD COLUMN IF NOT EXISTS adaptive JSONB`,
+		`ALTER TABLE exam_adaptive_settings ADD COLUMN IF NOT EXISTS pass_theta NUMERIC(7,4) NOT NULL DEFAULT 0`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS adaptive BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS theta NUMERIC(7,4)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS theta_se NUMERIC(7,4)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS ability_level VARCHAR(2)`,
+		`ALTER TABLE exam_results ADD COLUMN IF NOT EXISTS adaptive_stop VARCHAR(20)`,
+		`CREATE TABLE IF NOT EXISTS adaptive_items (
+			exam_result_id INTEGER NOT NULL REFERENCES exam_results(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			question_id INTEGER NOT NULL,
+			discrimination NUMERIC(7,4) NOT NULL,
+			difficulty NUMERIC(7,4) NOT NULL,
+			correct BOOLEAN,
+			theta NUMERIC(7,4),
+			theta_se NUMERIC(7,4),
+			administered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			answered_at TIMESTAMP,
+			PRIMARY KEY (exam_result_id, position)
+		)`,
+		`CREATE TABLE IF NOT EXISTS calibration_runs (
+			id SERIAL PRIMARY KEY,
+			model VARCHAR(10) NOT NULL,
+			min_responses INTEGER NOT NULL,
+			respondents INTEGER NOT NULL,
+			responses INTEGER NOT NULL,
+			items_calibrated INTEGER NOT NULL,
+			items_flagged INTEGER NOT NULL,
+			items_skipped INTEGER NOT NULL,
+			iterations INTEGER NOT NULL,
+			converged BOOLEAN NOT NULL,
+			log_likelihood NUMERIC(14,4),
+			items JSONB,
+			triggered_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_model VARCHAR(10)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_difficulty_se NUMERIC(10,4)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_discrimination_se NUMERIC(10,4)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_infit NUMERIC(10,4)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_outfit NUMERIC(10,4)`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_responses INTEGER`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_calibrated_at TIMESTAMP`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_run_id INTEGER REFERENCES calibration_runs(id) ON DELETE SET NULL`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_flagged BOOLEAN DEFAULT FALSE`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_flag_reasons JSONB`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL`,
+		`ALTER TABLE questions ADD COLUMN IF NOT EXISTS irt_reviewed_at TIMESTAMP`,
+		`CREATE TABLE IF NOT EXISTS removed_classes (
+			class_id INTEGER PRIMARY KEY,
+			series_id INTEGER,
+			course_id INTEGER,
+			teacher_id INTEGER,
+			title VARCHAR(255),
+			class_date TIMESTAMP,
+			duration INTEGER,
+			room VARCHAR(50),
+			removed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
 	}
 
 	for i, migration := range migrations {
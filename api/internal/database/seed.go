@@ -0,0 +1,38 @@
+package database
+
+import (
+	"fmt"
+	"os"
+
+	"uedu-api/internal/auth"
+)
+
+// SeedAdmin creates the initial admin account from ADMIN_EMAIL and
+// ADMIN_PASSWORD so a fresh install has someone who can log in. It does
+// nothing when the variables are unset or the account already exists.
+func SeedAdmin() error {
+	email := os.Getenv("ADMIN_EMAIL")
+	password := os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		return nil
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	result, err := DB.Exec(`
+		INSERT INTO users (email, password_hash, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (email) DO NOTHING
+	`, email, hash, auth.RoleAdmin)
+	if err != nil {
+		return fmt.Errorf("seeding admin account failed: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n > 0 {
+		fmt.Println("Created admin account", email)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package grading
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("multiple_choice", GraderFunc(gradeChoice))
+	Register("true_false", GraderFunc(gradeTrueFalse))
+	Register("reading_comprehension", GraderFunc(gradeChoice))
+	Register("multiple_select", GraderFunc(gradeMultiSelect))
+	Register("short_answer", GraderFunc(gradeShortAnswer))
+	Register("fill_blank", GraderFunc(gradeFillBlank))
+	Register("matching", GraderFunc(gradeMatching))
+	for _, t := range ManualTypes {
+		Register(t, GraderFunc(gradeManual))
+	}
+}
+
+func gradeManual(q Question, answer string) Outcome {
+	return Outcome{Pending: true}
+}
+
+func gradeChoice(q Question, answer string) Outcome {
+	if answer != "" && normalizeChoice(answer) == normalizeChoice(q.CorrectAnswer) {
+		return Outcome{Points: q.Points}
+	}
+	return Outcome{}
+}
+
+var truthValues = map[string]string{
+	"true": "true", "t": "true", "yes": "true",
+	"false": "false", "f": "false", "no": "false",
+}
+
+func gradeTrueFalse(q Question, answer string) Outcome {
+	want, ok := truthValues[Normalize(q.CorrectAnswer)]
+	if !ok {
+		return gradeChoice(q, answer)
+	}
+	if truthValues[Normalize(answer)] == want {
+		return Outcome{Points: q.Points}
+	}
+	return Outcome{}
+}
+
+// gradeMultiSelect gives credit for each correct option chosen and takes it
+// back for each wrong one, never going below zero.
+func gradeMultiSelect(q Question, answer string) Outcome {
+	var key, chosen []string
+	if json.Unmarshal([]byte(q.CorrectAnswer), &key) != nil {
+		key = []string{q.CorrectAnswer}
+	}
+	if json.Unmarshal([]byte(answer), &chosen) != nil {
+		chosen = []string{answer}
+	}
+
+	correct := map[string]bool{}
+	for _, k := range key {
+		correct[normalizeChoice(k)] = true
+	}
+	seen := map[string]bool{}
+	right, wrong := 0, 0
+	for _, c := range chosen {
+		c = normalizeChoice(c)
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		if correct[c] {
+			right++
+		} else {
+			wrong++
+		}
+	}
+	return Outcome{Points: fraction(q.Points, right-wrong, len(correct))}
+}
+
+func gradeShortAnswer(q Question, answer string) Outcome {
+	if matchesAny(answer, alternatives(q.CorrectAnswer)) {
+		return Outcome{Points: q.Points}
+	}
+	return Outcome{}
+}
+
+// gradeFillBlank scores each blank on its own. Answers to several blanks
+// come as a JSON array, or as one string separated by commas or semicolons.
+func gradeFillBlank(q Question, answer string) Outcome {
+	var blanks [][]string
+	var raw []json.RawMessage
+	if json.Unmarshal([]byte(q.CorrectAnswer), &raw) == nil {
+		for _, r := range raw {
+			var alts []string
+			if json.Unmarshal(r, &alts) != nil {
+				var single string
+				if json.Unmarshal(r, &single) != nil {
+					single = string(r)
+				}
+				alts = strings.Split(single, "|")
+			}
+			blanks = append(blanks, alts)
+		}
+	} else {
+		blanks = [][]string{strings.Split(q.CorrectAnswer, "|")}
+	}
+
+	var given []string
+	if json.Unmarshal([]byte(answer), &given) != nil {
+		if len(blanks) > 1 {
+			given = strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ';' })
+		} else {
+			given = []string{answer}
+		}
+	}
+
+	right := 0
+	for i, accepted := range blanks {
+		if i < len(given) && matchesAny(given[i], accepted) {
+			right++
+		}
+	}
+	return Outcome{Points: fraction(q.Points, right, len(blanks))}
+}
+
+// gradeMatching gives credit for each pair matched correctly.
+func gradeMatching(q Question, answer string) Outcome {
+	var items []string
+	json.Unmarshal([]byte(q.Options), &items)
+
+	key := matchingPairs(q.CorrectAnswer, items)
+	given := matchingPairs(answer, items)
+	right := 0
+	for item, match := range key {
+		if g, ok := given[item]; ok && Normalize(g) == Normalize(match) {
+			right++
+		}
+	}
+	return Outcome{Points: fraction(q.Points, right, len(key))}
+}
+
+// matchingPairs reads matches keyed by left-hand item. Keys may be the item
+// itself or its index in items; an array lists matches in item order.
+func matchingPairs(s string, items []string) map[string]string {
+	pairs := map[string]string{}
+	var byKey map[string]string
+	if json.Unmarshal([]byte(s), &byKey) == nil {
+		for k, v := range byKey {
+			if i, err := strconv.Atoi(k); err == nil && i >= 0 && i < len(items) {
+				k = items[i]
+			}
+			pairs[Normalize(k)] = v
+		}
+		return pairs
+	}
+	var list []string
+	if json.Unmarshal([]byte(s), &list) == nil {
+		for i, v := range list {
+			k := strconv.Itoa(i)
+			if i < len(items) {
+				k = items[i]
+			}
+			pairs[Normalize(k)] = v
+		}
+	}
+	return pairs
+}
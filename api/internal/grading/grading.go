@@ -0,0 +1,145 @@
+// Package grading scores answers to exam questions. Each question type has
+// its own Grader; types without one are scored by normalised exact match.
+// Writing and speaking answers are never scored here: they come back
+// Pending for a teacher to grade.
+//
+// Answer keys are read from the question's correct_answer:
+//
+//   - multiple_choice, true_false, reading_comprehension: the correct option.
+//   - multiple_select: a JSON array of the correct options.
+//   - short_answer: the answer, with accepted alternatives separated by "|"
+//     or given as a JSON array.
+//   - fill_blank: a JSON array with one entry per blank, each a string (with
+//     "|" alternatives) or an array of alternatives. A plain string is a
+//     single blank.
+//   - matching: a JSON object from each left-hand item (or its index in the
+//     options) to its match, or a JSON array of matches in option order.
+package grading
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Question is what a grader needs to know about a question.
+type Question struct {
+	Type          string
+	CorrectAnswer string
+	Options       string
+	Points        float64
+}
+
+// Outcome is the grade of one answer. Correct means full credit.
+type Outcome struct {
+	Points  float64
+	Correct bool
+	Pending bool
+}
+
+type Grader interface {
+	Grade(q Question, answer string) Outcome
+}
+
+// GraderFunc adapts a function to the Grader interface.
+type GraderFunc func(q Question, answer string) Outcome
+
+func (f GraderFunc) Grade(q Question, answer string) Outcome {
+	return f(q, answer)
+}
+
+var graders = map[string]Grader{}
+
+// Register sets the grader for a question type, replacing any earlier one.
+func Register(questionType string, g Grader) {
+	graders[questionType] = g
+}
+
+// Grade scores an answer with the grader registered for its question type.
+func Grade(q Question, answer string) Outcome {
+	g, ok := graders[q.Type]
+	if !ok {
+		g = GraderFunc(gradeChoice)
+	}
+	out := g.Grade(q, answer)
+	if out.Pending {
+		return Outcome{Pending: true}
+	}
+	out.Points = math.Round(out.Points*100) / 100
+	out.Correct = q.Points > 0 && out.Points >= q.Points
+	return out
+}
+
+// ManualTypes are the question types that always need a teacher.
+var ManualTypes = []string{"writing", "speaking"}
+
+// IsManual reports whether answers to the question type are graded by hand.
+func IsManual(questionType string) bool {
+	for _, t := range ManualTypes {
+		if t == questionType {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize lower-cases text, drops punctuation and collapses whitespace so
+// that "Has gone." and "has  gone" compare equal. Dashes count as spaces.
+func Normalize(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsSpace(r) || unicode.Is(unicode.Pd, r):
+			space = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+		default:
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// normalizeChoice compares options case- and spacing-insensitively but keeps
+// punctuation, which can be what tells two options apart.
+func normalizeChoice(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// alternatives reads a key entry that is either a JSON array of strings or
+// a string with "|" separated alternatives.
+func alternatives(key string) []string {
+	var list []string
+	if json.Unmarshal([]byte(key), &list) == nil {
+		return list
+	}
+	return strings.Split(key, "|")
+}
+
+// matchesAny reports whether the answer equals one of the accepted answers
+// after normalisation.
+func matchesAny(answer string, accepted []string) bool {
+	answer = Normalize(answer)
+	if answer == "" {
+		return false
+	}
+	for _, a := range accepted {
+		if Normalize(a) == answer {
+			return true
+		}
+	}
+	return false
+}
+
+// fraction awards points in proportion to right out of total.
+func fraction(points float64, right, total int) float64 {
+	if total <= 0 || right <= 0 {
+		return 0
+	}
+	return points * float64(right) / float64(total)
+}
@@ -0,0 +1,80 @@
+package grading
+
+import "testing"
+
+func TestGrade(t *testing.T) {
+	matchingOptions := `["dog", "cat", "cow"]`
+	matchingKey := `{"dog": "bark", "cat": "meow", "cow": "moo"}`
+
+	tests := []struct {
+		name   string
+		q      Question
+		answer string
+		want   Outcome
+	}{
+		// Choice types compare options ignoring case and spacing only.
+		{"choice right", Question{Type: "multiple_choice", CorrectAnswer: "Has gone", Points: 2}, "  has   GONE ", Outcome{Points: 2, Correct: true}},
+		{"choice keeps punctuation", Question{Type: "multiple_choice", CorrectAnswer: "it's", Points: 2}, "its", Outcome{}},
+		{"choice blank", Question{Type: "multiple_choice", CorrectAnswer: "A", Points: 2}, "", Outcome{}},
+		{"reading right", Question{Type: "reading_comprehension", CorrectAnswer: "B", Points: 1}, "b", Outcome{Points: 1, Correct: true}},
+		{"unknown type matches exactly", Question{Type: "essay_choice", CorrectAnswer: "A", Points: 1}, "a", Outcome{Points: 1, Correct: true}},
+
+		{"true/false synonym", Question{Type: "true_false", CorrectAnswer: "True", Points: 1}, "yes", Outcome{Points: 1, Correct: true}},
+		{"true/false wrong", Question{Type: "true_false", CorrectAnswer: "false", Points: 1}, "T", Outcome{}},
+		{"true/false unparseable key", Question{Type: "true_false", CorrectAnswer: "Not given", Points: 1}, "not given", Outcome{Points: 1, Correct: true}},
+
+		{"short answer normalised", Question{Type: "short_answer", CorrectAnswer: "has gone", Points: 2}, "Has gone.", Outcome{Points: 2, Correct: true}},
+		{"short answer pipe alternative", Question{Type: "short_answer", CorrectAnswer: "colour|color", Points: 2}, "Color", Outcome{Points: 2, Correct: true}},
+		{"short answer JSON alternative", Question{Type: "short_answer", CorrectAnswer: `["well-known", "famous"]`, Points: 2}, "well known", Outcome{Points: 2, Correct: true}},
+		{"short answer wrong", Question{Type: "short_answer", CorrectAnswer: "went", Points: 2}, "goed", Outcome{}},
+
+		{"multi-select all right", Question{Type: "multiple_select", CorrectAnswer: `["A", "C"]`, Points: 4}, `["c", "a"]`, Outcome{Points: 4, Correct: true}},
+		{"multi-select half", Question{Type: "multiple_select", CorrectAnswer: `["A", "C"]`, Points: 4}, `["A"]`, Outcome{Points: 2}},
+		{"multi-select wrong choice takes credit back", Question{Type: "multiple_select", CorrectAnswer: `["A", "B", "C", "D"]`, Points: 4}, `["A", "B", "E"]`, Outcome{Points: 1}},
+		{"multi-select never negative", Question{Type: "multiple_select", CorrectAnswer: `["A", "C"]`, Points: 4}, `["B", "D", "A"]`, Outcome{}},
+		{"multi-select repeats count once", Question{Type: "multiple_select", CorrectAnswer: `["A", "C"]`, Points: 4}, `["A", "a", " A "]`, Outcome{Points: 2}},
+
+		{"fill blank all right", Question{Type: "fill_blank", CorrectAnswer: `["went", "had"]`, Points: 2}, `["went", "had"]`, Outcome{Points: 2, Correct: true}},
+		{"fill blank partial", Question{Type: "fill_blank", CorrectAnswer: `["went", "had", "was"]`, Points: 3}, `["went", "has", "was"]`, Outcome{Points: 2}},
+		{"fill blank partial rounds", Question{Type: "fill_blank", CorrectAnswer: `["went", "had", "was"]`, Points: 4}, `["went", "", ""]`, Outcome{Points: 1.33}},
+		{"fill blank alternatives per blank", Question{Type: "fill_blank", CorrectAnswer: `["colour|color", ["isn't", "is not"]]`, Points: 2}, `["color", "is not"]`, Outcome{Points: 2, Correct: true}},
+		{"fill blank comma separated", Question{Type: "fill_blank", CorrectAnswer: `["went", "had"]`, Points: 2}, "went, has", Outcome{Points: 1}},
+		{"fill blank semicolon separated", Question{Type: "fill_blank", CorrectAnswer: `["went", "had"]`, Points: 2}, "Went; had.", Outcome{Points: 2, Correct: true}},
+		{"fill blank too few answers", Question{Type: "fill_blank", CorrectAnswer: `["went", "had"]`, Points: 2}, `["went"]`, Outcome{Points: 1}},
+		{"fill blank single plain key keeps commas", Question{Type: "fill_blank", CorrectAnswer: "however, it", Points: 1}, "However, it", Outcome{Points: 1, Correct: true}},
+
+		{"matching all by item", Question{Type: "matching", CorrectAnswer: matchingKey, Options: matchingOptions, Points: 3}, `{"dog": "bark", "cat": "meow", "cow": "moo"}`, Outcome{Points: 3, Correct: true}},
+		{"matching partial", Question{Type: "matching", CorrectAnswer: matchingKey, Options: matchingOptions, Points: 3}, `{"dog": "bark", "cat": "moo", "cow": "meow"}`, Outcome{Points: 1}},
+		{"matching by index", Question{Type: "matching", CorrectAnswer: matchingKey, Options: matchingOptions, Points: 3}, `{"0": "Bark", "2": "moo"}`, Outcome{Points: 2}},
+		{"matching as array", Question{Type: "matching", CorrectAnswer: `["bark", "meow", "moo"]`, Options: matchingOptions, Points: 3}, `["bark", "meow", "bark"]`, Outcome{Points: 2}},
+		{"matching array against object key", Question{Type: "matching", CorrectAnswer: matchingKey, Options: matchingOptions, Points: 3}, `["bark", "meow", "moo"]`, Outcome{Points: 3, Correct: true}},
+		{"matching unreadable answer", Question{Type: "matching", CorrectAnswer: matchingKey, Options: matchingOptions, Points: 3}, "dog-bark", Outcome{}},
+
+		{"writing is pending", Question{Type: "writing", Points: 10}, "An essay.", Outcome{Pending: true}},
+		{"speaking is pending", Question{Type: "speaking", Points: 10}, "", Outcome{Pending: true}},
+		{"zero points is never correct", Question{Type: "multiple_choice", CorrectAnswer: "A", Points: 0}, "A", Outcome{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Grade(tt.q, tt.answer); got != tt.want {
+				t.Errorf("Grade(%q) = %+v, want %+v", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Has gone.", "has gone"},
+		{"  has \t gone  ", "has gone"},
+		{"well-known", "well known"},
+		{"isn't", "isnt"},
+		{"£5 — cash!", "5 cash"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTimeMultiplier bounds an accommodation's multiplier; anything larger is
+// almost certainly a typo for extra minutes.
+const maxTimeMultiplier = 5
+
+var errEnrollmentNotStudents = errors.New("enrollment_id must be one of the student's enrollments")
+
+type AccommodationHandler struct {
+	DB *sql.DB
+}
+
+func NewAccommodationHandler(db *sql.DB) *AccommodationHandler {
+	return &AccommodationHandler{DB: db}
+}
+
+const accommodationColumns = `id, student_id, enrollment_id, exam_id, COALESCE(time_multiplier, 1),
+	COALESCE(extra_minutes, 0), opens_at, closes_at, COALESCE(reason, ''), created_by, created_at, updated_at`
+
+func scanAccommodation(row interface{ Scan(...interface{}) error }, a *models.ExamAccommodation) error {
+	return row.Scan(&a.ID, &a.StudentID, &a.EnrollmentID, &a.ExamID, &a.TimeMultiplier, &a.ExtraMinutes,
+		&a.OpensAt, &a.ClosesAt, &a.Reason, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt)
+}
+
+func validateAccommodation(a *models.ExamAccommodation) error {
+	if a.TimeMultiplier == 0 {
+		a.TimeMultiplier = 1
+	}
+	a.Reason = strings.TrimSpace(a.Reason)
+	switch {
+	case a.TimeMultiplier < 1 || a.TimeMultiplier > maxTimeMultiplier:
+		return fmt.Errorf("time_multiplier must be between 1 and %d", maxTimeMultiplier)
+	case a.ExtraMinutes < 0:
+		return errors.New("extra_minutes cannot be negative")
+	case a.OpensAt != nil && a.ClosesAt != nil && !a.ClosesAt.After(*a.OpensAt):
+		return errors.New("closes_at must be after opens_at")
+	}
+	return nil
+}
+
+// checkAccommodationScope checks that the enrollment and exam an
+// accommodation is narrowed to exist and fit its student.
+func checkAccommodationScope(db queryer, a *models.ExamAccommodation) error {
+	if a.EnrollmentID != nil {
+		var studentID int
+		err := db.QueryRow(`SELECT student_id FROM enrollments WHERE id = $1`, *a.EnrollmentID).Scan(&studentID)
+		if err == sql.ErrNoRows || (err == nil && studentID != a.StudentID) {
+			return errEnrollmentNotStudents
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if a.ExamID != nil {
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM exams WHERE id = $1)`, *a.ExamID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return errExamNotFound
+		}
+	}
+	return nil
+}
+
+// bindAccommodation reads and checks an accommodation from the request body.
+// It writes the response and returns false when the request should stop.
+func (h *AccommodationHandler) bindAccommodation(c *gin.Context, a *models.ExamAccommodation) bool {
+	if err := c.ShouldBindJSON(a); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := validateAccommodation(a); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	err := checkAccommodationScope(h.DB, a)
+	if err == errEnrollmentNotStudents || err == errExamNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// GetAccommodations lists accommodations, optionally for one student or one
+// exam. Filtering by exam_id lists those for the exam itself only.
+func (h *AccommodationHandler) GetAccommodations(c *gin.Context) {
+	query := `SELECT ` + accommodationColumns + ` FROM exam_accommodations`
+	var conditions []string
+	args := []interface{}{}
+	if studentID := c.Query("student_id"); studentID != "" {
+		args = append(args, studentID)
+		conditions = append(conditions, fmt.Sprintf("student_id = $%d", len(args)))
+	}
+	if examID := c.Query("exam_id"); examID != "" {
+		args = append(args, examID)
+		conditions = append(conditions, fmt.Sprintf("exam_id = $%d", len(args)))
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY student_id, id"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	accommodations := []models.ExamAccommodation{}
+	for rows.Next() {
+		var a models.ExamAccommodation
+		if err := scanAccommodation(rows, &a); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		accommodations = append(accommodations, a)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, accommodations)
+}
+
+func (h *AccommodationHandler) CreateAccommodation(c *gin.Context) {
+	var a models.ExamAccommodation
+	if !h.bindAccommodation(c, &a) {
+		return
+	}
+	var createdBy interface{}
+	if claims := auth.ClaimsFromContext(c); claims != nil && claims.UserID != 0 {
+		createdBy = claims.UserID
+	}
+
+	err := scanAccommodation(h.DB.QueryRow(`
+		INSERT INTO exam_accommodations (student_id, enrollment_id, exam_id, time_multiplier, extra_minutes,
+		                                 opens_at, closes_at, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+accommodationColumns,
+		a.StudentID, a.EnrollmentID, a.ExamID, a.TimeMultiplier, a.ExtraMinutes, a.OpensAt, a.ClosesAt,
+		a.Reason, createdBy), &a)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, a)
+}
+
+// UpdateAccommodation changes an accommodation's terms. Attempts already
+// started keep the deadline they were given.
+func (h *AccommodationHandler) UpdateAccommodation(c *gin.Context) {
+	id := c.Param("id")
+	var a models.ExamAccommodation
+	if !h.bindAccommodation(c, &a) {
+		return
+	}
+
+	err := scanAccommodation(h.DB.QueryRow(`
+		UPDATE exam_accommodations
+		SET student_id=$1, enrollment_id=$2, exam_id=$3, time_multiplier=$4, extra_minutes=$5,
+		    opens_at=$6, closes_at=$7, reason=$8, updated_at=CURRENT_TIMESTAMP
+		WHERE id=$9
+		RETURNING `+accommodationColumns,
+		a.StudentID, a.EnrollmentID, a.ExamID, a.TimeMultiplier, a.ExtraMinutes, a.OpensAt, a.ClosesAt,
+		a.Reason, id), &a)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Accommodation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+// DeleteAccommodation removes an accommodation. Results taken under it stay
+// marked as accommodated.
+func (h *AccommodationHandler) DeleteAccommodation(c *gin.Context) {
+	result, err := h.DB.Exec("DELETE FROM exam_accommodations WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Accommodation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Accommodation deleted successfully"})
+}
@@ -0,0 +1,711 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/cat"
+	"uedu-api/internal/grading"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errAdaptivePoolEmpty = errors.New("the question bank has no calibrated items for this adaptive exam")
+	errAdaptiveAnswers   = errors.New("adaptive attempts are answered one item at a time")
+	errNotAdaptive       = errors.New("this attempt is not adaptive")
+	errNotCurrentItem    = errors.New("that is not the item being asked")
+	errAdaptiveNotOver   = errors.New("the adaptive test is not over; answer the current item")
+)
+
+// Settings left at zero take these values.
+const (
+	defaultAdaptiveMinItems = 5
+	defaultAdaptiveMaxItems = 30
+	defaultAdaptiveSETarget = 0.3
+)
+
+type AdaptiveHandler struct {
+	DB *sql.DB
+}
+
+func NewAdaptiveHandler(db *sql.DB) *AdaptiveHandler {
+	return &AdaptiveHandler{DB: db}
+}
+
+type AdaptiveAnswerRequest struct {
+	QuestionID int    `json:"question_id" binding:"required"`
+	Answer     string `json:"answer"`
+}
+
+// getAdaptiveSettings returns an exam's adaptive settings, or nil when the
+// exam is not adaptive.
+func getAdaptiveSettings(db queryer, examID int) (*models.AdaptiveSettings, error) {
+	s := models.AdaptiveSettings{ExamID: examID}
+	var cuts []byte
+	err := db.QueryRow(`
+		SELECT model, COALESCE(skill, ''), min_items, max_items, se_target, pass_theta, level_cuts, updated_at
+		FROM exam_adaptive_settings WHERE exam_id = $1
+	`, examID).Scan(&s.Model, &s.Skill, &s.MinItems, &s.MaxItems, &s.SETarget, &s.PassTheta, &cuts, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.LevelCuts = []models.LevelCut{}
+	if len(cuts) > 0 {
+		if err := json.Unmarshal(cuts, &s.LevelCuts); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+func validateAdaptive(s *models.AdaptiveSettings) error {
+	s.Model = strings.ToLower(strings.TrimSpace(s.Model))
+	s.Skill = strings.ToLower(strings.TrimSpace(s.Skill))
+	if s.Model == "" {
+		s.Model = cat.Model2PL
+	}
+	if s.MinItems == 0 {
+		s.MinItems = defaultAdaptiveMinItems
+	}
+	if s.MaxItems == 0 {
+		s.MaxItems = defaultAdaptiveMaxItems
+	}
+	if s.SETarget == 0 {
+		s.SETarget = defaultAdaptiveSETarget
+	}
+	switch {
+	case s.Model != cat.ModelRasch && s.Model != cat.Model2PL:
+		return fmt.Errorf("model must be %s or %s", cat.ModelRasch, cat.Model2PL)
+	case s.Skill != "" && !isSkill(s.Skill):
+		return fmt.Errorf("skill must be one of %s", strings.Join(skillNames, ", "))
+	case s.MinItems < 1:
+		return errors.New("min_items must be at least 1")
+	case s.MaxItems < s.MinItems:
+		return errors.New("max_items cannot be less than min_items")
+	case s.SETarget < 0 || s.SETarget > 1:
+		return errors.New("se_target must be between 0 and 1")
+	case s.PassTheta < -5 || s.PassTheta > 5:
+		return errors.New("pass_theta must be between -5 and 5")
+	}
+	for i := range s.LevelCuts {
+		cut := &s.LevelCuts[i]
+		cut.Level = strings.ToUpper(strings.TrimSpace(cut.Level))
+		if cefrRank(cut.Level) < 0 {
+			return fmt.Errorf("level_cuts: level must be one of %s", strings.Join(cefrLevels, ", "))
+		}
+		if i > 0 {
+			prev := s.LevelCuts[i-1]
+			if cefrRank(cut.Level) <= cefrRank(prev.Level) || cut.MinTheta <= prev.MinTheta {
+				return errors.New("level_cuts must rise in both level and min_theta")
+			}
+		}
+	}
+	return nil
+}
+
+func adaptiveCuts(s *models.AdaptiveSettings) []cat.Cut {
+	if len(s.LevelCuts) == 0 {
+		return cat.DefaultCuts
+	}
+	cuts := make([]cat.Cut, len(s.LevelCuts))
+	for i, c := range s.LevelCuts {
+		cuts[i] = cat.Cut{Level: c.Level, MinTheta: c.MinTheta}
+	}
+	return cuts
+}
+
+// poolItem is a bank item an adaptive attempt may be given next.
+type poolItem struct {
+	attemptItem
+	params cat.Item
+}
+
+// adaptivePool lists the calibrated, automatically graded bank items not yet
+// given in the attempt, in id order. Items flagged as misfitting are left
+// out until reviewed. Under Rasch every item discriminates equally, whatever
+// its calibrated discrimination.
+func adaptivePool(db queryerRows, resultID int, s *models.AdaptiveSettings) ([]poolItem, error) {
+	query := `
+		SELECT id, COALESCE(question_type, ''), COALESCE(passage, ''), COALESCE(options::text, ''), points,
+		       COALESCE(irt_discrimination, 1), irt_difficulty
+		FROM questions
+		WHERE exam_id IS NULL AND irt_difficulty IS NOT NULL AND COALESCE(irt_discrimination, 1) > 0
+		  AND NOT COALESCE(irt_flagged, FALSE)
+		  AND id NOT IN (SELECT question_id FROM adaptive_items WHERE exam_result_id = $1)`
+	args := []interface{}{resultID}
+	for _, t := range grading.ManualTypes {
+		args = append(args, t)
+		query += fmt.Sprintf(" AND COALESCE(question_type, '') <> $%d", len(args))
+	}
+	if s.Skill != "" {
+		args = append(args, s.Skill)
+		query += fmt.Sprintf(" AND LOWER(skill) = $%d", len(args))
+	}
+	query += " ORDER BY id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pool []poolItem
+	for rows.Next() {
+		var it poolItem
+		if err := rows.Scan(&it.ID, &it.QuestionType, &it.Passage, &it.Options, &it.Points,
+			&it.params.Discrimination, &it.params.Difficulty); err != nil {
+			return nil, err
+		}
+		it.params.ID = it.ID
+		if s.Model == cat.ModelRasch {
+			it.params.Discrimination = 1
+		}
+		pool = append(pool, it)
+	}
+	return pool, rows.Err()
+}
+
+// administerNext gives the attempt the pool item most informative at theta.
+// The item joins the attempt's version and question order like a drawn
+// blueprint question, and its points are added to the attempt's total. It
+// reports false when the pool is empty.
+func administerNext(tx *sql.Tx, resultID, versionID int, pool []poolItem, theta float64) (bool, error) {
+	params := make([]cat.Item, len(pool))
+	byID := map[int]poolItem{}
+	for i, it := range pool {
+		params[i] = it.params
+		byID[it.ID] = it
+	}
+	next, ok := cat.Next(params, theta)
+	if !ok {
+		return false, nil
+	}
+	picked := byID[next.ID]
+
+	stored, err := snapshotDrawn(tx, versionID, []attemptItem{picked.attemptItem})
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO adaptive_items (exam_result_id, position, question_id, discrimination, difficulty)
+		SELECT $1, COUNT(*) + 1, $2, $3, $4 FROM adaptive_items WHERE exam_result_id = $1
+	`, resultID, next.ID, next.Discrimination, next.Difficulty); err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`
+		UPDATE exam_results
+		SET question_order = COALESCE(question_order, '[]'::jsonb) || to_jsonb($1::int), total_points = COALESCE(total_points, 0) + $2
+		WHERE id = $3
+	`, next.ID, stored[0].Points, resultID)
+	return true, err
+}
+
+// startAdaptive sets up a new adaptive attempt and gives it its first item,
+// chosen at the prior ability estimate of 0.
+func startAdaptive(tx *sql.Tx, attemptID int, v *models.ExamVersion) error {
+	if _, err := tx.Exec(`
+		UPDATE exam_results SET adaptive = TRUE, question_order = '[]', total_points = 0, theta = 0, theta_se = 1
+		WHERE id = $1
+	`, attemptID); err != nil {
+		return err
+	}
+	pool, err := adaptivePool(tx, attemptID, v.Adaptive)
+	if err != nil {
+		return err
+	}
+	ok, err := administerNext(tx, attemptID, v.ID, pool, 0)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errAdaptivePoolEmpty
+	}
+	return nil
+}
+
+func loadAdaptiveItems(db queryerRows, resultID int) ([]models.AdaptiveItem, error) {
+	rows, err := db.Query(`
+		SELECT position, question_id, discrimination, difficulty, correct, theta, theta_se, administered_at, answered_at
+		FROM adaptive_items WHERE exam_result_id = $1 ORDER BY position
+	`, resultID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.AdaptiveItem{}
+	for rows.Next() {
+		var it models.AdaptiveItem
+		if err := rows.Scan(&it.Position, &it.QuestionID, &it.Discrimination, &it.Difficulty, &it.Correct,
+			&it.Theta, &it.ThetaSE, &it.AdministeredAt, &it.AnsweredAt); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// attemptAdaptiveSettings returns the adaptive settings of the version the
+// attempt was delivered from.
+func attemptAdaptiveSettings(db queryer, a *ExamAttempt) (*models.AdaptiveSettings, error) {
+	if !a.Adaptive || a.ExamVersionID == nil {
+		return nil, errNotAdaptive
+	}
+	var encoded []byte
+	if err := db.QueryRow(`SELECT adaptive FROM exam_versions WHERE id = $1`, *a.ExamVersionID).Scan(&encoded); err != nil {
+		return nil, err
+	}
+	if len(encoded) == 0 {
+		return nil, errNotAdaptive
+	}
+	var s models.AdaptiveSettings
+	if err := json.Unmarshal(encoded, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// reestimateAdaptive brings an adaptive result's answered items in line
+// with their regraded answers and estimates the student's ability again
+// from the first item on, in the order the items were given. Results that
+// are not adaptive are left alone.
+func reestimateAdaptive(tx *sql.Tx, resultID int) error {
+	a := ExamAttempt{}
+	a.ID = resultID
+	if err := tx.QueryRow(`
+		SELECT COALESCE(adaptive, FALSE), exam_version_id FROM exam_results WHERE id = $1
+	`, resultID).Scan(&a.Adaptive, &a.ExamVersionID); err != nil {
+		return err
+	}
+	if !a.Adaptive {
+		return nil
+	}
+	s, err := attemptAdaptiveSettings(tx, &a)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE adaptive_items ai SET correct = COALESCE(ans.is_correct, FALSE)
+		FROM answers ans
+		WHERE ans.exam_result_id = ai.exam_result_id AND ans.question_id = ai.question_id
+		  AND ai.exam_result_id = $1 AND ai.correct IS NOT NULL
+	`, resultID); err != nil {
+		return err
+	}
+	items, err := loadAdaptiveItems(tx, resultID)
+	if err != nil {
+		return err
+	}
+
+	var responses []cat.Response
+	theta, se := cat.Estimate(nil)
+	for _, it := range items {
+		if it.Correct == nil {
+			continue
+		}
+		responses = append(responses, cat.Response{
+			Item:    cat.Item{ID: it.QuestionID, Discrimination: it.Discrimination, Difficulty: it.Difficulty},
+			Correct: *it.Correct,
+		})
+		theta, se = cat.Estimate(responses)
+		theta, se = math.Round(theta*10000)/10000, math.Round(se*10000)/10000
+		if _, err := tx.Exec(`
+			UPDATE adaptive_items SET theta = $1, theta_se = $2 WHERE exam_result_id = $3 AND position = $4
+		`, theta, se, resultID, it.Position); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		UPDATE exam_results SET theta = $1, theta_se = $2, ability_level = $3 WHERE id = $4
+	`, theta, se, cat.Level(adaptiveCuts(s), theta), resultID)
+	return err
+}
+
+// adaptiveStopReason applies the stopping rule to an open adaptive attempt
+// as it stands: the items answered, the standard error after the last one
+// and the pool items left.
+func adaptiveStopReason(db readQueryer, a *ExamAttempt) (string, bool, error) {
+	s, err := attemptAdaptiveSettings(db, a)
+	if err != nil {
+		return "", false, err
+	}
+	var se float64
+	var answered int
+	err = db.QueryRow(`
+		SELECT COALESCE(er.theta_se, 1),
+		       (SELECT COUNT(*) FROM adaptive_items WHERE exam_result_id = er.id AND correct IS NOT NULL)
+		FROM exam_results er WHERE er.id = $1
+	`, a.ID).Scan(&se, &answered)
+	if err != nil {
+		return "", false, err
+	}
+	pool, err := adaptivePool(db, a.ID, s)
+	if err != nil {
+		return "", false, err
+	}
+	rules := cat.Rules{MinItems: s.MinItems, MaxItems: s.MaxItems, SETarget: s.SETarget}
+	reason, stop := cat.Stop(rules, answered, se, len(pool))
+	return reason, stop, nil
+}
+
+// adaptiveState reports where an adaptive attempt stands, with the item
+// waiting for an answer while it is open.
+func adaptiveState(c *gin.Context, db readQueryer, a *ExamAttempt, s *models.AdaptiveSettings) (*models.AdaptiveState, error) {
+	st := models.AdaptiveState{ExamResultID: a.ID, Status: a.Status, MaxItems: s.MaxItems}
+	var theta float64
+	err := db.QueryRow(`
+		SELECT COALESCE(theta, 0), COALESCE(theta_se, 1), COALESCE(ability_level, ''), COALESCE(adaptive_stop, '')
+		FROM exam_results WHERE id = $1
+	`, a.ID).Scan(&theta, &st.ThetaSE, &st.AbilityLevel, &st.StopReason)
+	if err != nil {
+		return nil, err
+	}
+	items, err := loadAdaptiveItems(db, a.ID)
+	if err != nil {
+		return nil, err
+	}
+	current := 0
+	for _, it := range items {
+		if it.Correct != nil {
+			st.ItemsAnswered++
+		} else {
+			current = it.QuestionID
+		}
+	}
+
+	staff := canSeeAnswerKey(c)
+	if staff || a.Status != attemptInProgress {
+		st.Theta = &theta
+	} else {
+		st.AbilityLevel = ""
+	}
+	if staff {
+		st.Items = items
+	}
+	if a.Status == attemptInProgress && current != 0 {
+		questions, err := deliverQuestions(db, a, false)
+		if err != nil {
+			return nil, err
+		}
+		for i := range questions {
+			if questions[i].ID == current {
+				st.Question = &questions[i]
+			}
+		}
+	}
+	return &st, nil
+}
+
+func (h *AdaptiveHandler) respondAdaptiveSettings(c *gin.Context, s *models.AdaptiveSettings) {
+	pool, err := adaptivePool(h.DB, 0, s)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"settings":   s,
+		"pool_items": len(pool),
+		"ready":      len(pool) > 0,
+	})
+}
+
+// GetAdaptiveSettings returns an exam's adaptive settings with how many
+// calibrated bank items they can draw on.
+func (h *AdaptiveHandler) GetAdaptiveSettings(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+	s, err := getAdaptiveSettings(h.DB, examID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if s == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "This exam is not adaptive"})
+		return
+	}
+	h.respondAdaptiveSettings(c, s)
+}
+
+// SaveAdaptiveSettings makes an exam adaptive, or changes how. Like any
+// edit it takes effect when the exam is next published.
+func (h *AdaptiveHandler) SaveAdaptiveSettings(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+	var s models.AdaptiveSettings
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAdaptive(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cuts, err := json.Marshal(s.LevelCuts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM exams WHERE id = $1)`, examID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO exam_adaptive_settings (exam_id, model, skill, min_items, max_items, se_target, pass_theta, level_cuts, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, CURRENT_TIMESTAMP)
+		ON CONFLICT (exam_id) DO UPDATE SET
+			model = EXCLUDED.model, skill = EXCLUDED.skill, min_items = EXCLUDED.min_items,
+			max_items = EXCLUDED.max_items, se_target = EXCLUDED.se_target, pass_theta = EXCLUDED.pass_theta,
+			level_cuts = EXCLUDED.level_cuts, updated_at = EXCLUDED.updated_at
+	`, examID, s.Model, s.Skill, s.MinItems, s.MaxItems, s.SETarget, s.PassTheta, string(cuts)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := markExamDraft(tx, examID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	saved, err := getAdaptiveSettings(tx, examID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondAdaptiveSettings(c, saved)
+}
+
+// DeleteAdaptiveSettings turns an adaptive exam back into a fixed one from
+// its next published version.
+func (h *AdaptiveHandler) DeleteAdaptiveSettings(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM exam_adaptive_settings WHERE exam_id = $1`, examID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "This exam is not adaptive"})
+		return
+	}
+	if err := markExamDraft(tx, examID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Adaptive settings removed"})
+}
+
+// GetAdaptiveAttempt returns where an adaptive attempt stands and the item
+// to answer next. An attempt found past its deadline is submitted first.
+func (h *ExamResultHandler) GetAdaptiveAttempt(c *gin.Context) {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	a, err := getAttempt(tx, c.Param("id"), true)
+	if err != nil {
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.CanAccessStudent(c, a.StudentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own records"})
+		return
+	}
+	s, err := attemptAdaptiveSettings(tx, a)
+	if err != nil {
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if a.Status == attemptInProgress && a.overdue {
+		if err := finishAttempt(tx, a, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	st, err := adaptiveState(c, tx, a, s)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, st)
+}
+
+// AnswerAdaptiveItem records the answer to the item being asked, grades it
+// and re-estimates the student's ability. The attempt is then given the most
+// informative item left, or submitted once the stopping rule is met.
+func (h *ExamResultHandler) AnswerAdaptiveItem(c *gin.Context) {
+	var req AdaptiveAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	a := h.lockAttempt(c, tx, c.Param("id"))
+	if a == nil {
+		return
+	}
+	s, err := attemptAdaptiveSettings(tx, a)
+	if err != nil {
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	items, err := loadAdaptiveItems(tx, a.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var responses []cat.Response
+	var current *models.AdaptiveItem
+	for i, it := range items {
+		params := cat.Item{ID: it.QuestionID, Discrimination: it.Discrimination, Difficulty: it.Difficulty}
+		if it.Correct != nil {
+			responses = append(responses, cat.Response{Item: params, Correct: *it.Correct})
+		} else {
+			current = &items[i]
+		}
+	}
+	if current == nil || current.QuestionID != req.QuestionID {
+		c.JSON(http.StatusConflict, gin.H{"error": errNotCurrentItem.Error()})
+		return
+	}
+
+	if err := saveAnswers(tx, a, map[int]string{req.QuestionID: req.Answer}); err != nil {
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := gradeAnswers(tx, a.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var correct bool
+	if err := tx.QueryRow(`
+		SELECT COALESCE(is_correct, FALSE) FROM answers WHERE exam_result_id = $1 AND question_id = $2
+	`, a.ID, req.QuestionID).Scan(&correct); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	responses = append(responses, cat.Response{
+		Item:    cat.Item{ID: current.QuestionID, Discrimination: current.Discrimination, Difficulty: current.Difficulty},
+		Correct: correct,
+	})
+	theta, se := cat.Estimate(responses)
+	theta, se = math.Round(theta*10000)/10000, math.Round(se*10000)/10000
+	if _, err := tx.Exec(`
+		UPDATE adaptive_items SET correct = $1, theta = $2, theta_se = $3, answered_at = CURRENT_TIMESTAMP
+		WHERE exam_result_id = $4 AND position = $5
+	`, correct, theta, se, a.ID, current.Position); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tx.Exec(`
+		UPDATE exam_results SET theta = $1, theta_se = $2, ability_level = $3 WHERE id = $4
+	`, theta, se, cat.Level(adaptiveCuts(s), theta), a.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	pool, err := adaptivePool(tx, a.ID, s)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	rules := cat.Rules{MinItems: s.MinItems, MaxItems: s.MaxItems, SETarget: s.SETarget}
+	if reason, stop := cat.Stop(rules, len(responses), se, len(pool)); stop {
+		if _, err := tx.Exec(`UPDATE exam_results SET adaptive_stop = $1 WHERE id = $2`, reason, a.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := finishAttempt(tx, a, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else if _, err := administerNext(tx, a.ID, *a.ExamVersionID, pool, theta); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The layout grew with the new item.
+	if a.Status == attemptInProgress {
+		if a, err = getAttempt(tx, a.ID, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	st, err := adaptiveState(c, tx, a, s)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, st)
+}
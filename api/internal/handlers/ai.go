@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errAIDisabled = errors.New("AI features are disabled on this server")
+
+// AIHandler keeps the /ai routes answering while the OpenAI integration
+// (internal/ai_disabled) is switched off, so clients get a clear 503
+// rather than a 404.
+type AIHandler struct{}
+
+func NewAIHandler() *AIHandler {
+	return &AIHandler{}
+}
+
+func (h *AIHandler) disabled(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": errAIDisabled.Error()})
+}
+
+func (h *AIHandler) GenerateExam(c *gin.Context)       { h.disabled(c) }
+func (h *AIHandler) ChatWithBot(c *gin.Context)        { h.disabled(c) }
+func (h *AIHandler) ClearChatHistory(c *gin.Context)   { h.disabled(c) }
+func (h *AIHandler) EvaluateWriting(c *gin.Context)    { h.disabled(c) }
+func (h *AIHandler) GenerateRubric(c *gin.Context)     { h.disabled(c) }
+func (h *AIHandler) AdaptiveDifficulty(c *gin.Context) { h.disabled(c) }
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"uedu-api/internal/itemstats"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnalyticsHandler struct {
+	DB *sql.DB
+}
+
+func NewAnalyticsHandler(db *sql.DB) *AnalyticsHandler {
+	return &AnalyticsHandler{DB: db}
+}
+
+const examAnalyticsColumns = `ea.id, ea.exam_id, e.title, COALESCE(ea.total_attempts, 0), COALESCE(ea.pass_count, 0),
+	COALESCE(ea.fail_count, 0), COALESCE(ea.pending_count, 0), COALESCE(ea.average_score, 0),
+	COALESCE(ea.average_time_taken, 0), ea.reliability, COALESCE(ea.reliability_method, ''),
+	COALESCE(ea.reliability_items, 0), ea.question_stats, ea.last_updated`
+
+func scanExamAnalytics(row interface{ Scan(...interface{}) error }, a *models.ExamAnalytics) error {
+	var reliability sql.NullFloat64
+	var questionStats []byte
+	if err := row.Scan(&a.ID, &a.ExamID, &a.ExamTitle, &a.TotalAttempts, &a.PassCount, &a.FailCount,
+		&a.PendingCount, &a.AverageScore, &a.AverageTime, &reliability, &a.ReliabilityMethod,
+		&a.ReliabilityItems, &questionStats, &a.LastUpdated); err != nil {
+		return err
+	}
+	if reliability.Valid {
+		a.Reliability = &reliability.Float64
+	}
+	a.QuestionStats = []models.QuestionStat{}
+	if len(questionStats) > 0 {
+		return json.Unmarshal(questionStats, &a.QuestionStats)
+	}
+	return nil
+}
+
+// analyseExam runs item analysis over the exam's graded attempts, each
+// against the questions it was delivered. Adaptive attempts are left out:
+// their items are chosen by ability, so neither the share answered right
+// nor the total score compares across students.
+func analyseExam(db queryerRows, examID int) (itemstats.Report, error) {
+	rows, err := db.Query(`
+		SELECT er.id, q.id, COALESCE(q.question_type, ''), COALESCE(q.options::text, ''), COALESCE(q.correct_answer, ''),
+		       COALESCE(q.points, 0), COALESCE(q.order_num, 0),
+		       a.id IS NOT NULL, COALESCE(a.selected_answer, ''), COALESCE(a.points_earned, 0)
+		FROM exam_results er
+		JOIN `+attemptQuestions+` ON TRUE
+		LEFT JOIN answers a ON a.exam_result_id = er.id AND a.question_id = q.id
+		WHERE er.exam_id = $1 AND er.status IN ($2, $3) AND NOT COALESCE(er.adaptive, FALSE)
+		ORDER BY er.id, q.order_num, q.id
+	`, examID, attemptPassed, attemptFailed)
+	if err != nil {
+		return itemstats.Report{}, err
+	}
+	defer rows.Close()
+
+	type orderedItem struct {
+		itemstats.Item
+		order int
+	}
+	items := map[int]orderedItem{}
+	var attempts []itemstats.Attempt
+	lastResult := 0
+	for rows.Next() {
+		var resultID, order int
+		var it itemstats.Item
+		var r itemstats.Response
+		if err := rows.Scan(&resultID, &it.ID, &it.Type, &it.Options, &it.CorrectAnswer, &it.Points, &order,
+			&r.Answered, &r.Answer, &r.Earned); err != nil {
+			return itemstats.Report{}, err
+		}
+		if _, ok := items[it.ID]; !ok {
+			items[it.ID] = orderedItem{it, order}
+		}
+		if resultID != lastResult || len(attempts) == 0 {
+			attempts = append(attempts, itemstats.Attempt{})
+			lastResult = resultID
+		}
+		r.Item = it.ID
+		last := &attempts[len(attempts)-1]
+		last.Responses = append(last.Responses, r)
+	}
+	if err := rows.Err(); err != nil {
+		return itemstats.Report{}, err
+	}
+
+	ordered := make([]orderedItem, 0, len(items))
+	for _, it := range items {
+		ordered = append(ordered, it)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].order != ordered[j].order {
+			return ordered[i].order < ordered[j].order
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+	list := make([]itemstats.Item, len(ordered))
+	for i, it := range ordered {
+		list[i] = it.Item
+	}
+	return itemstats.Analyze(list, attempts), nil
+}
+
+// RefreshExamAnalytics recomputes an exam's analytics from its submitted
+// attempts and stores them. Attempts still awaiting manual grading count
+// toward the totals but not the averages or item statistics.
+func RefreshExamAnalytics(db *sql.DB, examID int) (*models.ExamAnalytics, error) {
+	a := models.ExamAnalytics{ExamID: examID}
+	var averageScore, averageTime float64
+	err := db.QueryRow(`
+		SELECT e.title, COUNT(er.id),
+		       COUNT(er.id) FILTER (WHERE er.status = $2),
+		       COUNT(er.id) FILTER (WHERE er.status = $3),
+		       COUNT(er.id) FILTER (WHERE er.status = $4),
+		       COALESCE(AVG(er.score) FILTER (WHERE er.status IN ($2, $3)), 0),
+		       COALESCE(AVG(er.time_taken) FILTER (WHERE er.status IN ($2, $3)), 0)
+		FROM exams e
+		LEFT JOIN exam_results er ON er.exam_id = e.id AND er.status <> $5
+		WHERE e.id = $1
+		GROUP BY e.id
+	`, examID, attemptPassed, attemptFailed, attemptPending, attemptInProgress).Scan(&a.ExamTitle, &a.TotalAttempts,
+		&a.PassCount, &a.FailCount, &a.PendingCount, &averageScore, &averageTime)
+	if err == sql.ErrNoRows {
+		return nil, errExamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.AverageScore = math.Round(averageScore*100) / 100
+	a.AverageTime = int(math.Round(averageTime))
+
+	report, err := analyseExam(db, examID)
+	if err != nil {
+		return nil, err
+	}
+	a.QuestionStats = report.Questions
+	if a.QuestionStats == nil {
+		a.QuestionStats = []models.QuestionStat{}
+	}
+	a.Reliability = report.Reliability
+	a.ReliabilityMethod = report.ReliabilityMethod
+	a.ReliabilityItems = report.ReliabilityItems
+	stats, err := json.Marshal(a.QuestionStats)
+	if err != nil {
+		return nil, err
+	}
+
+	var method interface{}
+	if a.ReliabilityMethod != "" {
+		method = a.ReliabilityMethod
+	}
+	err = db.QueryRow(`
+		INSERT INTO exam_analytics (exam_id, total_attempts, pass_count, fail_count, pending_count, average_score,
+		                            average_time_taken, reliability, reliability_method, reliability_items, question_stats,
+		                            last_updated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, CURRENT_TIMESTAMP)
+		ON CONFLICT (exam_id) DO UPDATE SET
+			total_attempts = EXCLUDED.total_attempts, pass_count = EXCLUDED.pass_count,
+			fail_count = EXCLUDED.fail_count, pending_count = EXCLUDED.pending_count,
+			average_score = EXCLUDED.average_score, average_time_taken = EXCLUDED.average_time_taken,
+			reliability = EXCLUDED.reliability, reliability_method = EXCLUDED.reliability_method,
+			reliability_items = EXCLUDED.reliability_items, question_stats = EXCLUDED.question_stats,
+			last_updated = EXCLUDED.last_updated
+		RETURNING id, last_updated
+	`, examID, a.TotalAttempts, a.PassCount, a.FailCount, a.PendingCount, a.AverageScore, a.AverageTime,
+		a.Reliability, method, a.ReliabilityItems, string(stats)).Scan(&a.ID, &a.LastUpdated)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// RefreshStaleAnalytics recomputes the analytics of every exam with results
+// submitted, graded or regraded since its analytics were last computed. The
+// server runs it periodically. Exams that fail are skipped, named in the
+// returned error and picked up again on the next run.
+func RefreshStaleAnalytics(db *sql.DB) (int, error) {
+	rows, err := db.Query(`
+		SELECT er.exam_id FROM exam_results er
+		LEFT JOIN exam_analytics ea ON ea.exam_id = er.exam_id
+		WHERE er.status <> $1
+		GROUP BY er.exam_id, ea.last_updated
+		HAVING ea.last_updated IS NULL OR MAX(er.updated_at) > ea.last_updated
+	`, attemptInProgress)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	refreshed := 0
+	var errs []error
+	for _, id := range ids {
+		if _, err := RefreshExamAnalytics(db, id); err != nil {
+			errs = append(errs, fmt.Errorf("exam %d: %w", id, err))
+			continue
+		}
+		refreshed++
+	}
+	return refreshed, errors.Join(errs...)
+}
+
+// GetExamsAnalytics lists the stored analytics of every exam without the
+// per-question statistics.
+func (h *AnalyticsHandler) GetExamsAnalytics(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT ` + examAnalyticsColumns + ` FROM exam_analytics ea
+		JOIN exams e ON ea.exam_id = e.id
+		ORDER BY e.title, ea.exam_id
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	list := []models.ExamAnalytics{}
+	for rows.Next() {
+		var a models.ExamAnalytics
+		if err := scanExamAnalytics(rows, &a); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		a.QuestionStats = nil
+		list = append(list, a)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// GetExamAnalytics returns an exam's analytics with the statistics of each
+// question. They are computed on the spot when missing or when refresh=true.
+func (h *AnalyticsHandler) GetExamAnalytics(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+
+	var a models.ExamAnalytics
+	err = sql.ErrNoRows
+	if c.Query("refresh") != "true" {
+		err = scanExamAnalytics(h.DB.QueryRow(`
+			SELECT `+examAnalyticsColumns+` FROM exam_analytics ea
+			JOIN exams e ON ea.exam_id = e.id
+			WHERE ea.exam_id = $1
+		`, examID), &a)
+	}
+	if err == sql.ErrNoRows {
+		fresh, err := RefreshExamAnalytics(h.DB, examID)
+		if err == errExamNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, fresh)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
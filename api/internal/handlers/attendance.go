@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	attendancePresent = "present"
+	attendanceAbsent  = "absent"
+	attendanceLate    = "late"
+)
+
+// Students whose attendance rate falls below the threshold after at least
+// chronicAbsenceMinSessions marked classes are flagged as chronically absent.
+const (
+	defaultChronicAbsenceThreshold = 0.8
+	chronicAbsenceMinSessions      = 3
+)
+
+type AttendanceHandler struct {
+	DB *sql.DB
+}
+
+func NewAttendanceHandler(db *sql.DB) *AttendanceHandler {
+	return &AttendanceHandler{DB: db}
+}
+
+type RollCallEntry struct {
+	StudentID int    `json:"student_id" binding:"required"`
+	Status    string `json:"status" binding:"required"`
+	Notes     string `json:"notes"`
+}
+
+type RollCallRequest struct {
+	// DefaultStatus, when set, is applied to every rostered student that is
+	// not listed in Records, so a teacher can send only the exceptions.
+	DefaultStatus string          `json:"default_status"`
+	Records       []RollCallEntry `json:"records"`
+}
+
+func isAttendanceStatus(status string) bool {
+	return status == attendancePresent || status == attendanceAbsent || status == attendanceLate
+}
+
+// canTakeAttendance checks the class exists and the caller may take
+// attendance for it: admins for any class, teachers only for their own.
+func (h *AttendanceHandler) canTakeAttendance(c *gin.Context, classID string) bool {
+	var teacherID sql.NullInt64
+	err := h.DB.QueryRow(`SELECT teacher_id FROM classes WHERE id = $1`, classID).Scan(&teacherID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !auth.CanAccessTeacher(c, int(teacherID.Int64)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only take attendance for your own classes"})
+		return false
+	}
+	return true
+}
+
+// classRoster lists the students actively enrolled in the class's course with
+// whatever attendance has been recorded for them so far.
+func classRoster(db queryerRows, classID string) ([]models.AttendanceRosterEntry, error) {
+	rows, err := db.Query(`
+		SELECT s.id, s.first_name, s.last_name,
+		       COALESCE(a.status, 'unmarked'), COALESCE(a.notes, ''), a.updated_at
+		FROM classes c
+		INNER JOIN enrollments e ON e.course_id = c.course_id AND e.status = 'active'
+		INNER JOIN students s ON s.id = e.student_id
+		LEFT JOIN attendance a ON a.class_id = c.id AND a.student_id = s.id
+		WHERE c.id = $1
+		ORDER BY s.last_name, s.first_name
+	`, classID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roster := []models.AttendanceRosterEntry{}
+	for rows.Next() {
+		var r models.AttendanceRosterEntry
+		var markedAt sql.NullTime
+		if err := rows.Scan(&r.StudentID, &r.FirstName, &r.LastName, &r.Status, &r.Notes, &markedAt); err != nil {
+			return nil, err
+		}
+		if markedAt.Valid {
+			r.MarkedAt = &markedAt.Time
+		}
+		roster = append(roster, r)
+	}
+	return roster, rows.Err()
+}
+
+func (h *AttendanceHandler) GetClassRoster(c *gin.Context) {
+	classID := c.Param("id")
+	if !h.canTakeAttendance(c, classID) {
+		return
+	}
+
+	roster, err := classRoster(h.DB, classID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, roster)
+}
+
+// TakeRollCall records attendance for a whole class in one transaction. Every
+// student in the request must be on the class roster.
+func (h *AttendanceHandler) TakeRollCall(c *gin.Context) {
+	classID := c.Param("id")
+	if !h.canTakeAttendance(c, classID) {
+		return
+	}
+
+	var req RollCallRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DefaultStatus != "" && !isAttendanceStatus(req.DefaultStatus) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "default_status must be present, absent or late"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	roster, err := classRoster(tx, classID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	onRoster := make(map[int]bool, len(roster))
+	for _, r := range roster {
+		onRoster[r.StudentID] = true
+	}
+
+	marks := make(map[int]RollCallEntry, len(roster))
+	for _, rec := range req.Records {
+		if !isAttendanceStatus(rec.Status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid status %q for student %d", rec.Status, rec.StudentID)})
+			return
+		}
+		if !onRoster[rec.StudentID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("student %d is not enrolled in this class's course", rec.StudentID)})
+			return
+		}
+		marks[rec.StudentID] = rec
+	}
+	if req.DefaultStatus != "" {
+		for _, r := range roster {
+			if _, ok := marks[r.StudentID]; !ok {
+				marks[r.StudentID] = RollCallEntry{StudentID: r.StudentID, Status: req.DefaultStatus}
+			}
+		}
+	}
+
+	for _, m := range marks {
+		_, err := tx.Exec(`
+			INSERT INTO attendance (class_id, student_id, status, notes)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (class_id, student_id) DO UPDATE
+			SET status = EXCLUDED.status, notes = EXCLUDED.notes, updated_at = CURRENT_TIMESTAMP
+		`, classID, m.StudentID, m.Status, m.Notes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	roster, err = classRoster(tx, classID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, roster)
+}
+
+func chronicAbsenceThreshold(c *gin.Context) (float64, bool) {
+	raw := c.Query("threshold")
+	if raw == "" {
+		return defaultChronicAbsenceThreshold, true
+	}
+	threshold, err := strconv.ParseFloat(raw, 64)
+	if err != nil || threshold < 0 || threshold > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a number between 0 and 1"})
+		return 0, false
+	}
+	return threshold, true
+}
+
+// attendanceSummaries runs a grouped tally query whose first selected columns
+// are the grouping keys, followed by present, late and absent counts.
+func (h *AttendanceHandler) attendanceSummaries(query string, threshold float64, scanKeys func(*models.AttendanceSummary) []interface{}, args ...interface{}) ([]models.AttendanceSummary, error) {
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.AttendanceSummary{}
+	for rows.Next() {
+		var s models.AttendanceSummary
+		dest := append(scanKeys(&s), &s.Present, &s.Late, &s.Absent)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		s.Marked = s.Present + s.Late + s.Absent
+		if s.Marked > 0 {
+			s.AttendanceRate = float64(s.Present+s.Late) / float64(s.Marked)
+		}
+		s.ChronicAbsence = s.Marked >= chronicAbsenceMinSessions && s.AttendanceRate < threshold
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+const attendanceTallies = `
+	COUNT(*) FILTER (WHERE a.status = 'present'),
+	COUNT(*) FILTER (WHERE a.status = 'late'),
+	COUNT(*) FILTER (WHERE a.status = 'absent')
+`
+
+// GetStudentAttendance reports a student's attendance per course.
+func (h *AttendanceHandler) GetStudentAttendance(c *gin.Context) {
+	threshold, ok := chronicAbsenceThreshold(c)
+	if !ok {
+		return
+	}
+
+	summaries, err := h.attendanceSummaries(`
+		SELECT co.id, co.name, `+attendanceTallies+`
+		FROM attendance a
+		INNER JOIN classes cl ON cl.id = a.class_id
+		INNER JOIN courses co ON co.id = cl.course_id
+		WHERE a.student_id = $1
+		GROUP BY co.id, co.name
+		ORDER BY co.name
+	`, threshold, func(s *models.AttendanceSummary) []interface{} {
+		return []interface{}{&s.CourseID, &s.CourseName}
+	}, c.Param("student_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	overall := models.AttendanceSummary{}
+	for _, s := range summaries {
+		overall.Present += s.Present
+		overall.Late += s.Late
+		overall.Absent += s.Absent
+	}
+	overall.Marked = overall.Present + overall.Late + overall.Absent
+	if overall.Marked > 0 {
+		overall.AttendanceRate = float64(overall.Present+overall.Late) / float64(overall.Marked)
+	}
+	overall.ChronicAbsence = overall.Marked >= chronicAbsenceMinSessions && overall.AttendanceRate < threshold
+
+	c.JSON(http.StatusOK, gin.H{
+		"overall": overall,
+		"courses": summaries,
+	})
+}
+
+// GetCourseAttendance reports every student's attendance in a course, lowest
+// attendance rate first so chronic absentees are at the top.
+func (h *AttendanceHandler) GetCourseAttendance(c *gin.Context) {
+	threshold, ok := chronicAbsenceThreshold(c)
+	if !ok {
+		return
+	}
+
+	summaries, err := h.attendanceSummaries(`
+		SELECT s.id, s.first_name || ' ' || s.last_name, `+attendanceTallies+`
+		FROM attendance a
+		INNER JOIN classes cl ON cl.id = a.class_id
+		INNER JOIN students s ON s.id = a.student_id
+		WHERE cl.course_id = $1
+		GROUP BY s.id, s.first_name, s.last_name
+		ORDER BY (COUNT(*) FILTER (WHERE a.status IN ('present', 'late')))::float / COUNT(*) ASC, s.last_name
+	`, threshold, func(s *models.AttendanceSummary) []interface{} {
+		return []interface{}{&s.StudentID, &s.StudentName}
+	}, c.Param("course_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summaries)
+}
+
+// GetTeacherAttendance reports attendance for each class a teacher has taught
+// and each of their students, so the teacher can follow up on absences.
+func (h *AttendanceHandler) GetTeacherAttendance(c *gin.Context) {
+	threshold, ok := chronicAbsenceThreshold(c)
+	if !ok {
+		return
+	}
+	teacherID := c.Param("teacher_id")
+
+	classes, err := h.attendanceSummaries(`
+		SELECT cl.id, cl.title, co.id, co.name, `+attendanceTallies+`
+		FROM attendance a
+		INNER JOIN classes cl ON cl.id = a.class_id
+		INNER JOIN courses co ON co.id = cl.course_id
+		WHERE cl.teacher_id = $1
+		GROUP BY cl.id, cl.title, co.id, co.name
+		ORDER BY MIN(cl.class_date)
+	`, threshold, func(s *models.AttendanceSummary) []interface{} {
+		return []interface{}{&s.ClassID, &s.ClassTitle, &s.CourseID, &s.CourseName}
+	}, teacherID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	students, err := h.attendanceSummaries(`
+		SELECT s.id, s.first_name || ' ' || s.last_name, co.id, co.name, `+attendanceTallies+`
+		FROM attendance a
+		INNER JOIN classes cl ON cl.id = a.class_id
+		INNER JOIN students s ON s.id = a.student_id
+		INNER JOIN courses co ON co.id = cl.course_id
+		WHERE cl.teacher_id = $1
+		GROUP BY s.id, s.first_name, s.last_name, co.id, co.name
+		ORDER BY co.name, s.last_name
+	`, threshold, func(s *models.AttendanceSummary) []interface{} {
+		return []interface{}{&s.StudentID, &s.StudentName, &s.CourseID, &s.CourseName}
+	}, teacherID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"classes":  classes,
+		"students": students,
+	})
+}
@@ -0,0 +1,474 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthHandler struct {
+	DB *sql.DB
+}
+
+func NewAuthHandler(db *sql.DB) *AuthHandler {
+	return &AuthHandler{DB: db}
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type TokenResponse struct {
+	AccessToken  string      `json:"access_token"`
+	TokenType    string      `json:"token_type"`
+	ExpiresAt    time.Time   `json:"expires_at"`
+	RefreshToken string      `json:"refresh_token"`
+	User         models.User `json:"user"`
+}
+
+const userColumns = `id, email, COALESCE(password_hash, ''), role, student_id, teacher_id, is_active,
+	COALESCE(failed_login_attempts, 0), locked_until, last_login_at, created_at, updated_at`
+
+func scanUser(row interface{ Scan(...interface{}) error }, u *models.User) error {
+	var studentID, teacherID sql.NullInt64
+	var lockedUntil, lastLogin sql.NullTime
+	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.Role, &studentID, &teacherID,
+		&u.IsActive, &u.FailedLoginAttempts, &lockedUntil, &lastLogin, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return err
+	}
+	u.StudentID, u.TeacherID, u.LockedUntil, u.LastLoginAt = nil, nil, nil, nil
+	u.InvitePending = u.PasswordHash == ""
+	if studentID.Valid {
+		id := int(studentID.Int64)
+		u.StudentID = &id
+	}
+	if teacherID.Valid {
+		id := int(teacherID.Int64)
+		u.TeacherID = &id
+	}
+	if lockedUntil.Valid {
+		u.LockedUntil = &lockedUntil.Time
+	}
+	if lastLogin.Valid {
+		u.LastLoginAt = &lastLogin.Time
+	}
+	return nil
+}
+
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var u models.User
+	err := scanUser(h.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE LOWER(email) = LOWER($1)`,
+		strings.TrimSpace(req.Email)), &u)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A locked account answers like any other until the right password is
+	// given, so the lockout does not reveal that the account exists.
+	locked := u.LockedUntil != nil && time.Now().Before(*u.LockedUntil)
+	if !auth.CheckPassword(u.PasswordHash, req.Password) {
+		if locked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
+		if err := h.recordFailedLogin(u); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	if locked {
+		c.JSON(http.StatusLocked, gin.H{
+			"error":        "Account is temporarily locked after too many failed login attempts",
+			"locked_until": u.LockedUntil,
+		})
+		return
+	}
+	if !u.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	_, err = h.DB.Exec(`
+		UPDATE users
+		SET last_login_at = CURRENT_TIMESTAMP, failed_login_attempts = 0, locked_until = NULL
+		WHERE id = $1
+	`, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	u.FailedLoginAttempts, u.LockedUntil = 0, nil
+
+	resp, err := h.issueTokens(h.DB, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// recordFailedLogin bumps the failure counter and locks the account once it
+// reaches auth.MaxFailedLogins. The counter restarts after each lockout.
+func (h *AuthHandler) recordFailedLogin(u models.User) error {
+	_, err := h.DB.Exec(`
+		UPDATE users
+		SET failed_login_attempts = CASE WHEN COALESCE(failed_login_attempts, 0) + 1 >= $2 THEN 0
+		                                 ELSE COALESCE(failed_login_attempts, 0) + 1 END,
+		    locked_until = CASE WHEN COALESCE(failed_login_attempts, 0) + 1 >= $2 THEN $3
+		                        ELSE locked_until END
+		WHERE id = $1
+	`, u.ID, auth.MaxFailedLogins, time.Now().Add(auth.LockoutDuration))
+	return err
+}
+
+// Refresh exchanges a refresh token for a new access/refresh pair. Refresh
+// tokens are single use: the presented token is revoked as part of the swap.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID int
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, user_id, expires_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = $1
+		FOR UPDATE
+	`, auth.HashToken(req.RefreshToken)).Scan(&tokenID, &userID, &expiresAt, &revokedAt)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has expired or been revoked"})
+		return
+	}
+
+	var u models.User
+	if err := scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, userID), &u); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if !u.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1`, tokenID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.issueTokens(tx, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.DB.Exec(`
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND revoked_at IS NULL
+	`, auth.HashToken(req.RefreshToken))
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+func (h *AuthHandler) Me(c *gin.Context) {
+	claims := auth.ClaimsFromContext(c)
+
+	var u models.User
+	err := scanUser(h.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, claims.UserID), &u)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type SetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ForgotPassword emails a single-use reset link. It answers the same way
+// whether or not the address has an account so it can't be used to probe
+// for registered emails.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var u models.User
+	err := scanUser(h.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE LOWER(email) = LOWER($1)`,
+		strings.TrimSpace(req.Email)), &u)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err == nil && u.IsActive {
+		token, err := createAccountToken(h.DB, u.ID, tokenPurposeReset, auth.PasswordResetTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := sendPasswordResetEmail(u.Email, token); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a reset link has been sent"})
+}
+
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	h.setPasswordWithToken(c, tokenPurposeReset)
+}
+
+func (h *AuthHandler) AcceptInvite(c *gin.Context) {
+	h.setPasswordWithToken(c, tokenPurposeInvite)
+}
+
+// setPasswordWithToken consumes a reset or invite token, stores the new
+// password, clears any lockout and revokes existing refresh tokens.
+func (h *AuthHandler) setPasswordWithToken(c *gin.Context, purpose string) {
+	var req SetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := auth.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID int
+	err = tx.QueryRow(`
+		SELECT id, user_id FROM account_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		FOR UPDATE
+	`, auth.HashToken(req.Token), purpose).Scan(&tokenID, &userID)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is invalid or has expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE users SET password_hash = $1, failed_login_attempts = 0, locked_until = NULL,
+			updated_at = CURRENT_TIMESTAMP WHERE id = $2`, []interface{}{hash, userID}},
+		{`UPDATE account_tokens SET used_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, []interface{}{userID, purpose}},
+		{`UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND revoked_at IS NULL`, []interface{}{userID}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
+}
+
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	claims := auth.ClaimsFromContext(c)
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := auth.ValidatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var u models.User
+	if err := scanUser(h.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, claims.UserID), &u); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.CheckPassword(u.PasswordHash, req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+	`, hash, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Sign out every session, then give this one fresh tokens.
+	_, err = tx.Exec(`
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL
+	`, u.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resp, err := h.issueTokens(tx, u)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AuthHandler) issueTokens(db execer, u models.User) (*TokenResponse, error) {
+	studentID, teacherID := 0, 0
+	if u.StudentID != nil {
+		studentID = *u.StudentID
+	}
+	if u.TeacherID != nil {
+		teacherID = *u.TeacherID
+	}
+
+	accessToken, expiresAt, err := auth.GenerateAccessToken(u.ID, u.Role, studentID, teacherID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, u.ID, refreshHash, time.Now().Add(auth.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+		User:         u,
+	}, nil
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"uedu-api/internal/models"
+	"uedu-api/internal/shuffle"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errBlueprintShort = errors.New("the question bank has too few questions for this exam's blueprint")
+
+type BlueprintHandler struct {
+	DB *sql.DB
+}
+
+func NewBlueprintHandler(db *sql.DB) *BlueprintHandler {
+	return &BlueprintHandler{DB: db}
+}
+
+type SaveBlueprintRequest struct {
+	Sections []models.BlueprintSection `json:"sections"`
+}
+
+const blueprintColumns = `id, exam_id, position, COALESCE(question_type, ''), COALESCE(skill, ''),
+	COALESCE(cefr_level, ''), COALESCE(topic, ''), COALESCE(difficulty, 0), item_count,
+	COALESCE(passage_count, 0), created_at`
+
+func getBlueprint(db queryerRows, examID int) ([]models.BlueprintSection, error) {
+	rows, err := db.Query(`SELECT `+blueprintColumns+` FROM exam_blueprint_sections WHERE exam_id = $1 ORDER BY position, id`, examID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sections := []models.BlueprintSection{}
+	for rows.Next() {
+		var s models.BlueprintSection
+		if err := rows.Scan(&s.ID, &s.ExamID, &s.Position, &s.QuestionType, &s.Skill, &s.CEFRLevel,
+			&s.Topic, &s.Difficulty, &s.ItemCount, &s.PassageCount, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		sections = append(sections, s)
+	}
+	return sections, rows.Err()
+}
+
+func validateSection(s *models.BlueprintSection) error {
+	s.QuestionType = strings.TrimSpace(s.QuestionType)
+	s.Skill = strings.ToLower(strings.TrimSpace(s.Skill))
+	s.CEFRLevel = strings.ToUpper(strings.TrimSpace(s.CEFRLevel))
+	s.Topic = strings.TrimSpace(s.Topic)
+	switch {
+	case s.ItemCount < 1:
+		return errors.New("item_count must be at least 1")
+	case s.PassageCount < 0:
+		return errors.New("passage_count cannot be negative")
+	case s.Skill != "" && !isSkill(s.Skill):
+		return fmt.Errorf("skill must be one of %s", strings.Join(skillNames, ", "))
+	case s.CEFRLevel != "" && cefrRank(s.CEFRLevel) < 0:
+		return fmt.Errorf("cefr_level must be one of %s", strings.Join(cefrLevels, ", "))
+	case s.Difficulty < 0 || s.Difficulty > maxDifficulty:
+		return fmt.Errorf("difficulty must be 0 (unrated) to %d", maxDifficulty)
+	}
+	return nil
+}
+
+// attemptItem is a question placed on an attempt.
+type attemptItem struct {
+	ID           int
+	QuestionType string
+	Passage      string
+	Options      string
+	Points       int
+}
+
+const attemptItemColumns = `id, COALESCE(question_type, ''), COALESCE(passage, ''), COALESCE(options::text, ''), points`
+
+func listAttemptItems(db queryerRows, query string, args ...interface{}) ([]attemptItem, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []attemptItem
+	for rows.Next() {
+		var it attemptItem
+		if err := rows.Scan(&it.ID, &it.QuestionType, &it.Passage, &it.Options, &it.Points); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// sectionCandidates returns the bank questions a section may draw from, in a
+// stable order so a seed always draws the same items from the same bank.
+func sectionCandidates(db queryerRows, s models.BlueprintSection) ([]attemptItem, error) {
+	query := `SELECT ` + attemptItemColumns + ` FROM questions WHERE exam_id IS NULL`
+	args := []interface{}{}
+
+	filters := []struct{ column, value string }{
+		{"question_type", s.QuestionType},
+		{"skill", s.Skill},
+		{"cefr_level", s.CEFRLevel},
+		{"topic", s.Topic},
+	}
+	for _, f := range filters {
+		if f.value != "" {
+			args = append(args, f.value)
+			query += fmt.Sprintf(" AND LOWER(%s) = LOWER($%d)", f.column, len(args))
+		}
+	}
+	if s.Difficulty > 0 {
+		args = append(args, s.Difficulty)
+		query += fmt.Sprintf(" AND difficulty = $%d", len(args))
+	}
+	if s.PassageCount > 0 {
+		query += " AND TRIM(COALESCE(passage, '')) <> ''"
+	}
+	query += " ORDER BY order_num, id"
+
+	return listAttemptItems(db, query, args...)
+}
+
+// passageGroups groups questions by reading passage and keeps the passages
+// with at least n questions.
+func passageGroups(items []attemptItem, n int) [][]attemptItem {
+	var groups [][]attemptItem
+	index := map[string]int{}
+	for _, it := range items {
+		passage := strings.TrimSpace(it.Passage)
+		i, ok := index[passage]
+		if !ok {
+			i = len(groups)
+			index[passage] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], it)
+	}
+
+	var out [][]attemptItem
+	for _, g := range groups {
+		if len(g) >= n {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+func sectionAvailable(s models.BlueprintSection, candidates []attemptItem) int {
+	if s.PassageCount > 0 {
+		return len(passageGroups(candidates, s.ItemCount))
+	}
+	return len(candidates)
+}
+
+// drawBlueprint draws every section's questions for one attempt. A question
+// is drawn at most once even when sections overlap.
+func drawBlueprint(db queryerRows, sections []models.BlueprintSection, r *shuffle.Rand) ([]attemptItem, error) {
+	drawn := map[int]bool{}
+	var out []attemptItem
+	for n, s := range sections {
+		all, err := sectionCandidates(db, s)
+		if err != nil {
+			return nil, err
+		}
+		var candidates []attemptItem
+		for _, it := range all {
+			if !drawn[it.ID] {
+				candidates = append(candidates, it)
+			}
+		}
+
+		var picked []attemptItem
+		if s.PassageCount > 0 {
+			groups := passageGroups(candidates, s.ItemCount)
+			if len(groups) < s.PassageCount {
+				return nil, fmt.Errorf("%w: section %d needs %d passages with %d questions, %d available",
+					errBlueprintShort, n+1, s.PassageCount, s.ItemCount, len(groups))
+			}
+			for _, i := range r.Perm(len(groups))[:s.PassageCount] {
+				picked = append(picked, groups[i][:s.ItemCount]...)
+			}
+		} else {
+			if len(candidates) < s.ItemCount {
+				return nil, fmt.Errorf("%w: section %d needs %d questions, %d available",
+					errBlueprintShort, n+1, s.ItemCount, len(candidates))
+			}
+			for _, i := range r.Perm(len(candidates))[:s.ItemCount] {
+				picked = append(picked, candidates[i])
+			}
+		}
+
+		for _, it := range picked {
+			drawn[it.ID] = true
+		}
+		out = append(out, picked...)
+	}
+	return out, nil
+}
+
+func (h *BlueprintHandler) respondBlueprint(c *gin.Context, examID int) {
+	sections, err := getBlueprint(h.DB, examID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ready := true
+	for i := range sections {
+		candidates, err := sectionCandidates(h.DB, sections[i])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		sections[i].Available = sectionAvailable(sections[i], candidates)
+		need := sections[i].ItemCount
+		if sections[i].PassageCount > 0 {
+			need = sections[i].PassageCount
+		}
+		if sections[i].Available < need {
+			ready = false
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"exam_id":  examID,
+		"sections": sections,
+		"ready":    ready,
+	})
+}
+
+// GetBlueprint lists an exam's blueprint sections with how many matching
+// questions (or passages) the bank holds for each. ready is false when a
+// section cannot be filled.
+func (h *BlueprintHandler) GetBlueprint(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+	h.respondBlueprint(c, examID)
+}
+
+// SaveBlueprint replaces an exam's blueprint. An empty list turns the exam
+// back into a fixed set of questions. Like any edit it takes effect when the
+// exam is next published; attempts already started keep the questions they
+// drew.
+func (h *BlueprintHandler) SaveBlueprint(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+	var req SaveBlueprintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range req.Sections {
+		if err := validateSection(&req.Sections[i]); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("section %d: %s", i+1, err.Error())})
+			return
+		}
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM exams WHERE id = $1)`, examID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM exam_blueprint_sections WHERE exam_id = $1`, examID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i, s := range req.Sections {
+		if _, err := tx.Exec(`
+			INSERT INTO exam_blueprint_sections (exam_id, position, question_type, skill, cefr_level, topic, difficulty, item_count, passage_count)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, 0), $8, $9)
+		`, examID, i, s.QuestionType, s.Skill, s.CEFRLevel, s.Topic, s.Difficulty, s.ItemCount, s.PassageCount); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := markExamDraft(tx, examID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondBlueprint(c, examID)
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/ical"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CalendarHandler struct {
+	DB *sql.DB
+}
+
+func NewCalendarHandler(db *sql.DB) *CalendarHandler {
+	return &CalendarHandler{DB: db}
+}
+
+// calendarLocation is the zone class and exam times are entered in. The
+// TIMESTAMP columns store wall-clock times, so feeds need it to tell
+// calendar clients what those times mean.
+func calendarLocation() (*time.Location, error) {
+	name := os.Getenv("CALENDAR_TIMEZONE")
+	if name == "" {
+		name = "UTC"
+	}
+	return time.LoadLocation(name)
+}
+
+// feedBaseURL is the public address of the API, used to build feed links.
+func feedBaseURL(c *gin.Context) string {
+	if url := os.Getenv("API_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// CreateFeedToken issues the caller's calendar subscription link. Only the
+// token hash is stored, so calling it again rotates the link and the old one
+// stops working.
+func (h *CalendarHandler) CreateFeedToken(c *gin.Context) {
+	claims := auth.ClaimsFromContext(c)
+
+	raw, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = h.DB.Exec(`
+		INSERT INTO calendar_tokens (user_id, token_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = CURRENT_TIMESTAMP
+	`, claims.UserID, hash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url": fmt.Sprintf("%s/api/v1/calendar/feed/%s.ics", feedBaseURL(c), raw),
+	})
+}
+
+func (h *CalendarHandler) RevokeFeedToken(c *gin.Context) {
+	claims := auth.ClaimsFromContext(c)
+
+	if _, err := h.DB.Exec(`DELETE FROM calendar_tokens WHERE user_id = $1`, claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar link revoked successfully"})
+}
+
+// GetFeed serves the iCalendar feed behind a subscription link. It is public
+// because calendar clients cannot send our bearer tokens; the link itself is
+// the credential.
+func (h *CalendarHandler) GetFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	var role string
+	var studentID, teacherID sql.NullInt64
+	err := h.DB.QueryRow(`
+		SELECT u.role, u.student_id, u.teacher_id
+		FROM calendar_tokens ct
+		INNER JOIN users u ON u.id = ct.user_id
+		WHERE ct.token_hash = $1 AND u.is_active = TRUE
+	`, auth.HashToken(token)).Scan(&role, &studentID, &teacherID)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendar not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var userType string
+	var userID interface{}
+	switch role {
+	case auth.RoleStudent:
+		userType, userID = "student", studentID.Int64
+	case auth.RoleTeacher:
+		userType, userID = "teacher", teacherID.Int64
+	}
+
+	events, err := listEvents(h.DB, userType, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Removed classes stay in the feed as cancelled under their original
+	// UID, or subscribed calendars would keep their stale copies.
+	removed, err := listRemovedClasses(h.DB, userType, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	events = append(events, removed...)
+
+	loc, err := calendarLocation()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cal := ical.Calendar{Name: "uEdu schedule", Location: loc}
+	for _, e := range events {
+		cal.Events = append(cal.Events, feedEvent(e))
+	}
+
+	var out strings.Builder
+	cal.Write(&out)
+	c.Header("Content-Disposition", `inline; filename="uedu.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(out.String()))
+}
+
+// feedEvent maps a schedule event to a VEVENT. UIDs are derived from the
+// event type and row id so they stay stable across feed refreshes.
+func feedEvent(e models.Event) ical.Event {
+	duration := e.Duration
+	if duration <= 0 {
+		duration = defaultDuration
+	}
+
+	summary := e.Title
+	if e.Type == "exam" {
+		summary = "Exam: " + e.Title
+	}
+
+	var details []string
+	if e.CourseName != "" {
+		details = append(details, "Course: "+e.CourseName)
+	}
+	if teacher := strings.TrimSpace(e.TeacherFirstName + " " + e.TeacherLastName); teacher != "" {
+		details = append(details, "Teacher: "+teacher)
+	}
+
+	status := ical.StatusConfirmed
+	if e.Cancelled {
+		status = ical.StatusCancelled
+	}
+
+	return ical.Event{
+		UID:          fmt.Sprintf("%s-%d@uedu", e.Type, e.ID),
+		Summary:      summary,
+		Description:  strings.Join(details, "\n"),
+		Location:     e.Room,
+		Start:        e.Date,
+		End:          e.Date.Add(time.Duration(duration) * time.Minute),
+		Status:       status,
+		LastModified: e.UpdatedAt,
+	}
+}
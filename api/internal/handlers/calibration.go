@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/grading"
+	"uedu-api/internal/irt"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errCalibrationModel = errors.New("model must be rasch or 2pl")
+
+// DefaultMinResponses is how many responses an item needs to be calibrated
+// when no minimum is given.
+const DefaultMinResponses = 30
+
+type CalibrationHandler struct {
+	DB *sql.DB
+}
+
+func NewCalibrationHandler(db *sql.DB) *CalibrationHandler {
+	return &CalibrationHandler{DB: db}
+}
+
+type CalibrationRequest struct {
+	Model        string `json:"model"`         // 2pl when empty
+	MinResponses int    `json:"min_responses"` // DefaultMinResponses when zero
+}
+
+// calibrationResponses loads each student's response to every
+// automatically graded question they were delivered in a graded attempt.
+// Keying by student links the bank through students who met questions in
+// different exams; a question met more than once counts only at its latest
+// attempt, so one ability stands behind each student's responses. A
+// question left blank counts as wrong, as it does in the score.
+func calibrationResponses(db queryerRows) ([]irt.Response, error) {
+	query := `
+		SELECT DISTINCT ON (er.student_id, q.id) er.student_id, q.id, COALESCE(a.is_correct, FALSE)
+		FROM exam_results er
+		JOIN ` + attemptQuestions + ` ON TRUE
+		LEFT JOIN answers a ON a.exam_result_id = er.id AND a.question_id = q.id
+		WHERE er.status IN ($1, $2)`
+	args := []interface{}{attemptPassed, attemptFailed}
+	for _, t := range grading.ManualTypes {
+		args = append(args, t)
+		query += fmt.Sprintf(" AND COALESCE(q.question_type, '') <> $%d", len(args))
+	}
+	query += " ORDER BY er.student_id, q.id, er.completed_at DESC NULLS LAST, er.id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var responses []irt.Response
+	for rows.Next() {
+		var r irt.Response
+		if err := rows.Scan(&r.Respondent, &r.Item, &r.Correct); err != nil {
+			return nil, err
+		}
+		responses = append(responses, r)
+	}
+	return responses, rows.Err()
+}
+
+// RunCalibration estimates item parameters from the stored answers and
+// writes them, with their fit, onto the questions. Questions that were not
+// calibrated keep the parameters they had. triggeredBy is nil when the run
+// does not come from a user. Runs never overlap.
+func RunCalibration(db *sql.DB, model string, minResponses int, triggeredBy *int) (*models.CalibrationRun, error) {
+	if model == "" {
+		model = irt.Model2PL
+	}
+	if model != irt.ModelRasch && model != irt.Model2PL {
+		return nil, errCalibrationModel
+	}
+	if minResponses <= 0 {
+		minResponses = DefaultMinResponses
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`LOCK TABLE calibration_runs IN EXCLUSIVE MODE`); err != nil {
+		return nil, err
+	}
+	responses, err := calibrationResponses(tx)
+	if err != nil {
+		return nil, err
+	}
+	result := irt.Calibrate(responses, irt.Options{Model: model, MinResponses: minResponses})
+
+	run := models.CalibrationRun{
+		Model:         model,
+		MinResponses:  minResponses,
+		Respondents:   result.Respondents,
+		Responses:     result.Responses,
+		Iterations:    result.Iterations,
+		Converged:     result.Converged,
+		LogLikelihood: result.LogLikelihood,
+		TriggeredBy:   triggeredBy,
+		Items:         result.Items,
+	}
+	if run.Items == nil {
+		run.Items = []models.ItemCalibration{}
+	}
+	for _, it := range run.Items {
+		switch {
+		case it.Status != irt.StatusCalibrated:
+			run.ItemsSkipped++
+		case it.Flagged:
+			run.ItemsFlagged++
+			run.ItemsCalibrated++
+		default:
+			run.ItemsCalibrated++
+		}
+	}
+	items, err := json.Marshal(run.Items)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(`
+		INSERT INTO calibration_runs (model, min_responses, respondents, responses, items_calibrated, items_flagged,
+		                              items_skipped, iterations, converged, log_likelihood, items, triggered_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at
+	`, run.Model, run.MinResponses, run.Respondents, run.Responses, run.ItemsCalibrated, run.ItemsFlagged,
+		run.ItemsSkipped, run.Iterations, run.Converged, run.LogLikelihood, string(items), run.TriggeredBy).Scan(&run.ID, &run.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, it := range run.Items {
+		if it.Status != irt.StatusCalibrated {
+			continue
+		}
+		reasons, err := json.Marshal(it.FlagReasons)
+		if err != nil {
+			return nil, err
+		}
+		// A fresh calibration replaces any earlier review.
+		if _, err := tx.Exec(`
+			UPDATE questions SET irt_model = $2, irt_difficulty = $3, irt_difficulty_se = $4, irt_discrimination = $5,
+			       irt_discrimination_se = $6, irt_infit = $7, irt_outfit = $8, irt_responses = $9,
+			       irt_calibrated_at = $10, irt_run_id = $11, irt_flagged = $12, irt_flag_reasons = $13,
+			       irt_reviewed_by = NULL, irt_reviewed_at = NULL
+			WHERE id = $1
+		`, it.QuestionID, run.Model, it.Difficulty, it.DifficultySE, it.Discrimination, it.DiscriminationSE,
+			it.Infit, it.Outfit, it.Responses, run.CreatedAt, run.ID, it.Flagged, string(reasons)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+const calibrationRunColumns = `id, model, min_responses, respondents, responses, items_calibrated, items_flagged,
+	items_skipped, iterations, converged, COALESCE(log_likelihood, 0), triggered_by, created_at`
+
+func scanCalibrationRun(row interface{ Scan(...interface{}) error }, run *models.CalibrationRun, dest ...interface{}) error {
+	var triggeredBy sql.NullInt64
+	if err := row.Scan(append([]interface{}{&run.ID, &run.Model, &run.MinResponses, &run.Respondents, &run.Responses,
+		&run.ItemsCalibrated, &run.ItemsFlagged, &run.ItemsSkipped, &run.Iterations, &run.Converged,
+		&run.LogLikelihood, &triggeredBy, &run.CreatedAt}, dest...)...); err != nil {
+		return err
+	}
+	run.TriggeredBy = nullableInt(triggeredBy)
+	return nil
+}
+
+// StartCalibration runs a calibration now and returns it with every item's
+// estimates.
+func (h *CalibrationHandler) StartCalibration(c *gin.Context) {
+	var req CalibrationRequest
+	// The body is optional; every field has a default.
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var triggeredBy *int
+	if claims := auth.ClaimsFromContext(c); claims != nil && claims.UserID != 0 {
+		triggeredBy = &claims.UserID
+	}
+
+	run, err := RunCalibration(h.DB, req.Model, req.MinResponses, triggeredBy)
+	if err == errCalibrationModel {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, run)
+}
+
+// GetCalibrationRuns lists the calibrations run, newest first, without
+// their items.
+func (h *CalibrationHandler) GetCalibrationRuns(c *gin.Context) {
+	rows, err := h.DB.Query(`SELECT ` + calibrationRunColumns + ` FROM calibration_runs ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	runs := []models.CalibrationRun{}
+	for rows.Next() {
+		var run models.CalibrationRun
+		if err := scanCalibrationRun(rows, &run); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// GetCalibrationRun returns a calibration with every item's estimates.
+func (h *CalibrationHandler) GetCalibrationRun(c *gin.Context) {
+	var run models.CalibrationRun
+	var items []byte
+	err := scanCalibrationRun(h.DB.QueryRow(`SELECT `+calibrationRunColumns+`, items FROM calibration_runs WHERE id = $1`,
+		c.Param("id")), &run, &items)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calibration run not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	run.Items = []models.ItemCalibration{}
+	if len(items) > 0 {
+		if err := json.Unmarshal(items, &run.Items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// GetCalibratedItems lists the calibrated questions, worst infit first.
+// flagged=true keeps only those waiting for review.
+func (h *CalibrationHandler) GetCalibratedItems(c *gin.Context) {
+	query := `
+		SELECT id, exam_id, question_text, COALESCE(question_type, ''), COALESCE(skill, ''), COALESCE(cefr_level, ''),
+		       irt_model, COALESCE(irt_responses, 0), irt_difficulty, irt_difficulty_se, irt_discrimination,
+		       irt_discrimination_se, irt_infit, irt_outfit, COALESCE(irt_flagged, FALSE), irt_flag_reasons,
+		       irt_run_id, irt_calibrated_at, irt_reviewed_by, irt_reviewed_at
+		FROM questions
+		WHERE irt_calibrated_at IS NOT NULL`
+	if flagged, _ := strconv.ParseBool(c.Query("flagged")); flagged {
+		query += " AND irt_flagged"
+	}
+	query += " ORDER BY ABS(COALESCE(irt_infit, 1) - 1) DESC, id"
+
+	rows, err := h.DB.Query(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.CalibratedQuestion{}
+	for rows.Next() {
+		var q models.CalibratedQuestion
+		var examID, runID, reviewedBy sql.NullInt64
+		var difficulty, difficultySE, discrimination, discriminationSE, infit, outfit sql.NullFloat64
+		var reasons []byte
+		if err := rows.Scan(&q.QuestionID, &examID, &q.QuestionText, &q.QuestionType, &q.Skill, &q.CEFRLevel,
+			&q.Model, &q.Responses, &difficulty, &difficultySE, &discrimination, &discriminationSE, &infit, &outfit,
+			&q.Flagged, &reasons, &runID, &q.CalibratedAt, &reviewedBy, &q.ReviewedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		q.Status = irt.StatusCalibrated
+		q.ExamID, q.RunID, q.ReviewedBy = nullableInt(examID), nullableInt(runID), nullableInt(reviewedBy)
+		q.Difficulty, q.DifficultySE = nullableFloat(difficulty), nullableFloat(difficultySE)
+		q.Discrimination, q.DiscriminationSE = nullableFloat(discrimination), nullableFloat(discriminationSE)
+		q.Infit, q.Outfit = nullableFloat(infit), nullableFloat(outfit)
+		if len(reasons) > 0 {
+			if err := json.Unmarshal(reasons, &q.FlagReasons); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		items = append(items, q)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// ReviewCalibratedItem clears a question's misfit flag once an admin has
+// looked at it and decided to keep it, letting adaptive exams use it again.
+func (h *CalibrationHandler) ReviewCalibratedItem(c *gin.Context) {
+	var reviewedBy *int
+	if claims := auth.ClaimsFromContext(c); claims != nil && claims.UserID != 0 {
+		reviewedBy = &claims.UserID
+	}
+	result, err := h.DB.Exec(`
+		UPDATE questions SET irt_flagged = FALSE, irt_reviewed_by = $2, irt_reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND irt_calibrated_at IS NOT NULL
+	`, c.Param("id"), reviewedBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calibrated question not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Question reviewed"})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"strconv"
 	"uedu-api/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -19,7 +20,7 @@ func NewClassHandler(db *sql.DB) *ClassHandler {
 func (h *ClassHandler) GetClasses(c *gin.Context) {
 	rows, err := h.DB.Query(`
 		SELECT c.id, c.course_id, c.teacher_id, c.title, c.description, c.class_date, 
-		       c.duration, c.room, c.created_at, c.updated_at,
+		       c.duration, c.room, c.room_id, c.series_id, COALESCE(c.is_override, FALSE), c.cancelled_at, c.created_at, c.updated_at,
 		       co.name as course_name, 
 		       t.first_name as teacher_first_name, t.last_name as teacher_last_name
 		FROM classes c
@@ -36,13 +37,15 @@ func (h *ClassHandler) GetClasses(c *gin.Context) {
 	var classes []models.ClassWithDetails
 	for rows.Next() {
 		var class models.ClassWithDetails
+		var roomID, seriesID sql.NullInt64
 		if err := rows.Scan(&class.ID, &class.CourseID, &class.TeacherID, &class.Title, 
 			&class.Description, &class.ClassDate, &class.Duration, &class.Room, 
-			&class.CreatedAt, &class.UpdatedAt, &class.CourseName, &class.TeacherFirstName, 
+			&roomID, &seriesID, &class.IsOverride, &class.CancelledAt, &class.CreatedAt, &class.UpdatedAt, &class.CourseName, &class.TeacherFirstName, 
 			&class.TeacherLastName); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		class.RoomID, class.SeriesID = nullableInt(roomID), nullableInt(seriesID)
 		classes = append(classes, class)
 	}
 
@@ -52,9 +55,10 @@ func (h *ClassHandler) GetClasses(c *gin.Context) {
 func (h *ClassHandler) GetClass(c *gin.Context) {
 	id := c.Param("id")
 	var class models.ClassWithDetails
+	var roomID, seriesID sql.NullInt64
 	err := h.DB.QueryRow(`
 		SELECT c.id, c.course_id, c.teacher_id, c.title, c.description, c.class_date, 
-		       c.duration, c.room, c.created_at, c.updated_at,
+		       c.duration, c.room, c.room_id, c.series_id, COALESCE(c.is_override, FALSE), c.cancelled_at, c.created_at, c.updated_at,
 		       co.name as course_name, 
 		       t.first_name as teacher_first_name, t.last_name as teacher_last_name
 		FROM classes c
@@ -63,7 +67,7 @@ func (h *ClassHandler) GetClass(c *gin.Context) {
 		WHERE c.id = $1
 	`, id).Scan(&class.ID, &class.CourseID, &class.TeacherID, &class.Title, 
 		&class.Description, &class.ClassDate, &class.Duration, &class.Room, 
-		&class.CreatedAt, &class.UpdatedAt, &class.CourseName, &class.TeacherFirstName, 
+		&roomID, &seriesID, &class.IsOverride, &class.CancelledAt, &class.CreatedAt, &class.UpdatedAt, &class.CourseName, &class.TeacherFirstName, 
 		&class.TeacherLastName)
 
 	if err == sql.ErrNoRows {
@@ -74,10 +78,32 @@ func (h *ClassHandler) GetClass(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	class.RoomID, class.SeriesID = nullableInt(roomID), nullableInt(seriesID)
 
 	c.JSON(http.StatusOK, class)
 }
 
+// classRoomIssues resolves the class's room_id and checks the room holds the
+// course's capacity. It writes the response and returns false when the
+// request should stop.
+func (h *ClassHandler) classRoomIssues(c *gin.Context, class *models.Class) ([]string, bool) {
+	room, err := resolveRoom(h.DB, class.RoomID, &class.Room)
+	if err == errRoomNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	seats, err := courseSeats(h.DB, class.CourseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return roomFitIssues(room, seats, nil), true
+}
+
 func (h *ClassHandler) CreateClass(c *gin.Context) {
 	var class models.Class
 	if err := c.ShouldBindJSON(&class); err != nil {
@@ -85,17 +111,43 @@ func (h *ClassHandler) CreateClass(c *gin.Context) {
 		return
 	}
 
-	err := h.DB.QueryRow(`
-		INSERT INTO classes (course_id, teacher_id, title, description, class_date, duration, room) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7) 
+	roomIssues, ok := h.classRoomIssues(c, &class)
+	if !ok {
+		return
+	}
+	slot := scheduleSlot{
+		TeacherID: class.TeacherID,
+		Room:      class.Room,
+		Start:     class.ClassDate,
+		Duration:  class.Duration,
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if !checkSchedule(c, tx, slot, roomIssues) {
+		return
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO classes (course_id, teacher_id, title, description, class_date, duration, room, room_id) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
 		RETURNING id, created_at, updated_at
 	`, class.CourseID, class.TeacherID, class.Title, class.Description, 
-		class.ClassDate, class.Duration, class.Room).Scan(&class.ID, &class.CreatedAt, &class.UpdatedAt)
+		class.ClassDate, class.Duration, class.Room, class.RoomID).Scan(&class.ID, &class.CreatedAt, &class.UpdatedAt)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusCreated, class)
 }
@@ -108,18 +160,50 @@ func (h *ClassHandler) UpdateClass(c *gin.Context) {
 		return
 	}
 
-	_, err := h.DB.Exec(`
+	roomIssues, ok := h.classRoomIssues(c, &class)
+	if !ok {
+		return
+	}
+	classID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	slot := scheduleSlot{
+		TeacherID:     class.TeacherID,
+		Room:          class.Room,
+		Start:         class.ClassDate,
+		Duration:      class.Duration,
+		IgnoreClassID: classID,
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if !checkSchedule(c, tx, slot, roomIssues) {
+		return
+	}
+
+	_, err = tx.Exec(`
 		UPDATE classes 
 		SET course_id=$1, teacher_id=$2, title=$3, description=$4, class_date=$5, 
-		    duration=$6, room=$7, updated_at=CURRENT_TIMESTAMP 
-		WHERE id=$8
+		    duration=$6, room=$7, room_id=$8, is_override=(series_id IS NOT NULL), updated_at=CURRENT_TIMESTAMP 
+		WHERE id=$9
 	`, class.CourseID, class.TeacherID, class.Title, class.Description, 
-		class.ClassDate, class.Duration, class.Room, id)
+		class.ClassDate, class.Duration, class.Room, class.RoomID, id)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Class updated successfully"})
 }
@@ -127,18 +211,43 @@ func (h *ClassHandler) UpdateClass(c *gin.Context) {
 func (h *ClassHandler) DeleteClass(c *gin.Context) {
 	id := c.Param("id")
 
-	result, err := h.DB.Exec("DELETE FROM classes WHERE id = $1", id)
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Deleting one occurrence of a series records it as an exception date so
+	// regenerating the series does not bring it back.
+	_, err = tx.Exec(`
+		UPDATE class_series cs
+		SET exception_dates = COALESCE(cs.exception_dates, '[]'::jsonb) || to_jsonb(to_char(c.occurrence_date, 'YYYY-MM-DD')),
+		    updated_at = CURRENT_TIMESTAMP
+		FROM classes c
+		WHERE c.id = $1 AND cs.id = c.series_id AND c.occurrence_date IS NOT NULL
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, err := removeClasses(tx, `id = $1`, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Class deleted successfully"})
 }
 
@@ -147,7 +256,7 @@ func (h *ClassHandler) GetClassesByTeacher(c *gin.Context) {
 
 	rows, err := h.DB.Query(`
 		SELECT c.id, c.course_id, c.teacher_id, c.title, c.description, c.class_date, 
-		       c.duration, c.room, c.created_at, c.updated_at,
+		       c.duration, c.room, c.room_id, c.series_id, COALESCE(c.is_override, FALSE), c.cancelled_at, c.created_at, c.updated_at,
 		       co.name as course_name
 		FROM classes c
 		LEFT JOIN courses co ON c.course_id = co.id
@@ -163,12 +272,14 @@ func (h *ClassHandler) GetClassesByTeacher(c *gin.Context) {
 	var classes []models.ClassWithDetails
 	for rows.Next() {
 		var class models.ClassWithDetails
+		var roomID, seriesID sql.NullInt64
 		if err := rows.Scan(&class.ID, &class.CourseID, &class.TeacherID, &class.Title, 
 			&class.Description, &class.ClassDate, &class.Duration, &class.Room, 
-			&class.CreatedAt, &class.UpdatedAt, &class.CourseName); err != nil {
+			&roomID, &seriesID, &class.IsOverride, &class.CancelledAt, &class.CreatedAt, &class.UpdatedAt, &class.CourseName); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		class.RoomID, class.SeriesID = nullableInt(roomID), nullableInt(seriesID)
 		classes = append(classes, class)
 	}
 
@@ -180,14 +291,14 @@ func (h *ClassHandler) GetClassesByStudent(c *gin.Context) {
 
 	rows, err := h.DB.Query(`
 		SELECT c.id, c.course_id, c.teacher_id, c.title, c.description, c.class_date, 
-		       c.duration, c.room, c.created_at, c.updated_at,
+		       c.duration, c.room, c.room_id, c.series_id, COALESCE(c.is_override, FALSE), c.cancelled_at, c.created_at, c.updated_at,
 		       co.name as course_name,
 		       t.first_name as teacher_first_name, t.last_name as teacher_last_name
 		FROM classes c
 		INNER JOIN courses co ON c.course_id = co.id
 		INNER JOIN enrollments e ON e.course_id = co.id
 		LEFT JOIN teachers t ON c.teacher_id = t.id
-		WHERE e.student_id = $1
+		WHERE e.student_id = $1 AND e.status = 'active'
 		ORDER BY c.class_date ASC
 	`, studentID)
 	if err != nil {
@@ -199,13 +310,15 @@ func (h *ClassHandler) GetClassesByStudent(c *gin.Context) {
 	var classes []models.ClassWithDetails
 	for rows.Next() {
 		var class models.ClassWithDetails
+		var roomID, seriesID sql.NullInt64
 		if err := rows.Scan(&class.ID, &class.CourseID, &class.TeacherID, &class.Title, 
 			&class.Description, &class.ClassDate, &class.Duration, &class.Room, 
-			&class.CreatedAt, &class.UpdatedAt, &class.CourseName, 
+			&roomID, &seriesID, &class.IsOverride, &class.CancelledAt, &class.CreatedAt, &class.UpdatedAt, &class.CourseName, 
 			&class.TeacherFirstName, &class.TeacherLastName); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		class.RoomID, class.SeriesID = nullableInt(roomID), nullableInt(seriesID)
 		classes = append(classes, class)
 	}
 
@@ -213,9 +326,78 @@ func (h *ClassHandler) GetClassesByStudent(c *gin.Context) {
 }
 
 func (h *ClassHandler) GetAllEvents(c *gin.Context) {
-	userType := c.Query("user_type")
-	userID := c.Query("user_id")
+	events, err := listEvents(h.DB, c.Query("user_type"), c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
+	c.JSON(http.StatusOK, events)
+}
+
+// removeClasses deletes the classes matching where and records them in
+// removed_classes, so calendar feeds can cancel the copies subscribers
+// already hold. It returns how many were removed.
+func removeClasses(db execer, where string, args ...interface{}) (int64, error) {
+	result, err := db.Exec(`
+		WITH removed AS (
+			DELETE FROM classes WHERE `+where+`
+			RETURNING id, series_id, course_id, teacher_id, title, class_date, duration, room
+		)
+		INSERT INTO removed_classes (class_id, series_id, course_id, teacher_id, title, class_date, duration, room)
+		SELECT id, series_id, course_id, teacher_id, title, class_date, duration, room FROM removed
+		ON CONFLICT (class_id) DO NOTHING
+	`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// listRemovedClasses lists classes removed from the schedule that the user
+// would have seen, as cancelled events. Only those dated in the last 30
+// days or later are listed; older ones no longer matter to calendars.
+func listRemovedClasses(db queryerRows, userType string, userID interface{}) ([]models.Event, error) {
+	query := `
+		SELECT rc.class_id, COALESCE(rc.title, ''), rc.class_date, COALESCE(rc.duration, 0), COALESCE(rc.room, ''),
+		       COALESCE(co.name, ''), COALESCE(t.first_name, ''), COALESCE(t.last_name, ''), rc.removed_at
+		FROM removed_classes rc
+		LEFT JOIN courses co ON rc.course_id = co.id
+		LEFT JOIN teachers t ON rc.teacher_id = t.id
+		WHERE rc.class_date >= CURRENT_TIMESTAMP - INTERVAL '30 days'`
+	var args []interface{}
+	switch userType {
+	case "student":
+		query += ` AND EXISTS (SELECT 1 FROM enrollments e WHERE e.course_id = rc.course_id AND e.student_id = $1 AND e.status = 'active')`
+		args = append(args, userID)
+	case "teacher":
+		query += ` AND rc.teacher_id = $1`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY rc.class_date ASC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		event := models.Event{Type: "class", Cancelled: true}
+		if err := rows.Scan(&event.ID, &event.Title, &event.Date, &event.Duration, &event.Room,
+			&event.CourseName, &event.TeacherFirstName, &event.TeacherLastName, &event.UpdatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// listEvents unions classes and scheduled exams for a student's active
+// enrollments, a teacher's classes and courses, or everyone when userType is
+// empty. It backs both the JSON calendar and the iCalendar feeds.
+func listEvents(db queryerRows, userType string, userID interface{}) ([]models.Event, error) {
 	var query string
 	var args []interface{}
 
@@ -223,21 +405,23 @@ func (h *ClassHandler) GetAllEvents(c *gin.Context) {
 		query = `
 			SELECT 'class' as type, c.id, c.title, c.class_date, c.duration, c.room,
 			       co.name as course_name,
-			       t.first_name as teacher_first_name, t.last_name as teacher_last_name
+			       t.first_name as teacher_first_name, t.last_name as teacher_last_name,
+			       c.cancelled_at IS NOT NULL as cancelled, c.updated_at
 			FROM classes c
 			INNER JOIN courses co ON c.course_id = co.id
 			INNER JOIN enrollments e ON e.course_id = co.id
 			LEFT JOIN teachers t ON c.teacher_id = t.id
-			WHERE e.student_id = $1
+			WHERE e.student_id = $1 AND e.status = 'active'
 			UNION ALL
 			SELECT 'exam' as type, e.id, e.title, e.start_date as class_date, 
-			       e.duration as duration, '' as room,
+			       e.duration as duration, COALESCE(e.room, '') as room,
 			       co.name as course_name,
-			       '' as teacher_first_name, '' as teacher_last_name
+			       '' as teacher_first_name, '' as teacher_last_name,
+			       FALSE as cancelled, e.updated_at
 			FROM exams e
 			INNER JOIN courses co ON e.course_id = co.id
 			INNER JOIN enrollments en ON en.course_id = co.id
-			WHERE en.student_id = $1
+			WHERE en.student_id = $1 AND en.status = 'active' AND e.start_date IS NOT NULL
 			ORDER BY class_date ASC
 		`
 		args = []interface{}{userID}
@@ -245,19 +429,21 @@ func (h *ClassHandler) GetAllEvents(c *gin.Context) {
 		query = `
 			SELECT 'class' as type, c.id, c.title, c.class_date, c.duration, c.room,
 			       co.name as course_name,
-			       t.first_name as teacher_first_name, t.last_name as teacher_last_name
+			       t.first_name as teacher_first_name, t.last_name as teacher_last_name,
+			       c.cancelled_at IS NOT NULL as cancelled, c.updated_at
 			FROM classes c
 			INNER JOIN courses co ON c.course_id = co.id
 			LEFT JOIN teachers t ON c.teacher_id = t.id
 			WHERE c.teacher_id = $1
 			UNION ALL
 			SELECT 'exam' as type, e.id, e.title, e.start_date as class_date, 
-			       e.duration as duration, '' as room,
+			       e.duration as duration, COALESCE(e.room, '') as room,
 			       co.name as course_name,
-			       '' as teacher_first_name, '' as teacher_last_name
+			       '' as teacher_first_name, '' as teacher_last_name,
+			       FALSE as cancelled, e.updated_at
 			FROM exams e
 			INNER JOIN courses co ON e.course_id = co.id
-			WHERE co.teacher_id = $1
+			WHERE co.teacher_id = $1 AND e.start_date IS NOT NULL
 			ORDER BY class_date ASC
 		`
 		args = []interface{}{userID}
@@ -265,25 +451,27 @@ func (h *ClassHandler) GetAllEvents(c *gin.Context) {
 		query = `
 			SELECT 'class' as type, c.id, c.title, c.class_date, c.duration, c.room,
 			       co.name as course_name,
-			       t.first_name as teacher_first_name, t.last_name as teacher_last_name
+			       t.first_name as teacher_first_name, t.last_name as teacher_last_name,
+			       c.cancelled_at IS NOT NULL as cancelled, c.updated_at
 			FROM classes c
 			LEFT JOIN courses co ON c.course_id = co.id
 			LEFT JOIN teachers t ON c.teacher_id = t.id
 			UNION ALL
 			SELECT 'exam' as type, e.id, e.title, e.start_date as class_date, 
-			       e.duration as duration, '' as room,
+			       e.duration as duration, COALESCE(e.room, '') as room,
 			       co.name as course_name,
-			       '' as teacher_first_name, '' as teacher_last_name
+			       '' as teacher_first_name, '' as teacher_last_name,
+			       FALSE as cancelled, e.updated_at
 			FROM exams e
 			LEFT JOIN courses co ON e.course_id = co.id
+			WHERE e.start_date IS NOT NULL
 			ORDER BY class_date ASC
 		`
 	}
 
-	rows, err := h.DB.Query(query, args...)
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -292,12 +480,85 @@ func (h *ClassHandler) GetAllEvents(c *gin.Context) {
 		var event models.Event
 		if err := rows.Scan(&event.Type, &event.ID, &event.Title, &event.Date, 
 			&event.Duration, &event.Room, &event.CourseName, &event.TeacherFirstName, 
-			&event.TeacherLastName); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			&event.TeacherLastName, &event.Cancelled, &event.UpdatedAt); err != nil {
+			return nil, err
 		}
 		events = append(events, event)
 	}
 
-	c.JSON(http.StatusOK, events)
+	return events, rows.Err()
+}
+
+// CancelClass keeps the class on the schedule but marks it cancelled, so
+// subscribed calendars show the cancellation instead of silently dropping it.
+func (h *ClassHandler) CancelClass(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.DB.Exec(`
+		UPDATE classes SET cancelled_at = COALESCE(cancelled_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Class cancelled successfully"})
+}
+
+// RestoreClass brings a cancelled class back. Its slot may have been
+// booked since, so it is checked for conflicts like any other booking
+// unless the caller passes force=true.
+func (h *ClassHandler) RestoreClass(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	slot := scheduleSlot{IgnoreClassID: id}
+	var teacherID sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT teacher_id, COALESCE(room, ''), class_date, COALESCE(duration, 0)
+		FROM classes WHERE id = $1 FOR UPDATE
+	`, id).Scan(&teacherID, &slot.Room, &slot.Start, &slot.Duration)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	slot.TeacherID = int(teacherID.Int64)
+
+	if !checkSchedule(c, tx, slot, nil) {
+		return
+	}
+	if _, err := tx.Exec(`
+		UPDATE classes SET cancelled_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Class restored successfully"})
 }
@@ -0,0 +1,672 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"uedu-api/internal/models"
+	"uedu-api/internal/recurrence"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ClassSeriesHandler struct {
+	DB *sql.DB
+}
+
+func NewClassSeriesHandler(db *sql.DB) *ClassSeriesHandler {
+	return &ClassSeriesHandler{DB: db}
+}
+
+type SplitSeriesRequest struct {
+	// FromDate is the original date (YYYY-MM-DD) of the first occurrence the
+	// edit applies to. Earlier occurrences stay on the existing series.
+	FromDate string             `json:"from_date" binding:"required"`
+	Series   models.ClassSeries `json:"series" binding:"required"`
+}
+
+type SeriesExceptionRequest struct {
+	Date string `json:"date" binding:"required"` // YYYY-MM-DD
+}
+
+type SeriesOccurrence struct {
+	OccurrenceDate string    `json:"occurrence_date"`
+	StartsAt       time.Time `json:"starts_at"`
+	EndsAt         time.Time `json:"ends_at"`
+	Excluded       bool      `json:"excluded"`
+}
+
+const seriesColumns = `id, course_id, teacher_id, title, COALESCE(description, ''), starts_at, duration,
+	COALESCE(room, ''), room_id, rrule, COALESCE(exception_dates, '[]'::jsonb), created_at, updated_at`
+
+func scanSeries(row interface{ Scan(...interface{}) error }, s *models.ClassSeries) error {
+	var exceptions []byte
+	var roomID sql.NullInt64
+	if err := row.Scan(&s.ID, &s.CourseID, &s.TeacherID, &s.Title, &s.Description, &s.StartsAt,
+		&s.Duration, &s.Room, &roomID, &s.RRule, &exceptions, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return err
+	}
+	s.RoomID = nullableInt(roomID)
+	s.ExceptionDates = []string{}
+	return json.Unmarshal(exceptions, &s.ExceptionDates)
+}
+
+// validateSeries normalises the series in place and returns its parsed rule.
+func validateSeries(s *models.ClassSeries) (recurrence.Rule, error) {
+	rule, err := recurrence.Parse(s.RRule)
+	if err != nil {
+		return rule, err
+	}
+	s.RRule = rule.String()
+
+	if s.Duration <= 0 {
+		s.Duration = 60
+	}
+	if s.ExceptionDates == nil {
+		s.ExceptionDates = []string{}
+	}
+	for _, d := range s.ExceptionDates {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return rule, fmt.Errorf("exception date %q must be YYYY-MM-DD", d)
+		}
+	}
+	return rule, nil
+}
+
+func expandSeries(s models.ClassSeries, rule recurrence.Rule) []SeriesOccurrence {
+	excluded := make(map[string]bool, len(s.ExceptionDates))
+	for _, d := range s.ExceptionDates {
+		excluded[d] = true
+	}
+
+	var out []SeriesOccurrence
+	for _, t := range recurrence.Expand(s.StartsAt, rule) {
+		key := recurrence.DateKey(t)
+		out = append(out, SeriesOccurrence{
+			OccurrenceDate: key,
+			StartsAt:       t,
+			EndsAt:         t.Add(time.Duration(s.Duration) * time.Minute),
+			Excluded:       excluded[key],
+		})
+	}
+	return out
+}
+
+// upcomingOccurrences returns the occurrences a change taking effect at from
+// (re)creates: those not excluded that start at or after from. Regeneration
+// deletes classes with the same cutoff, so an occurrence that started
+// earlier the same day is neither deleted nor recreated.
+func upcomingOccurrences(s models.ClassSeries, rule recurrence.Rule, from time.Time) []SeriesOccurrence {
+	var out []SeriesOccurrence
+	for _, occ := range expandSeries(s, rule) {
+		if !occ.Excluded && !occ.StartsAt.Before(from) {
+			out = append(out, occ)
+		}
+	}
+	return out
+}
+
+// seriesConflicts checks every occurrence from from onwards against the
+// existing schedule. ignoreSeriesID skips the classes of the series being
+// edited.
+func seriesConflicts(db queryerRows, s models.ClassSeries, rule recurrence.Rule, from time.Time, ignoreSeriesID int) ([]models.ScheduleConflict, error) {
+	conflicts := []models.ScheduleConflict{}
+	for _, occ := range upcomingOccurrences(s, rule, from) {
+		found, err := findConflicts(db, scheduleSlot{
+			TeacherID:      s.TeacherID,
+			Room:           s.Room,
+			Start:          occ.StartsAt,
+			Duration:       s.Duration,
+			IgnoreSeriesID: ignoreSeriesID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range found {
+			found[i].OccurrenceDate = occ.OccurrenceDate
+		}
+		conflicts = append(conflicts, found...)
+	}
+	return conflicts, nil
+}
+
+// seriesRoomIssues resolves the series' room_id and checks the room holds the
+// course's capacity.
+func seriesRoomIssues(db queryer, s *models.ClassSeries) ([]string, error) {
+	room, err := resolveRoom(db, s.RoomID, &s.Room)
+	if err != nil {
+		return nil, err
+	}
+	seats, err := courseSeats(db, s.CourseID)
+	if err != nil {
+		return nil, err
+	}
+	return roomFitIssues(room, seats, nil), nil
+}
+
+// checkSeriesSchedule is checkSchedule for every occurrence of a series from
+// from onwards. The series must be saved in tx. It writes the response and
+// returns false when the request should stop.
+func checkSeriesSchedule(c *gin.Context, tx *sql.Tx, s *models.ClassSeries, rule recurrence.Rule, from time.Time, ignoreSeriesID int) bool {
+	roomIssues, err := seriesRoomIssues(tx, s)
+	if err == errRoomNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if forceSchedule(c) {
+		return true
+	}
+
+	if err := lockSchedule(tx, scheduleSlot{TeacherID: s.TeacherID, Room: s.Room}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	conflicts, err := seriesConflicts(tx, *s, rule, from, ignoreSeriesID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if len(conflicts) > 0 || len(roomIssues) > 0 {
+		respondConflicts(c, conflicts, roomIssues)
+		return false
+	}
+	return true
+}
+
+func getSeries(db queryer, id interface{}) (models.ClassSeries, error) {
+	var s models.ClassSeries
+	err := scanSeries(db.QueryRow(`SELECT `+seriesColumns+` FROM class_series WHERE id = $1`, id), &s)
+	return s, err
+}
+
+// keptClass matches classes a series edit must not delete: those edited
+// individually (is_override) and those with attendance recorded.
+const keptClass = `(COALESCE(is_override, FALSE) OR EXISTS (SELECT 1 FROM attendance a WHERE a.class_id = classes.id))`
+
+// generateOccurrences (re)creates the series' classes rows starting at or
+// after from. Kept classes are left untouched and their dates are not
+// recreated, as are occurrences that started before from.
+func generateOccurrences(tx *sql.Tx, s models.ClassSeries, rule recurrence.Rule, from time.Time) (int, error) {
+	_, err := removeClasses(tx, `series_id = $1 AND NOT `+keptClass+` AND class_date >= $2`, s.ID, from)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, occ := range upcomingOccurrences(s, rule, from) {
+		result, err := tx.Exec(`
+			INSERT INTO classes (course_id, teacher_id, title, description, class_date, duration, room, room_id,
+			                     series_id, occurrence_date, is_override)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, FALSE)
+			ON CONFLICT (series_id, occurrence_date) DO NOTHING
+		`, s.CourseID, s.TeacherID, s.Title, s.Description, occ.StartsAt, s.Duration, s.Room, s.RoomID, s.ID,
+			occ.OccurrenceDate)
+		if err != nil {
+			return created, err
+		}
+		n, _ := result.RowsAffected()
+		created += int(n)
+	}
+	return created, nil
+}
+
+func insertSeries(tx *sql.Tx, s *models.ClassSeries) error {
+	exceptions, err := json.Marshal(s.ExceptionDates)
+	if err != nil {
+		return err
+	}
+	return tx.QueryRow(`
+		INSERT INTO class_series (course_id, teacher_id, title, description, starts_at, duration, room, room_id, rrule, exception_dates)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at
+	`, s.CourseID, s.TeacherID, s.Title, s.Description, s.StartsAt, s.Duration, s.Room, s.RoomID, s.RRule,
+		string(exceptions)).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+}
+
+func (h *ClassSeriesHandler) GetSeriesList(c *gin.Context) {
+	rows, err := h.DB.Query(`SELECT ` + seriesColumns + ` FROM class_series ORDER BY starts_at ASC`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var series []models.ClassSeries
+	for rows.Next() {
+		var s models.ClassSeries
+		if err := scanSeries(rows, &s); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		series = append(series, s)
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+func (h *ClassSeriesHandler) GetSeries(c *gin.Context) {
+	s, err := getSeries(h.DB, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class series not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT id, class_date, duration, COALESCE(room, ''), COALESCE(is_override, FALSE)
+		FROM classes WHERE series_id = $1
+		ORDER BY class_date ASC
+	`, s.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var occurrences []models.ClassWithDetails
+	for rows.Next() {
+		class := models.ClassWithDetails{CourseID: s.CourseID, TeacherID: s.TeacherID, Title: s.Title, SeriesID: &s.ID}
+		if err := rows.Scan(&class.ID, &class.ClassDate, &class.Duration, &class.Room, &class.IsOverride); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		occurrences = append(occurrences, class)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"series":      s,
+		"occurrences": occurrences,
+	})
+}
+
+// PreviewSeries expands a series without saving it, so the schedule page can
+// show the resulting dates before the admin commits.
+func (h *ClassSeriesHandler) PreviewSeries(c *gin.Context) {
+	var s models.ClassSeries
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule, err := validateSeries(&s)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	roomIssues, err := seriesRoomIssues(h.DB, &s)
+	if err == errRoomNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	conflicts, err := seriesConflicts(h.DB, s, rule, s.StartsAt, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if roomIssues == nil {
+		roomIssues = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rrule":       s.RRule,
+		"occurrences": expandSeries(s, rule),
+		"conflicts":   conflicts,
+		"room_issues": roomIssues,
+	})
+}
+
+func (h *ClassSeriesHandler) CreateSeries(c *gin.Context) {
+	var s models.ClassSeries
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule, err := validateSeries(&s)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if !checkSeriesSchedule(c, tx, &s, rule, s.StartsAt, 0) {
+		return
+	}
+
+	if err := insertSeries(tx, &s); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := generateOccurrences(tx, s, rule, s.StartsAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"series":              s,
+		"occurrences_created": created,
+	})
+}
+
+// UpdateSeries edits every occurrence of the series. Occurrences that have
+// already started are kept as they are; upcoming ones are regenerated.
+func (h *ClassSeriesHandler) UpdateSeries(c *gin.Context) {
+	id := c.Param("id")
+	var s models.ClassSeries
+	if err := c.ShouldBindJSON(&s); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule, err := validateSeries(&s)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	exceptions, err := json.Marshal(s.ExceptionDates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	from := time.Now().UTC()
+	if s.StartsAt.After(from) {
+		from = s.StartsAt
+	}
+
+	seriesID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if !checkSeriesSchedule(c, tx, &s, rule, from, seriesID) {
+		return
+	}
+
+	err = tx.QueryRow(`
+		UPDATE class_series
+		SET course_id=$1, teacher_id=$2, title=$3, description=$4, starts_at=$5, duration=$6,
+		    room=$7, room_id=$8, rrule=$9, exception_dates=$10, updated_at=CURRENT_TIMESTAMP
+		WHERE id=$11
+		RETURNING id, created_at, updated_at
+	`, s.CourseID, s.TeacherID, s.Title, s.Description, s.StartsAt, s.Duration, s.Room, s.RoomID, s.RRule,
+		string(exceptions), id).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class series not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := generateOccurrences(tx, s, rule, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"series":              s,
+		"occurrences_created": created,
+	})
+}
+
+// SplitSeries applies an edit to one occurrence and all that follow it. The
+// existing series is ended the day before from_date and a new series is
+// started with the edited details, mirroring how calendar clients handle
+// "this and following events".
+func (h *ClassSeriesHandler) SplitSeries(c *gin.Context) {
+	var req SplitSeriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := time.Parse("2006-01-02", req.FromDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from_date must be YYYY-MM-DD"})
+		return
+	}
+	next := req.Series
+	nextRule, err := validateSeries(&next)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if recurrence.DateKey(next.StartsAt) < req.FromDate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "series.starts_at cannot be before from_date"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	old, err := getSeries(tx, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class series not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if recurrence.DateKey(old.StartsAt) >= req.FromDate {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from_date is the first occurrence; update the whole series instead"})
+		return
+	}
+
+	if !checkSeriesSchedule(c, tx, &next, nextRule, next.StartsAt, old.ID) {
+		return
+	}
+
+	oldRule, err := recurrence.Parse(old.RRule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	until := from.Add(-time.Second)
+	oldRule.Until, oldRule.Count = &until, 0
+	old.RRule = oldRule.String()
+
+	_, err = tx.Exec(`UPDATE class_series SET rrule = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, old.RRule, old.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	_, err = removeClasses(tx, `series_id = $1 AND NOT `+keptClass+` AND occurrence_date >= $2::date`, old.ID, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := insertSeries(tx, &next); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Kept classes from from_date on move to the new series, which then
+	// leaves their dates alone.
+	_, err = tx.Exec(`UPDATE classes SET series_id = $1 WHERE series_id = $2 AND occurrence_date >= $3::date`,
+		next.ID, old.ID, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	created, err := generateOccurrences(tx, next, nextRule, next.StartsAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"previous_series":     old,
+		"series":              next,
+		"occurrences_created": created,
+	})
+}
+
+func (h *ClassSeriesHandler) AddException(c *gin.Context) {
+	id := c.Param("id")
+	var req SeriesExceptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := time.Parse("2006-01-02", req.Date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var attended int
+	err = tx.QueryRow(`
+		SELECT id FROM classes
+		WHERE series_id = $1 AND occurrence_date = $2::date
+		  AND EXISTS (SELECT 1 FROM attendance a WHERE a.class_id = classes.id)
+	`, id, req.Date).Scan(&attended)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    fmt.Sprintf("The class on %s has attendance recorded and cannot be skipped", req.Date),
+			"class_id": attended,
+		})
+		return
+	}
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := tx.Exec(`
+		UPDATE class_series
+		SET exception_dates = COALESCE(exception_dates, '[]'::jsonb) || to_jsonb($1::text),
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND NOT COALESCE(exception_dates, '[]'::jsonb) ? $1
+	`, req.Date, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := getSeries(tx, id); err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Class series not found"})
+			return
+		}
+	}
+
+	if _, err := removeClasses(tx, `series_id = $1 AND occurrence_date = $2::date`, id, req.Date); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s, err := getSeries(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+// DeleteSeries deletes a series and its classes. Classes with attendance
+// recorded are kept as standalone classes.
+func (h *ClassSeriesHandler) DeleteSeries(c *gin.Context) {
+	id := c.Param("id")
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	detached, err := tx.Exec(`
+		UPDATE classes SET series_id = NULL
+		WHERE series_id = $1 AND EXISTS (SELECT 1 FROM attendance a WHERE a.class_id = classes.id)
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	kept, _ := detached.RowsAffected()
+	if _, err := removeClasses(tx, `series_id = $1`, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := tx.Exec("DELETE FROM class_series WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Class series not found"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Class series deleted successfully", "classes_kept": kept})
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+	"uedu-api/internal/models"
+	"uedu-api/internal/recurrence"
+)
+
+func TestUpcomingOccurrences(t *testing.T) {
+	// Daily at 09:00 UTC from Monday 2024-03-04 to Friday 2024-03-08.
+	s := models.ClassSeries{
+		StartsAt:       time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC),
+		Duration:       60,
+		RRule:          "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR;COUNT=5",
+		ExceptionDates: []string{"2024-03-07"},
+	}
+	rule, err := recurrence.Parse(s.RRule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		from time.Time
+		want []string
+	}{
+		{"whole series", s.StartsAt, []string{"2024-03-04", "2024-03-05", "2024-03-06", "2024-03-08"}},
+		{"before today's class", time.Date(2024, 3, 6, 8, 0, 0, 0, time.UTC), []string{"2024-03-06", "2024-03-08"}},
+		{"as today's class starts", time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC), []string{"2024-03-06", "2024-03-08"}},
+		// Today's class has started: it is not regenerated, and the delete
+		// (class_date >= from) leaves it alone.
+		{"after today's class started", time.Date(2024, 3, 6, 9, 30, 0, 0, time.UTC), []string{"2024-03-08"}},
+		{"after the series", time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, occ := range upcomingOccurrences(s, rule, tt.from) {
+				if occ.StartsAt.Before(tt.from) {
+					t.Errorf("occurrence %s starts before the cutoff", occ.OccurrenceDate)
+				}
+				got = append(got, occ.OccurrenceDate)
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandSeriesExceptions(t *testing.T) {
+	// Mondays and Wednesdays at 18:00 UTC from Monday 2024-03-04.
+	s := models.ClassSeries{
+		StartsAt: time.Date(2024, 3, 4, 18, 0, 0, 0, time.UTC),
+		Duration: 90,
+	}
+
+	tests := []struct {
+		name       string
+		rrule      string
+		exceptions []string
+		want       []string // dates, with a "-" prefix when excluded
+	}{
+		{"no exceptions", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", nil,
+			[]string{"2024-03-04", "2024-03-06", "2024-03-11", "2024-03-13"}},
+		// COUNT includes excluded dates, as in RFC 5545, so the series does
+		// not grow a replacement occurrence.
+		{"count includes exceptions", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", []string{"2024-03-06"},
+			[]string{"2024-03-04", "-2024-03-06", "2024-03-11", "2024-03-13"}},
+		{"exception on the until date", "FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20240313", []string{"2024-03-13"},
+			[]string{"2024-03-04", "2024-03-06", "2024-03-11", "-2024-03-13"}},
+		{"exception outside the series", "FREQ=WEEKLY;BYDAY=MO;COUNT=2", []string{"2024-03-06"},
+			[]string{"2024-03-04", "2024-03-11"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.RRule, s.ExceptionDates = tt.rrule, tt.exceptions
+			rule, err := recurrence.Parse(s.RRule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, occ := range expandSeries(s, rule) {
+				if d := occ.EndsAt.Sub(occ.StartsAt); d != 90*time.Minute {
+					t.Errorf("occurrence %s lasts %s, want 1h30m", occ.OccurrenceDate, d)
+				}
+				if occ.Excluded {
+					got = append(got, "-"+occ.OccurrenceDate)
+				} else {
+					got = append(got, occ.OccurrenceDate)
+				}
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSeries(t *testing.T) {
+	tests := []struct {
+		name       string
+		series     models.ClassSeries
+		wantRule   string
+		wantLength int
+		wantErr    bool
+	}{
+		{"normalises the rule and defaults the length",
+			models.ClassSeries{RRule: "RRULE:freq=weekly;byday=we,mo;count=4"},
+			"FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", 60, false},
+		{"keeps a set length",
+			models.ClassSeries{RRule: "FREQ=WEEKLY;UNTIL=20240331", Duration: 90, ExceptionDates: []string{"2024-03-13"}},
+			"FREQ=WEEKLY;UNTIL=20240331T235959Z", 90, false},
+		{"unbounded rule", models.ClassSeries{RRule: "FREQ=WEEKLY;BYDAY=MO"}, "", 0, true},
+		{"bad exception date",
+			models.ClassSeries{RRule: "FREQ=WEEKLY;COUNT=4", ExceptionDates: []string{"13/03/2024"}}, "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.series
+			_, err := validateSeries(&s)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("validateSeries succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.RRule != tt.wantRule || s.Duration != tt.wantLength || s.ExceptionDates == nil {
+				t.Errorf("got rule %s, duration %d, exceptions %v", s.RRule, s.Duration, s.ExceptionDates)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scheduleSlot is a proposed booking of a teacher and/or room. The Ignore
+// fields exclude the record being edited from its own conflict check.
+type scheduleSlot struct {
+	TeacherID      int // 0 skips the teacher check
+	Room           string
+	Start          time.Time
+	Duration       int // minutes
+	IgnoreClassID  int
+	IgnoreSeriesID int
+	IgnoreExamID   int
+}
+
+type ConflictCheckRequest struct {
+	TeacherID int       `json:"teacher_id"`
+	Room      string    `json:"room"`
+	RoomID    *int      `json:"room_id"`
+	CourseID  int       `json:"course_id"` // checks the room holds the course's capacity
+	Equipment []string  `json:"equipment"` // equipment tags the booking needs
+	StartsAt  time.Time `json:"starts_at" binding:"required"`
+	Duration  int       `json:"duration"`
+	ClassID   int       `json:"class_id"` // class being edited, if any
+	ExamID    int       `json:"exam_id"`  // exam being edited, if any
+}
+
+// defaultDuration mirrors the column default: classes and exams saved
+// without a duration are treated as lasting an hour.
+const defaultDuration = 60
+
+func (s scheduleSlot) end() time.Time {
+	d := s.Duration
+	if d <= 0 {
+		d = defaultDuration
+	}
+	return s.Start.Add(time.Duration(d) * time.Minute)
+}
+
+// findConflicts lists classes that share the slot's teacher or room and exam
+// sittings that share its room, wherever their time windows overlap.
+// Windows that merely touch (one ends as the next starts) do not conflict.
+func findConflicts(db queryerRows, slot scheduleSlot) ([]models.ScheduleConflict, error) {
+	conflicts := []models.ScheduleConflict{}
+	end := slot.end()
+
+	rows, err := db.Query(`
+		SELECT id, title, teacher_id, COALESCE(room, ''), class_date, COALESCE(NULLIF(duration, 0), $7)
+		FROM classes
+		WHERE cancelled_at IS NULL
+		  AND class_date < $1
+		  AND class_date + COALESCE(NULLIF(duration, 0), $7) * INTERVAL '1 minute' > $2
+		  AND ((teacher_id = $3 AND $3 <> 0) OR ($4 <> '' AND LOWER(TRIM(room)) = LOWER(TRIM($4))))
+		  AND id <> $5
+		  AND (series_id IS NULL OR series_id <> $6)
+		ORDER BY class_date ASC
+	`, end, slot.Start, slot.TeacherID, slot.Room, slot.IgnoreClassID, slot.IgnoreSeriesID, defaultDuration)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cl models.ScheduleConflict
+		var teacherID sql.NullInt64
+		var duration int
+		if err := rows.Scan(&cl.EventID, &cl.Title, &teacherID, &cl.Room, &cl.StartsAt, &duration); err != nil {
+			return nil, err
+		}
+		cl.EventType = "class"
+		cl.TeacherID = nullableInt(teacherID)
+		cl.EndsAt = cl.StartsAt.Add(time.Duration(duration) * time.Minute)
+
+		if slot.TeacherID != 0 && teacherID.Valid && int(teacherID.Int64) == slot.TeacherID {
+			teacherConflict := cl
+			teacherConflict.Reason = "teacher"
+			conflicts = append(conflicts, teacherConflict)
+		}
+		if slot.Room != "" && sameRoom(cl.Room, slot.Room) {
+			cl.Reason = "room"
+			conflicts = append(conflicts, cl)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if slot.Room != "" {
+		examRows, err := db.Query(`
+			SELECT id, title, room, start_date, COALESCE(NULLIF(duration, 0), $5)
+			FROM exams
+			WHERE start_date IS NOT NULL AND room IS NOT NULL
+			  AND LOWER(TRIM(room)) = LOWER(TRIM($3))
+			  AND start_date < $1
+			  AND start_date + COALESCE(NULLIF(duration, 0), $5) * INTERVAL '1 minute' > $2
+			  AND id <> $4
+			ORDER BY start_date ASC
+		`, end, slot.Start, slot.Room, slot.IgnoreExamID, defaultDuration)
+		if err != nil {
+			return nil, err
+		}
+		defer examRows.Close()
+
+		for examRows.Next() {
+			cl := models.ScheduleConflict{Reason: "room", EventType: "exam"}
+			var duration int
+			if err := examRows.Scan(&cl.EventID, &cl.Title, &cl.Room, &cl.StartsAt, &duration); err != nil {
+				return nil, err
+			}
+			cl.EndsAt = cl.StartsAt.Add(time.Duration(duration) * time.Minute)
+			conflicts = append(conflicts, cl)
+		}
+		if err := examRows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(conflicts, func(i, j int) bool { return conflicts[i].StartsAt.Before(conflicts[j].StartsAt) })
+	return conflicts, nil
+}
+
+func sameRoom(a, b string) bool {
+	return normalizeRoom(a) == normalizeRoom(b)
+}
+
+func normalizeRoom(room string) string {
+	return strings.ToLower(strings.TrimSpace(room))
+}
+
+// forceSchedule reports whether the caller asked to save despite conflicts.
+func forceSchedule(c *gin.Context) bool {
+	return c.Query("force") == "true"
+}
+
+func respondConflicts(c *gin.Context, conflicts []models.ScheduleConflict, roomIssues []string) {
+	if roomIssues == nil {
+		roomIssues = []string{}
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error":       "Schedule conflict",
+		"conflicts":   conflicts,
+		"room_issues": roomIssues,
+	})
+}
+
+// Advisory lock namespaces for bookings; see lockSchedule.
+const (
+	teacherScheduleLock = 1
+	roomScheduleLock    = 2
+)
+
+// lockSchedule holds the slot's teacher and room until the transaction ends,
+// so two bookings cannot both pass the conflict check before either is
+// saved. The teacher is always locked before the room, so concurrent
+// bookings cannot deadlock. It also waits out any timetable commit, which
+// locks the classes table for the same reason.
+func lockSchedule(tx *sql.Tx, slot scheduleSlot) error {
+	if _, err := tx.Exec(`LOCK TABLE classes IN ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	if slot.TeacherID != 0 {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, $2)`, teacherScheduleLock, slot.TeacherID); err != nil {
+			return err
+		}
+	}
+	if room := normalizeRoom(slot.Room); room != "" {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, roomScheduleLock, room); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSchedule rejects a booking that double-books its teacher or room, or
+// whose room does not fit (see roomFitIssues), unless the caller passes
+// force=true. The booking must be saved in tx, which holds the teacher and
+// room from the check on. It writes the response and returns false when the
+// request should stop.
+func checkSchedule(c *gin.Context, tx *sql.Tx, slot scheduleSlot, roomIssues []string) bool {
+	if forceSchedule(c) {
+		return true
+	}
+
+	if err := lockSchedule(tx, slot); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	conflicts, err := findConflicts(tx, slot)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if len(conflicts) > 0 || len(roomIssues) > 0 {
+		respondConflicts(c, conflicts, roomIssues)
+		return false
+	}
+	return true
+}
+
+// CheckConflicts is a dry run of the checks CreateClass, UpdateClass and the
+// exam endpoints perform, for the schedule page to call before saving.
+func (h *ClassHandler) CheckConflicts(c *gin.Context) {
+	var req ConflictCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, err := resolveRoom(h.DB, req.RoomID, &req.Room)
+	if err == errRoomNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	seats, err := courseSeats(h.DB, req.CourseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	roomIssues := roomFitIssues(room, seats, normalizeEquipment(req.Equipment))
+	if roomIssues == nil {
+		roomIssues = []string{}
+	}
+
+	conflicts, err := findConflicts(h.DB, scheduleSlot{
+		TeacherID:     req.TeacherID,
+		Room:          req.Room,
+		Start:         req.StartsAt,
+		Duration:      req.Duration,
+		IgnoreClassID: req.ClassID,
+		IgnoreExamID:  req.ExamID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"has_conflicts": len(conflicts) > 0 || len(roomIssues) > 0,
+		"conflicts":     conflicts,
+		"room_issues":   roomIssues,
+	})
+}
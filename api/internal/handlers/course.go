@@ -98,18 +98,41 @@ func (h *CourseHandler) UpdateCourse(c *gin.Context) {
 		return
 	}
 
-	_, err := h.DB.Exec(`
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
 		UPDATE courses
 		SET name=$1, description=$2, level=$3, teacher_id=$4, capacity=$5, price=$6,
 		    start_date=$7, end_date=$8, updated_at=CURRENT_TIMESTAMP
 		WHERE id=$9
-	`, course.Name, course.Description, course.Level, course.TeacherID, course.Capacity, course.Price, course.StartDate, course.EndDate, id)
+		RETURNING id
+	`, course.Name, course.Description, course.Level, course.TeacherID, course.Capacity, course.Price, course.StartDate, course.EndDate, id).Scan(&course.ID)
 
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Course not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// A capacity increase frees seats for the waitlist.
+	if _, err := fillFromWaitlist(tx, course.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, course)
 }
 
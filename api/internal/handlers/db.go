@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// These interfaces are satisfied by both *sql.DB and *sql.Tx so shared
+// helpers can run inside or outside a transaction.
+
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type queryerRows interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type queryerExecer interface {
+	queryer
+	execer
+}
+
+type readQueryer interface {
+	queryer
+	queryerRows
+}
+
+type readQueryerExecer interface {
+	readQueryer
+	execer
+}
+
+func nullableInt(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int64)
+	return &v
+}
+
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate
+// under the named unique constraint or index.
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+func nullableFloat(n sql.NullFloat64) *float64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Float64
+}
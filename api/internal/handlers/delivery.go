@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/models"
+	"uedu-api/internal/shuffle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// answerKeyFields are the keys removed from question options before they go
+// to a student. Reading passages and matching tasks store sub-questions as
+// objects inside options, and those objects may carry their own key.
+var answerKeyFields = []string{
+	"correct_answer", "correct_answers", "answer", "correct", "is_correct",
+	"accepted_answers", "explanation", "grading_rubric", "rubric",
+}
+
+// canSeeAnswerKey reports whether the caller may read correct answers and
+// rubrics: staff always, students never.
+func canSeeAnswerKey(c *gin.Context) bool {
+	claims := auth.ClaimsFromContext(c)
+	return claims != nil && (claims.Role == auth.RoleAdmin || claims.Role == auth.RoleTeacher)
+}
+
+// stripAnswerKey removes answer-key fields from a question's options at any
+// depth. Options that are not JSON are returned unchanged.
+func stripAnswerKey(options string) string {
+	var v interface{}
+	if options == "" || json.Unmarshal([]byte(options), &v) != nil {
+		return options
+	}
+	out, err := json.Marshal(stripKeyFields(v))
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+func stripKeyFields(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, k := range answerKeyFields {
+			delete(t, k)
+		}
+		for k, inner := range t {
+			t[k] = stripKeyFields(inner)
+		}
+	case []interface{}:
+		for i, inner := range t {
+			t[i] = stripKeyFields(inner)
+		}
+	}
+	return v
+}
+
+// shuffledOptionTypes are the question types whose options are a list of
+// choices that can be shown in any order.
+var shuffledOptionTypes = map[string]bool{
+	"multiple_choice":       true,
+	"multiple_select":       true,
+	"reading_comprehension": true,
+}
+
+// choiceCount returns the number of options when they are a plain list of
+// choices, and 0 otherwise.
+func choiceCount(options string) int {
+	var choices []string
+	if json.Unmarshal([]byte(options), &choices) != nil {
+		return 0
+	}
+	return len(choices)
+}
+
+// assembleAttempt fixes the questions of a new attempt from its exam
+// version: the exam's own questions followed by the questions drawn from the
+// bank for each blueprint section, shuffled when the exam is randomised. The
+// layout is stored rather than recomputed so review and regrading show
+// exactly what the student saw. Adaptive attempts start with one item and
+// grow as they are answered.
+func assembleAttempt(tx *sql.Tx, attemptID int, v *models.ExamVersion) error {
+	if v.Adaptive != nil {
+		return startAdaptive(tx, attemptID, v)
+	}
+	var seed int64
+	var seedArg interface{}
+	var err error
+	if v.IsRandom || len(v.Blueprint) > 0 {
+		if seed, err = shuffle.NewSeed(); err != nil {
+			return err
+		}
+		seedArg = seed
+	}
+
+	items, err := listAttemptItems(tx, `
+		SELECT question_id, COALESCE(question_type, ''), COALESCE(passage, ''), COALESCE(options::text, ''), points
+		FROM exam_version_questions WHERE version_id = $1 AND NOT drawn
+		ORDER BY order_num ASC, question_id ASC
+	`, v.ID)
+	if err != nil {
+		return err
+	}
+	var totalPoints interface{}
+	if len(v.Blueprint) > 0 {
+		drawn, err := drawBlueprint(tx, v.Blueprint, shuffle.New(seed))
+		if err != nil {
+			return err
+		}
+		if drawn, err = snapshotDrawn(tx, v.ID, drawn); err != nil {
+			return err
+		}
+		items = append(items, drawn...)
+		// The score is out of the points actually drawn.
+		sum := 0
+		for _, it := range items {
+			sum += it.Points
+		}
+		totalPoints = sum
+	}
+
+	order := make([]int, len(items))
+	for i, it := range items {
+		order[i] = it.ID
+	}
+	var optionOrder interface{}
+	if v.IsRandom {
+		shuffled := make([]shuffle.Item, len(items))
+		options := map[int][]int{}
+		for i, it := range items {
+			shuffled[i] = shuffle.Item{ID: it.ID, Group: it.Passage}
+			if n := choiceCount(it.Options); shuffledOptionTypes[it.QuestionType] && n > 1 {
+				options[it.ID] = shuffle.Options(seed, it.ID, n)
+			}
+		}
+		order = shuffle.Order(seed, shuffled)
+		encoded, err := json.Marshal(options)
+		if err != nil {
+			return err
+		}
+		optionOrder = string(encoded)
+	}
+
+	questionOrder, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE exam_results
+		SET shuffle_seed = $1, question_order = $2, option_order = $3, total_points = COALESCE($4, total_points)
+		WHERE id = $5
+	`, seedArg, string(questionOrder), optionOrder, totalPoints, attemptID)
+	return err
+}
+
+// snapshotDrawn adds the drawn bank questions to the version and returns
+// them as the version holds them, in the order drawn. A question already
+// drawn for the version keeps the copy taken then.
+func snapshotDrawn(tx *sql.Tx, versionID int, drawn []attemptItem) ([]attemptItem, error) {
+	ids := make([]int, len(drawn))
+	for i, it := range drawn {
+		ids[i] = it.ID
+	}
+	encoded, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := snapshotQuestions(tx, versionID, true, `$3::jsonb @> to_jsonb(id)`, string(encoded)); err != nil {
+		return nil, err
+	}
+
+	stored, err := listAttemptItems(tx, `
+		SELECT question_id, COALESCE(question_type, ''), COALESCE(passage, ''), COALESCE(options::text, ''), points
+		FROM exam_version_questions WHERE version_id = $1 AND $2::jsonb @> to_jsonb(question_id)
+	`, versionID, string(encoded))
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]attemptItem{}
+	for _, it := range stored {
+		byID[it.ID] = it
+	}
+	out := make([]attemptItem, len(drawn))
+	for i, id := range ids {
+		out[i] = byID[id]
+	}
+	return out, nil
+}
+
+func decodeLayout(r *models.ExamResult, questionOrder, optionOrder []byte) error {
+	if len(questionOrder) > 0 {
+		if err := json.Unmarshal(questionOrder, &r.QuestionOrder); err != nil {
+			return err
+		}
+	}
+	if len(optionOrder) > 0 {
+		if err := json.Unmarshal(optionOrder, &r.OptionOrder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// questionPositions maps question ids to their place in the attempt's
+// recorded order. Questions missing from it sort after the rest.
+func questionPositions(r models.ExamResult) func(questionID int) int {
+	positions := map[int]int{}
+	for i, id := range r.QuestionOrder {
+		positions[id] = i
+	}
+	return func(questionID int) int {
+		if p, ok := positions[questionID]; ok {
+			return p
+		}
+		return len(positions)
+	}
+}
+
+// arrangeOptions shows a question's options in the order recorded for the
+// attempt. Options that no longer match the recorded permutation are left
+// as stored.
+func arrangeOptions(r models.ExamResult, questionID int, options string) string {
+	perm, ok := r.OptionOrder[questionID]
+	if !ok {
+		return options
+	}
+	var choices []string
+	if json.Unmarshal([]byte(options), &choices) != nil || len(choices) != len(perm) {
+		return options
+	}
+	arranged := make([]string, len(perm))
+	for i, j := range perm {
+		if j < 0 || j >= len(choices) {
+			return options
+		}
+		arranged[i] = choices[j]
+	}
+	out, err := json.Marshal(arranged)
+	if err != nil {
+		return options
+	}
+	return string(out)
+}
+
+// arrangeQuestions applies the attempt's recorded question and option order.
+func arrangeQuestions(r models.ExamResult, questions []models.DeliveredQuestion) {
+	position := questionPositions(r)
+	sort.SliceStable(questions, func(i, j int) bool {
+		return position(questions[i].ID) < position(questions[j].ID)
+	})
+	for i := range questions {
+		questions[i].Options = arrangeOptions(r, questions[i].ID, questions[i].Options)
+	}
+}
+
+// attemptQuestionFilter restricts a query over questions q to those on the
+// attempt er: the recorded question order, or for attempts started before
+// orders were recorded, the exam's own questions.
+const attemptQuestionFilter = `CASE WHEN er.question_order IS NULL THEN q.exam_id = er.exam_id
+	ELSE er.question_order @> to_jsonb(q.id) END`
+
+// deliverQuestions returns an attempt's questions as a student sees them: no
+// correct answers or rubrics, and explanations only when withExplanations is
+// set.
+func deliverQuestions(db queryerRows, a *ExamAttempt, withExplanations bool) ([]models.DeliveredQuestion, error) {
+	rows, err := db.Query(`
+		SELECT q.id, q.question_text, COALESCE(q.question_type, ''), COALESCE(q.options::text, ''), q.points,
+		       q.order_num, COALESCE(q.passage, ''), COALESCE(q.audio_url, ''), COALESCE(q.explanation, '')
+		FROM exam_results er
+		JOIN `+attemptQuestions+` ON TRUE
+		WHERE er.id = $1
+		ORDER BY q.order_num ASC, q.id ASC
+	`, a.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	questions := []models.DeliveredQuestion{}
+	for rows.Next() {
+		q := models.DeliveredQuestion{ExamID: a.ExamID}
+		var explanation string
+		if err := rows.Scan(&q.ID, &q.QuestionText, &q.QuestionType, &q.Options, &q.Points,
+			&q.Order, &q.Passage, &q.AudioURL, &explanation); err != nil {
+			return nil, err
+		}
+		q.Options = stripAnswerKey(q.Options)
+		if withExplanations {
+			q.Explanation = explanation
+		}
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+// GetAttemptQuestions delivers the questions of an attempt's exam without the
+// answer key, in the attempt's order. Explanations are included once the
+// result has been released.
+func (h *ExamResultHandler) GetAttemptQuestions(c *gin.Context) {
+	a, err := getAttempt(h.DB, c.Param("id"), false)
+	if err != nil {
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.CanAccessStudent(c, a.StudentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own records"})
+		return
+	}
+
+	questions, err := deliverQuestions(h.DB, a, a.ReleasedAt != nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	arrangeQuestions(a.ExamResult, questions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempt":   a,
+		"questions": questions,
+	})
+}
+
+// ReleaseResult lets the student see the answer key and explanations for one
+// submitted result.
+func (h *ExamResultHandler) ReleaseResult(c *gin.Context) {
+	var releasedAt sql.NullTime
+	err := h.DB.QueryRow(`
+		UPDATE exam_results SET released_at = COALESCE(released_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status <> $2
+		RETURNING released_at
+	`, c.Param("id"), attemptInProgress).Scan(&releasedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No submitted exam result with that id"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "released_at": releasedAt.Time})
+}
+
+// ReleaseExamResults releases every submitted result of an exam. Attempts
+// still in progress are left alone.
+func (h *ExamResultHandler) ReleaseExamResults(c *gin.Context) {
+	result, err := h.DB.Exec(`
+		UPDATE exam_results SET released_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE exam_id = $1 AND status <> $2 AND released_at IS NULL
+	`, c.Param("id"), attemptInProgress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	released, _ := result.RowsAffected()
+	c.JSON(http.StatusOK, gin.H{"released": released})
+}
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	enrollmentActive      = "active"
+	enrollmentWaitlisted  = "waitlisted"
+	enrollmentDropped     = "dropped"
+	enrollmentCompleted   = "completed"
+	enrollmentTransferred = "transferred"
+)
+
+// enrollmentTransitions lists the statuses each status may move to. Moving
+// to active only happens through waitlist promotion, never on request.
+var enrollmentTransitions = map[string][]string{
+	enrollmentActive:     {enrollmentDropped, enrollmentCompleted, enrollmentTransferred},
+	enrollmentWaitlisted: {enrollmentActive, enrollmentDropped},
+}
+
+var (
+	errCourseNotFound     = errors.New("course not found")
+	errAlreadyEnrolled    = errors.New("student is already enrolled or waitlisted in this course")
+	errInvalidTransition  = errors.New("enrollment status change not allowed")
+	errEnrollmentNotFound = errors.New("enrollment not found")
+)
+
+type EnrollmentHandler struct {
+	DB *sql.DB
+}
+
+func NewEnrollmentHandler(db *sql.DB) *EnrollmentHandler {
+	return &EnrollmentHandler{DB: db}
+}
+
+type UpdateEnrollmentStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+}
+
+type TransferEnrollmentRequest struct {
+	CourseID int `json:"course_id" binding:"required"`
+}
+
+// enrollmentSelect numbers waitlisted rows per course by the time they joined
+// the waitlist so every read reports the live queue position.
+const enrollmentSelect = `
+	SELECT e.id, e.student_id, e.course_id, e.status, e.enrolled_at, e.waitlisted_at,
+	       e.transferred_to_course_id, COALESCE(w.position, 0), e.created_at, e.updated_at
+	FROM enrollments e
+	LEFT JOIN (
+		SELECT id, ROW_NUMBER() OVER (PARTITION BY course_id ORDER BY waitlisted_at, id) AS position
+		FROM enrollments WHERE status = 'waitlisted'
+	) w ON w.id = e.id
+`
+
+func scanEnrollment(row interface{ Scan(...interface{}) error }, e *models.Enrollment) error {
+	var waitlistedAt sql.NullTime
+	var transferredTo sql.NullInt64
+	if err := row.Scan(&e.ID, &e.StudentID, &e.CourseID, &e.Status, &e.EnrolledAt, &waitlistedAt,
+		&transferredTo, &e.WaitlistPosition, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return err
+	}
+	e.WaitlistedAt, e.TransferredToCourseID = nil, nil
+	if waitlistedAt.Valid {
+		e.WaitlistedAt = &waitlistedAt.Time
+	}
+	if transferredTo.Valid {
+		id := int(transferredTo.Int64)
+		e.TransferredToCourseID = &id
+	}
+	return nil
+}
+
+func getEnrollment(db queryer, id interface{}) (models.Enrollment, error) {
+	var e models.Enrollment
+	err := scanEnrollment(db.QueryRow(enrollmentSelect+` WHERE e.id = $1`, id), &e)
+	if err == sql.ErrNoRows {
+		return e, errEnrollmentNotFound
+	}
+	return e, err
+}
+
+// lockCourseSeats locks the course row so concurrent enrollments for the same
+// course are serialised, and returns its capacity and active headcount.
+// A capacity of zero or less means the course has no seat limit.
+func lockCourseSeats(tx *sql.Tx, courseID int) (int, int, error) {
+	var capacity, active int
+	err := tx.QueryRow(`SELECT COALESCE(capacity, 0) FROM courses WHERE id = $1 FOR UPDATE`, courseID).Scan(&capacity)
+	if err == sql.ErrNoRows {
+		return 0, 0, errCourseNotFound
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM enrollments WHERE course_id = $1 AND status = $2
+	`, courseID, enrollmentActive).Scan(&active)
+	return capacity, active, err
+}
+
+// enrollStudent takes a seat in the course, or a place at the back of its
+// waitlist when the course is full. A student who previously dropped or
+// transferred out is re-enrolled on the same row.
+func enrollStudent(tx *sql.Tx, studentID, courseID int) (models.Enrollment, error) {
+	capacity, active, err := lockCourseSeats(tx, courseID)
+	if err != nil {
+		return models.Enrollment{}, err
+	}
+
+	var existing string
+	err = tx.QueryRow(`
+		SELECT status FROM enrollments WHERE student_id = $1 AND course_id = $2 FOR UPDATE
+	`, studentID, courseID).Scan(&existing)
+	if err != nil && err != sql.ErrNoRows {
+		return models.Enrollment{}, err
+	}
+	if err == nil && existing != enrollmentDropped && existing != enrollmentTransferred {
+		return models.Enrollment{}, errAlreadyEnrolled
+	}
+
+	status := enrollmentActive
+	if capacity > 0 && active >= capacity {
+		status = enrollmentWaitlisted
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO enrollments (student_id, course_id, status, enrolled_at, waitlisted_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CASE WHEN $3 = 'waitlisted' THEN CURRENT_TIMESTAMP END)
+		ON CONFLICT (student_id, course_id) DO UPDATE
+		SET status = EXCLUDED.status, enrolled_at = EXCLUDED.enrolled_at,
+		    waitlisted_at = EXCLUDED.waitlisted_at, transferred_to_course_id = NULL,
+		    updated_at = CURRENT_TIMESTAMP
+		RETURNING id
+	`, studentID, courseID, status).Scan(&id)
+	if err != nil {
+		return models.Enrollment{}, err
+	}
+
+	return getEnrollment(tx, id)
+}
+
+// fillFromWaitlist promotes waitlisted students, oldest first, into any free
+// seats of the course and returns the promoted enrollments.
+func fillFromWaitlist(tx *sql.Tx, courseID int) ([]models.Enrollment, error) {
+	capacity, active, err := lockCourseSeats(tx, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := "ALL"
+	if capacity > 0 {
+		free := capacity - active
+		if free <= 0 {
+			return nil, nil
+		}
+		limit = strconv.Itoa(free)
+	}
+
+	rows, err := tx.Query(`
+		UPDATE enrollments
+		SET status = $2, enrolled_at = CURRENT_TIMESTAMP, waitlisted_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM enrollments
+			WHERE course_id = $1 AND status = $3
+			ORDER BY waitlisted_at, id
+			LIMIT `+limit+`
+			FOR UPDATE
+		)
+		RETURNING id
+	`, courseID, enrollmentActive, enrollmentWaitlisted)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var promoted []models.Enrollment
+	for _, id := range ids {
+		e, err := getEnrollment(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		promoted = append(promoted, e)
+	}
+	return promoted, nil
+}
+
+// changeEnrollmentStatus applies a lifecycle transition and, when a seat is
+// freed, promotes the next students off the waitlist.
+func changeEnrollmentStatus(tx *sql.Tx, id int, status string, transferredTo *int) (models.Enrollment, []models.Enrollment, error) {
+	var e models.Enrollment
+	var current string
+	var courseID int
+	err := tx.QueryRow(`SELECT status, course_id FROM enrollments WHERE id = $1 FOR UPDATE`, id).Scan(&current, &courseID)
+	if err == sql.ErrNoRows {
+		return e, nil, errEnrollmentNotFound
+	}
+	if err != nil {
+		return e, nil, err
+	}
+
+	allowed := false
+	for _, next := range enrollmentTransitions[current] {
+		if next == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return e, nil, fmt.Errorf("%w: %s -> %s", errInvalidTransition, current, status)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE enrollments
+		SET status = $1, waitlisted_at = NULL, transferred_to_course_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, status, transferredTo, id)
+	if err != nil {
+		return e, nil, err
+	}
+
+	var promoted []models.Enrollment
+	if current == enrollmentActive {
+		if promoted, err = fillFromWaitlist(tx, courseID); err != nil {
+			return e, nil, err
+		}
+	}
+
+	e, err = getEnrollment(tx, id)
+	return e, promoted, err
+}
+
+func enrollmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errCourseNotFound), errors.Is(err, errEnrollmentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errAlreadyEnrolled), errors.Is(err, errInvalidTransition):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *EnrollmentHandler) listEnrollments(c *gin.Context, studentID, courseID, status string) {
+	query := enrollmentSelect + ` WHERE 1=1`
+	args := []interface{}{}
+
+	if studentID != "" {
+		args = append(args, studentID)
+		query += fmt.Sprintf(" AND e.student_id = $%d", len(args))
+	}
+	if courseID != "" {
+		args = append(args, courseID)
+		query += fmt.Sprintf(" AND e.course_id = $%d", len(args))
+	}
+	if status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND e.status = $%d", len(args))
+	}
+	query += " ORDER BY e.course_id, COALESCE(w.position, 0), e.enrolled_at"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var enrollments []models.Enrollment
+	for rows.Next() {
+		var e models.Enrollment
+		if err := scanEnrollment(rows, &e); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		enrollments = append(enrollments, e)
+	}
+
+	c.JSON(http.StatusOK, enrollments)
+}
+
+func (h *EnrollmentHandler) GetEnrollments(c *gin.Context) {
+	h.listEnrollments(c, c.Query("student_id"), c.Query("course_id"), c.Query("status"))
+}
+
+func (h *EnrollmentHandler) GetCourseWaitlist(c *gin.Context) {
+	h.listEnrollments(c, "", c.Param("id"), enrollmentWaitlisted)
+}
+
+func (h *EnrollmentHandler) GetEnrollment(c *gin.Context) {
+	e, err := getEnrollment(h.DB, c.Param("id"))
+	if err != nil {
+		c.JSON(enrollmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.CanAccessStudent(c, e.StudentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own records"})
+		return
+	}
+
+	c.JSON(http.StatusOK, e)
+}
+
+func (h *EnrollmentHandler) CreateEnrollment(c *gin.Context) {
+	var req models.Enrollment
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.CanAccessStudent(c, req.StudentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only enroll yourself"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	e, err := enrollStudent(tx, req.StudentID, req.CourseID)
+	if err != nil {
+		c.JSON(enrollmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, e)
+}
+
+func (h *EnrollmentHandler) DropEnrollment(c *gin.Context) {
+	e, err := getEnrollment(h.DB, c.Param("id"))
+	if err != nil {
+		c.JSON(enrollmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.CanAccessStudent(c, e.StudentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only drop your own enrollments"})
+		return
+	}
+
+	h.applyStatusChange(c, e.ID, enrollmentDropped, nil)
+}
+
+func (h *EnrollmentHandler) UpdateEnrollmentStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid enrollment id"})
+		return
+	}
+
+	var req UpdateEnrollmentStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status != enrollmentDropped && req.Status != enrollmentCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be dropped or completed; use the transfer endpoint to move courses"})
+		return
+	}
+
+	h.applyStatusChange(c, id, req.Status, nil)
+}
+
+func (h *EnrollmentHandler) applyStatusChange(c *gin.Context, id int, status string, transferredTo *int) {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	e, promoted, err := changeEnrollmentStatus(tx, id, status, transferredTo)
+	if err != nil {
+		c.JSON(enrollmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enrollment": e,
+		"promoted":   promoted,
+	})
+}
+
+// TransferEnrollment moves an active student to another course in one
+// transaction. The new enrollment follows the normal capacity rules, so a
+// transfer into a full course lands on that course's waitlist.
+func (h *EnrollmentHandler) TransferEnrollment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid enrollment id"})
+		return
+	}
+
+	var req TransferEnrollmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := getEnrollment(tx, id)
+	if err != nil {
+		c.JSON(enrollmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if current.CourseID == req.CourseID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Student is already in this course"})
+		return
+	}
+
+	old, promoted, err := changeEnrollmentStatus(tx, id, enrollmentTransferred, &req.CourseID)
+	if err != nil {
+		c.JSON(enrollmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	next, err := enrollStudent(tx, current.StudentID, req.CourseID)
+	if err != nil {
+		c.JSON(enrollmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enrollment":          next,
+		"previous_enrollment": old,
+		"promoted":            promoted,
+	})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"strconv"
 	"uedu-api/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -19,7 +20,8 @@ func NewExamHandler(db *sql.DB) *ExamHandler {
 func (h *ExamHandler) GetExams(c *gin.Context) {
 	rows, err := h.DB.Query(`
 		SELECT id, title, description, exam_type, course_id, duration, passing_score, 
-		       total_points, start_date, end_date, is_random, created_at, updated_at 
+		       total_points, start_date, end_date, is_random, COALESCE(room, ''), room_id,
+		       COALESCE(max_attempts, 0), COALESCE(cooldown_minutes, 0), COALESCE(attempt_scoring, 'best'), created_at, updated_at
 		FROM exams ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -31,12 +33,15 @@ func (h *ExamHandler) GetExams(c *gin.Context) {
 	var exams []models.Exam
 	for rows.Next() {
 		var e models.Exam
+		var roomID sql.NullInt64
 		if err := rows.Scan(&e.ID, &e.Title, &e.Description, &e.ExamType, &e.CourseID, &e.Duration, 
-			&e.PassingScore, &e.TotalPoints, &e.StartDate, &e.EndDate, &e.IsRandom, 
+			&e.PassingScore, &e.TotalPoints, &e.StartDate, &e.EndDate, &e.IsRandom, &e.Room, &roomID,
+			&e.MaxAttempts, &e.CooldownMinutes, &e.AttemptScoring,
 			&e.CreatedAt, &e.UpdatedAt); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		e.RoomID = nullableInt(roomID)
 		exams = append(exams, e)
 	}
 
@@ -46,12 +51,15 @@ func (h *ExamHandler) GetExams(c *gin.Context) {
 func (h *ExamHandler) GetExam(c *gin.Context) {
 	id := c.Param("id")
 	var e models.Exam
+	var roomID sql.NullInt64
 	err := h.DB.QueryRow(`
 		SELECT id, title, description, exam_type, course_id, duration, passing_score, 
-		       total_points, start_date, end_date, is_random, created_at, updated_at 
+		       total_points, start_date, end_date, is_random, COALESCE(room, ''), room_id,
+		       COALESCE(max_attempts, 0), COALESCE(cooldown_minutes, 0), COALESCE(attempt_scoring, 'best'), created_at, updated_at
 		FROM exams WHERE id = $1
 	`, id).Scan(&e.ID, &e.Title, &e.Description, &e.ExamType, &e.CourseID, &e.Duration, 
-		&e.PassingScore, &e.TotalPoints, &e.StartDate, &e.EndDate, &e.IsRandom, 
+		&e.PassingScore, &e.TotalPoints, &e.StartDate, &e.EndDate, &e.IsRandom, &e.Room, &roomID,
+		&e.MaxAttempts, &e.CooldownMinutes, &e.AttemptScoring,
 		&e.CreatedAt, &e.UpdatedAt)
 
 	if err == sql.ErrNoRows {
@@ -62,6 +70,7 @@ func (h *ExamHandler) GetExam(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	e.RoomID = nullableInt(roomID)
 
 	c.JSON(http.StatusOK, e)
 }
@@ -69,13 +78,16 @@ func (h *ExamHandler) GetExam(c *gin.Context) {
 func (h *ExamHandler) GetExamWithQuestions(c *gin.Context) {
 	id := c.Param("id")
 	var e models.Exam
+	var roomID sql.NullInt64
 	
 	err := h.DB.QueryRow(`
 		SELECT id, title, description, exam_type, course_id, duration, passing_score, 
-		       total_points, start_date, end_date, is_random, created_at, updated_at 
+		       total_points, start_date, end_date, is_random, COALESCE(room, ''), room_id,
+		       COALESCE(max_attempts, 0), COALESCE(cooldown_minutes, 0), COALESCE(attempt_scoring, 'best'), created_at, updated_at
 		FROM exams WHERE id = $1
 	`, id).Scan(&e.ID, &e.Title, &e.Description, &e.ExamType, &e.CourseID, &e.Duration, 
-		&e.PassingScore, &e.TotalPoints, &e.StartDate, &e.EndDate, &e.IsRandom, 
+		&e.PassingScore, &e.TotalPoints, &e.StartDate, &e.EndDate, &e.IsRandom, &e.Room, &roomID,
+		&e.MaxAttempts, &e.CooldownMinutes, &e.AttemptScoring,
 		&e.CreatedAt, &e.UpdatedAt)
 
 	if err == sql.ErrNoRows {
@@ -86,29 +98,15 @@ func (h *ExamHandler) GetExamWithQuestions(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	e.RoomID = nullableInt(roomID)
 
-	rows, err := h.DB.Query(`
-		SELECT id, exam_id, question_text, question_type, options, correct_answer, points, order_num, 
-		       passage, audio_url, explanation, grading_rubric, created_at, updated_at 
-		FROM questions WHERE exam_id = $1 ORDER BY order_num ASC
+	questions, err := listQuestions(h.DB, `
+		SELECT `+questionColumns+` FROM questions WHERE exam_id = $1 ORDER BY order_num ASC
 	`, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
-
-	var questions []models.Question
-	for rows.Next() {
-		var q models.Question
-		if err := rows.Scan(&q.ID, &q.ExamID, &q.QuestionText, &q.QuestionType, &q.Options, 
-			&q.CorrectAnswer, &q.Points, &q.Order, &q.Passage, &q.AudioURL, &q.Explanation, 
-			&q.GradingRubric, &q.CreatedAt, &q.UpdatedAt); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		questions = append(questions, q)
-	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"exam":      e,
@@ -116,6 +114,45 @@ func (h *ExamHandler) GetExamWithQuestions(c *gin.Context) {
 	})
 }
 
+// checkRoomFree resolves the exam's room_id and rejects a sitting whose room
+// is already taken by a class or another exam, is too small for the course,
+// or lacks the audio equipment listening and speaking questions need, unless
+// the caller passes force=true. The exam must be saved in tx. It writes the
+// response and returns false when the request should stop.
+func (h *ExamHandler) checkRoomFree(c *gin.Context, tx *sql.Tx, e *models.Exam, examID int) bool {
+	room, err := resolveRoom(tx, e.RoomID, &e.Room)
+	if err == errRoomNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if e.Room == "" || e.StartDate.IsZero() {
+		return true
+	}
+
+	seats, err := courseSeats(tx, e.CourseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	equipment, err := examEquipment(tx, examID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	slot := scheduleSlot{
+		Room:         e.Room,
+		Start:        e.StartDate,
+		Duration:     e.Duration,
+		IgnoreExamID: examID,
+	}
+	return checkSchedule(c, tx, slot, roomFitIssues(room, seats, equipment))
+}
+
 func (h *ExamHandler) CreateExam(c *gin.Context) {
 	var e models.Exam
 	if err := c.ShouldBindJSON(&e); err != nil {
@@ -123,16 +160,38 @@ func (h *ExamHandler) CreateExam(c *gin.Context) {
 		return
 	}
 
-	err := h.DB.QueryRow(`
-		INSERT INTO exams (title, description, exam_type, course_id, duration, passing_score, total_points, start_date, end_date, is_random) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) 
+	if err := validateExamPolicy(&e); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if !h.checkRoomFree(c, tx, &e, 0) {
+		return
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO exams (title, description, exam_type, course_id, duration, passing_score, total_points, start_date, end_date, is_random, room, room_id,
+		                   max_attempts, cooldown_minutes, attempt_scoring)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, $13, $14, $15) 
 		RETURNING id, created_at, updated_at
-	`, e.Title, e.Description, e.ExamType, e.CourseID, e.Duration, e.PassingScore, e.TotalPoints, e.StartDate, e.EndDate, e.IsRandom).Scan(&e.ID, &e.CreatedAt, &e.UpdatedAt)
+	`, e.Title, e.Description, e.ExamType, e.CourseID, e.Duration, e.PassingScore, e.TotalPoints, e.StartDate, e.EndDate, e.IsRandom, e.Room, e.RoomID,
+		e.MaxAttempts, e.CooldownMinutes, e.AttemptScoring).Scan(&e.ID, &e.CreatedAt, &e.UpdatedAt)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusCreated, e)
 }
@@ -145,18 +204,48 @@ func (h *ExamHandler) UpdateExam(c *gin.Context) {
 		return
 	}
 
-	_, err := h.DB.Exec(`
+	if err := validateExamPolicy(&e); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	examID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if !h.checkRoomFree(c, tx, &e, examID) {
+		return
+	}
+
+	_, err = tx.Exec(`
 		UPDATE exams 
 		SET title=$1, description=$2, exam_type=$3, course_id=$4, duration=$5, passing_score=$6, 
-		    total_points=$7, start_date=$8, end_date=$9, is_random=$10, updated_at=CURRENT_TIMESTAMP 
-		WHERE id=$11
+		    total_points=$7, start_date=$8, end_date=$9, is_random=$10, room=NULLIF($11, ''), room_id=$12,
+		    max_attempts=$13, cooldown_minutes=$14, attempt_scoring=$15, updated_at=CURRENT_TIMESTAMP
+		WHERE id=$16
 	`, e.Title, e.Description, e.ExamType, e.CourseID, e.Duration, e.PassingScore, e.TotalPoints, 
-		e.StartDate, e.EndDate, e.IsRandom, id)
+		e.StartDate, e.EndDate, e.IsRandom, e.Room, e.RoomID, e.MaxAttempts, e.CooldownMinutes, e.AttemptScoring, id)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if err := markExamDraft(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, e)
 }
@@ -0,0 +1,708 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/cat"
+	"uedu-api/internal/grading"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	attemptInProgress = "in_progress"
+	attemptPending    = "pending"
+	attemptPassed     = "passed"
+	attemptFailed     = "failed"
+)
+
+// Grading states of a single answer.
+const (
+	answerAuto    = "auto"
+	answerPending = "pending"
+	answerGraded  = "graded"
+)
+
+// submitGrace absorbs network latency: answers and submissions that arrive
+// this soon after the deadline are still accepted. It is an SQL interval.
+const submitGrace = `INTERVAL '30 seconds'`
+
+var (
+	errAttemptNotFound   = errors.New("exam attempt not found")
+	errAttemptClosed     = errors.New("exam attempt has already been submitted")
+	errAttemptExpired    = errors.New("time is up; the attempt was submitted automatically")
+	errNoOpenAttempt     = errors.New("no attempt in progress for this exam; start the exam first")
+	errQuestionNotInExam = errors.New("question is not part of this exam attempt")
+)
+
+// ExamAttempt is an exam_results row seen while the student is sitting the
+// exam. Timing comes from the database clock, never from the client.
+type ExamAttempt struct {
+	models.ExamResult
+	RemainingSeconds *int              `json:"remaining_seconds"`
+	LastSavedAt      *time.Time        `json:"last_saved_at"`
+	Answers          map[int]string    `json:"answers"`
+	Placement        *models.Placement `json:"placement,omitempty"` // on submitting a placement exam that placed the student
+	Adaptive         bool              `json:"adaptive"`            // answered one item at a time through the adaptive endpoints
+	overdue          bool
+}
+
+type StartAttemptRequest struct {
+	StudentID int `json:"student_id" binding:"required"`
+}
+
+type SaveAnswersRequest struct {
+	Answers map[int]string `json:"answers" binding:"required"`
+}
+
+type SubmitAttemptRequest struct {
+	Answers map[int]string `json:"answers"`
+}
+
+const attemptColumns = `
+	er.id, er.exam_id, er.exam_version_id, er.student_id, COALESCE(er.score, 0), er.total_points, er.status,
+	er.started_at, er.completed_at, COALESCE(er.time_taken, 0), er.deadline_at,
+	COALESCE(er.auto_submitted, FALSE), er.released_at, er.shuffle_seed, er.question_order, er.option_order,
+	er.last_saved_at, er.accommodation_id, COALESCE(er.accommodated, FALSE), COALESCE(er.adaptive, FALSE),
+	er.created_at, er.updated_at,
+	CASE WHEN er.deadline_at IS NOT NULL
+	     THEN GREATEST(0, CEIL(EXTRACT(EPOCH FROM er.deadline_at - CURRENT_TIMESTAMP)))::int END,
+	COALESCE(er.deadline_at + ` + submitGrace + ` < CURRENT_TIMESTAMP, FALSE)`
+
+func scanAttempt(row interface{ Scan(...interface{}) error }, a *ExamAttempt) error {
+	var remaining sql.NullInt64
+	var questionOrder, optionOrder []byte
+	if err := row.Scan(&a.ID, &a.ExamID, &a.ExamVersionID, &a.StudentID, &a.Score, &a.TotalPoints, &a.Status,
+		&a.StartedAt, &a.CompletedAt, &a.TimeTaken, &a.DeadlineAt, &a.AutoSubmitted, &a.ReleasedAt,
+		&a.ShuffleSeed, &questionOrder, &optionOrder, &a.LastSavedAt, &a.AccommodationID, &a.Accommodated,
+		&a.Adaptive, &a.CreatedAt, &a.UpdatedAt, &remaining, &a.overdue); err != nil {
+		return err
+	}
+	if err := decodeLayout(&a.ExamResult, questionOrder, optionOrder); err != nil {
+		return err
+	}
+	if a.Status == attemptInProgress {
+		a.RemainingSeconds = nullableInt(remaining)
+	}
+	return nil
+}
+
+// getAttempt loads an attempt with its saved answers. Inside a transaction
+// pass lock to hold the row until commit, so autosaves and submits of the
+// same attempt run one at a time.
+func getAttempt(db readQueryer, id interface{}, lock bool) (*ExamAttempt, error) {
+	query := `SELECT ` + attemptColumns + ` FROM exam_results er WHERE er.id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	var a ExamAttempt
+	if err := scanAttempt(db.QueryRow(query, id), &a); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errAttemptNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT question_id, COALESCE(selected_answer, '') FROM answers WHERE exam_result_id = $1`, a.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	a.Answers = map[int]string{}
+	for rows.Next() {
+		var questionID int
+		var answer string
+		if err := rows.Scan(&questionID, &answer); err != nil {
+			return nil, err
+		}
+		a.Answers[questionID] = answer
+	}
+	return &a, rows.Err()
+}
+
+func openAttemptID(db queryer, examID, studentID int) (int, error) {
+	var id int
+	err := db.QueryRow(`
+		SELECT id FROM exam_results WHERE exam_id = $1 AND student_id = $2 AND status = $3
+	`, examID, studentID, attemptInProgress).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, errNoOpenAttempt
+	}
+	return id, err
+}
+
+// lockAttemptStart holds the student's starts of the exam until the
+// transaction ends, so two concurrent starts cannot both find no open
+// attempt and race to insert one. The key packs both ids into the
+// single-key advisory lock space, clear of the two-key schedule locks.
+func lockAttemptStart(tx *sql.Tx, examID, studentID int) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(($1::bigint << 32) | $2::bigint)`, examID, studentID)
+	return err
+}
+
+// saveAnswers upserts answers onto an open attempt, so a resumed attempt
+// carries on from the last autosave.
+func saveAnswers(tx *sql.Tx, a *ExamAttempt, answers map[int]string) error {
+	for questionID, answer := range answers {
+		result, err := tx.Exec(`
+			INSERT INTO answers (exam_result_id, question_id, selected_answer)
+			SELECT er.id, q.id, $3 FROM exam_results er JOIN `+attemptQuestions+` ON q.id = $2
+			WHERE er.id = $1
+			ON CONFLICT (exam_result_id, question_id)
+			DO UPDATE SET selected_answer = EXCLUDED.selected_answer, updated_at = CURRENT_TIMESTAMP
+		`, a.ID, questionID, answer)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return errQuestionNotInExam
+		}
+		a.Answers[questionID] = answer
+	}
+	if len(answers) == 0 {
+		return nil
+	}
+	return tx.QueryRow(`
+		UPDATE exam_results SET last_saved_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING last_saved_at
+	`, a.ID).Scan(&a.LastSavedAt)
+}
+
+// gradeAnswers auto-grades the answers on a result with the grader for each
+// question type. Answers a teacher has graded keep their grade; writing and
+// speaking answers are left pending for one.
+func gradeAnswers(tx *sql.Tx, resultID int) error {
+	type gradedAnswer struct {
+		id      int
+		outcome grading.Outcome
+	}
+	rows, err := tx.Query(`
+		SELECT a.id, COALESCE(a.selected_answer, ''), COALESCE(q.question_type, ''), q.correct_answer,
+		       COALESCE(q.options::text, ''), q.points
+		FROM answers a
+		JOIN exam_results er ON a.exam_result_id = er.id
+		JOIN `+attemptQuestions+` ON q.id = a.question_id
+		WHERE a.exam_result_id = $1 AND COALESCE(a.grading_status, '') <> $2
+	`, resultID, answerGraded)
+	if err != nil {
+		return err
+	}
+	var graded []gradedAnswer
+	for rows.Next() {
+		var id int
+		var answer string
+		var q grading.Question
+		if err := rows.Scan(&id, &answer, &q.Type, &q.CorrectAnswer, &q.Options, &q.Points); err != nil {
+			rows.Close()
+			return err
+		}
+		graded = append(graded, gradedAnswer{id: id, outcome: grading.Grade(q, answer)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, g := range graded {
+		status := answerAuto
+		if g.outcome.Pending {
+			status = answerPending
+		}
+		if _, err := tx.Exec(`
+			UPDATE answers SET is_correct = $1, points_earned = $2, grading_status = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $4
+		`, g.outcome.Correct, g.outcome.Points, status, g.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scoreResult rescores a submitted result and refreshes the student's
+// analytics profile to match.
+func scoreResult(tx *sql.Tx, r *models.ExamResult) error {
+	if err := rescoreResult(tx, r); err != nil {
+		return err
+	}
+	_, err := refreshStudentAnalytics(tx, r.StudentID)
+	return err
+}
+
+// rescoreResult totals the points on a submitted result and sets its score
+// and status. A result with answers waiting for a teacher stays pending. An
+// adaptive result passes on its ability estimate, not its score, since
+// each student gets items pitched at their own level; it fails if no item
+// was answered. Once graded, a placement exam result places the student.
+// Callers rescoring many results refresh each student's analytics once
+// afterwards.
+func rescoreResult(tx *sql.Tx, r *models.ExamResult) error {
+	var earned, theta, passTheta float64
+	var pending, passingScore, answered int
+	var adaptive bool
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(points_earned), 0), COUNT(*) FILTER (WHERE grading_status = $2)
+		FROM answers WHERE exam_result_id = $1
+	`, r.ID, answerPending).Scan(&earned, &pending)
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRow(`
+		SELECT COALESCE(v.passing_score, e.passing_score), COALESCE(er.adaptive, FALSE), COALESCE(er.theta, 0),
+		       COALESCE((v.adaptive->>'pass_theta')::numeric, 0),
+		       (SELECT COUNT(*) FROM adaptive_items WHERE exam_result_id = er.id AND correct IS NOT NULL)
+		FROM exam_results er
+		JOIN exams e ON er.exam_id = e.id
+		LEFT JOIN exam_versions v ON er.exam_version_id = v.id
+		WHERE er.id = $1
+	`, r.ID).Scan(&passingScore, &adaptive, &theta, &passTheta, &answered); err != nil {
+		return err
+	}
+
+	score := 0.0
+	if r.TotalPoints > 0 {
+		score = math.Round(earned/float64(r.TotalPoints)*10000) / 100
+	}
+	status := attemptFailed
+	switch {
+	case pending > 0:
+		status = attemptPending
+	case adaptive:
+		if answered > 0 && theta >= passTheta {
+			status = attemptPassed
+		}
+	case score >= float64(passingScore):
+		status = attemptPassed
+	}
+
+	err = tx.QueryRow(`
+		UPDATE exam_results SET score = $1, status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3
+		RETURNING student_id, updated_at
+	`, score, status, r.ID).Scan(&r.StudentID, &r.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	r.Score = score
+	r.Status = status
+	if status != attemptPending {
+		return placeResult(tx, r)
+	}
+	return nil
+}
+
+// finishAttempt grades the saved answers and closes the attempt. An attempt
+// closed by its deadline is stamped at the deadline rather than when the
+// expiry was noticed, so time_taken never exceeds the time allowed; an
+// adaptive one records that time ran out as its stop reason.
+func finishAttempt(tx *sql.Tx, a *ExamAttempt, auto bool) error {
+	if err := gradeAnswers(tx, a.ID); err != nil {
+		return err
+	}
+
+	err := tx.QueryRow(`
+		UPDATE exam_results
+		SET auto_submitted = $1, completed_at = t.completed_at,
+		    time_taken = GREATEST(0, EXTRACT(EPOCH FROM t.completed_at - exam_results.started_at))::int,
+		    adaptive_stop = CASE WHEN $1 AND exam_results.adaptive THEN COALESCE(exam_results.adaptive_stop, $3)
+		                         ELSE exam_results.adaptive_stop END
+		FROM (
+			SELECT CASE WHEN $1 THEN LEAST(CURRENT_TIMESTAMP, deadline_at) ELSE CURRENT_TIMESTAMP END AS completed_at
+			FROM exam_results WHERE id = $2
+		) t
+		WHERE exam_results.id = $2
+		RETURNING exam_results.completed_at, exam_results.time_taken
+	`, auto, a.ID, cat.StopTimeUp).Scan(&a.CompletedAt, &a.TimeTaken)
+	if err != nil {
+		return err
+	}
+
+	a.AutoSubmitted = auto
+	a.RemainingSeconds = nil
+	return scoreResult(tx, &a.ExamResult)
+}
+
+// ExpireAttempts submits every attempt whose deadline and grace period have
+// passed with the answers saved so far. The server runs it periodically so
+// abandoned attempts close even if nobody opens them again. An attempt that
+// fails does not hold up the rest: the error, naming the attempt, is joined
+// into the one returned and the attempt is retried on the next run.
+func ExpireAttempts(db *sql.DB) (int, error) {
+	rows, err := db.Query(`
+		SELECT id FROM exam_results
+		WHERE status = $1 AND deadline_at + `+submitGrace+` < CURRENT_TIMESTAMP
+	`, attemptInProgress)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	var errs []error
+	for _, id := range ids {
+		ok, err := expireAttempt(db, id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("attempt %d: %w", id, err))
+			continue
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, errors.Join(errs...)
+}
+
+// expireAttempt submits one attempt if it is still open and overdue.
+func expireAttempt(db *sql.DB, id int) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	a, err := getAttempt(tx, id, true)
+	if err != nil {
+		return false, err
+	}
+	if a.Status != attemptInProgress || !a.overdue {
+		return false, nil
+	}
+	if err := finishAttempt(tx, a, true); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func attemptErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errAttemptNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errAttemptClosed), errors.Is(err, errAttemptExpired), errors.Is(err, errNoOpenAttempt),
+		errors.Is(err, errBlueprintShort), errors.Is(err, errAdaptivePoolEmpty), errors.Is(err, errAdaptiveAnswers),
+		errors.Is(err, errNotAdaptive), errors.Is(err, errNotCurrentItem), errors.Is(err, errAdaptiveNotOver):
+		return http.StatusConflict
+	case errors.Is(err, errQuestionNotInExam):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// lockAttempt loads the attempt named in the URL for an autosave or submit,
+// checks that the caller may act on it and closes it if its time ran out.
+// It writes the response and returns nil when the request should stop.
+func (h *ExamResultHandler) lockAttempt(c *gin.Context, tx *sql.Tx, id interface{}) *ExamAttempt {
+	a, err := getAttempt(tx, id, true)
+	if err != nil {
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+		return nil
+	}
+	if !auth.CanAccessStudent(c, a.StudentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only take exams for yourself"})
+		return nil
+	}
+	if a.Status != attemptInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": errAttemptClosed.Error(), "code": codeAttemptClosed, "attempt": a})
+		return nil
+	}
+	policy, err := loadExamPolicy(tx, a.ExamID, a.StudentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	// Attempts normally end by the window's close through their deadline;
+	// this catches a window shortened while the attempt was running.
+	if policy.closedForSubmit && !a.overdue {
+		if err := finishAttempt(tx, a, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "The exam closed; the attempt was submitted automatically",
+			"code": codeExamClosed, "attempt": a})
+		return nil
+	}
+	if a.overdue {
+		if err := finishAttempt(tx, a, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": errAttemptExpired.Error(), "code": codeAttemptExpired, "attempt": a})
+		return nil
+	}
+	return a
+}
+
+// StartAttempt opens an attempt with a deadline taken from exams.duration.
+// If the student already has an attempt in progress it is returned instead,
+// which is how the student app resumes after a crash or reload, and how a
+// double-submitted start gets the attempt the first one opened. A new
+// attempt must fall inside the exam's window, attempt limit and cool-down.
+func (h *ExamResultHandler) StartAttempt(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+	var req StartAttemptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.CanAccessStudent(c, req.StudentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only take exams for yourself"})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockAttemptStart(tx, examID, req.StudentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if id, err := openAttemptID(tx, examID, req.StudentID); err == nil {
+		a, err := getAttempt(tx, id, true)
+		if err != nil {
+			c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !a.overdue {
+			c.JSON(http.StatusOK, a)
+			return
+		}
+		if err := finishAttempt(tx, a, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else if err != errNoOpenAttempt {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := loadExamPolicy(tx, examID, req.StudentID)
+	if err == errExamNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if perr := policy.startError(); perr != nil {
+		// An attempt closed above on its deadline still has to be kept.
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusConflict, perr.response())
+		return
+	}
+
+	v, err := currentVersion(tx, examID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The deadline, stretched by any accommodation, never runs past the end
+	// of the window.
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO exam_results (exam_id, exam_version_id, student_id, score, total_points, status, started_at, deadline_at,
+		                          accommodation_id, accommodated, client_ip)
+		VALUES ($1, $2, $3, 0, $4, $5, CURRENT_TIMESTAMP,
+		        LEAST(CASE WHEN $6::int > 0 THEN CURRENT_TIMESTAMP + $6::int * INTERVAL '1 minute' END, $7::timestamp),
+		        $8, $8::int IS NOT NULL, $9)
+		RETURNING id
+	`, examID, v.ID, req.StudentID, v.TotalPoints, attemptInProgress, policy.minutes(v.Duration), policy.ClosesAt,
+		policy.AccommodationID, c.ClientIP()).Scan(&id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := assembleAttempt(tx, id, v); err != nil {
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	a, err := getAttempt(tx, id, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, a)
+}
+
+// GetAttempt returns the attempt with its saved answers and the seconds
+// left on the server clock. An attempt found past its deadline is submitted
+// before it is returned.
+func (h *ExamResultHandler) GetAttempt(c *gin.Context) {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	a, err := getAttempt(tx, c.Param("id"), true)
+	if err != nil {
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.CanAccessStudent(c, a.StudentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own records"})
+		return
+	}
+	if a.Status == attemptInProgress && a.overdue {
+		if err := finishAttempt(tx, a, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
+
+// SaveAnswers autosaves answers while the attempt is open. Only the answers
+// sent are touched; earlier ones are kept.
+func (h *ExamResultHandler) SaveAnswers(c *gin.Context) {
+	var req SaveAnswersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	a := h.lockAttempt(c, tx, c.Param("id"))
+	if a == nil {
+		return
+	}
+	if a.Adaptive {
+		c.JSON(http.StatusConflict, gin.H{"error": errAdaptiveAnswers.Error()})
+		return
+	}
+	if err := saveAnswers(tx, a, req.Answers); err != nil {
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"saved":             len(req.Answers),
+		"last_saved_at":     a.LastSavedAt,
+		"remaining_seconds": a.RemainingSeconds,
+	})
+}
+
+// SubmitAttempt saves any final answers and grades the attempt. Once the
+// deadline and grace period have passed the request is refused and the
+// attempt is closed with what was autosaved.
+func (h *ExamResultHandler) SubmitAttempt(c *gin.Context) {
+	var req SubmitAttemptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.submitAttempt(c, c.Param("id"), req.Answers)
+}
+
+func (h *ExamResultHandler) submitAttempt(c *gin.Context, id interface{}, answers map[int]string) {
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	a := h.lockAttempt(c, tx, id)
+	if a == nil {
+		return
+	}
+	if a.Adaptive {
+		if len(answers) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": errAdaptiveAnswers.Error()})
+			return
+		}
+		// Only the stopping rule or the deadline ends an adaptive test; an
+		// early submit would grade the student on too few items.
+		reason, stop, err := adaptiveStopReason(tx, a)
+		if err != nil {
+			c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !stop {
+			c.JSON(http.StatusConflict, gin.H{"error": errAdaptiveNotOver.Error()})
+			return
+		}
+		if _, err := tx.Exec(`UPDATE exam_results SET adaptive_stop = $1 WHERE id = $2`, reason, a.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := saveAnswers(tx, a, answers); err != nil {
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err := finishAttempt(tx, a, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	placed, err := loadPlacement(tx, a.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	a.Placement = placed
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Which attempt counts toward a student's grade on an exam.
+const (
+	scoreBest    = "best"
+	scoreLatest  = "latest"
+	scoreAverage = "average"
+)
+
+var attemptScorings = []string{scoreBest, scoreLatest, scoreAverage}
+
+// Codes sent with refusals under an exam's policy, so the student app can
+// show its own message for each.
+const (
+	codeExamNotOpen    = "exam_not_open"
+	codeExamClosed     = "exam_closed"
+	codeAttemptLimit   = "attempt_limit_reached"
+	codeCooldown       = "cooldown_active"
+	codeAttemptClosed  = "attempt_closed"
+	codeAttemptExpired = "attempt_expired"
+)
+
+// policyError refuses an attempt under the exam's policy. RetryAt is when
+// the student may try again, if that is known.
+type policyError struct {
+	Code    string
+	Message string
+	RetryAt *time.Time
+}
+
+func (e *policyError) Error() string {
+	return e.Message
+}
+
+func (e *policyError) response() gin.H {
+	body := gin.H{"error": e.Message, "code": e.Code}
+	if e.RetryAt != nil {
+		body["retry_at"] = e.RetryAt
+	}
+	return body
+}
+
+func validateExamPolicy(e *models.Exam) error {
+	e.AttemptScoring = strings.ToLower(strings.TrimSpace(e.AttemptScoring))
+	if e.AttemptScoring == "" {
+		e.AttemptScoring = scoreBest
+	}
+	switch {
+	case e.MaxAttempts < 0:
+		return errors.New("max_attempts cannot be negative")
+	case e.CooldownMinutes < 0:
+		return errors.New("cooldown_minutes cannot be negative")
+	}
+	for _, s := range attemptScorings {
+		if s == e.AttemptScoring {
+			return nil
+		}
+	}
+	return fmt.Errorf("attempt_scoring must be one of %s", strings.Join(attemptScorings, ", "))
+}
+
+// examDate reads an optional exam date. Exams saved without a date hold Go's
+// zero time, so anything before 1900 counts as unset.
+func examDate(column string) string {
+	return fmt.Sprintf("CASE WHEN %s >= DATE '1900-01-01' THEN %s END", column, column)
+}
+
+// examPolicy is an exam's policy as it applies to one student right now,
+// including any accommodation they have. The comparisons are made on the
+// database clock.
+type examPolicy struct {
+	OpensAt         *time.Time
+	ClosesAt        *time.Time
+	MaxAttempts     int
+	Scoring         string
+	Attempts        int        // attempts started, including one in progress
+	NextAttemptAt   *time.Time // end of the cool-down, while it runs
+	AccommodationID *int
+	TimeMultiplier  float64
+	ExtraMinutes    int
+
+	notOpen         bool
+	closed          bool
+	closedForSubmit bool // closed longer ago than the submission grace
+}
+
+// accommodationFor is a lateral subquery, aliased ac, over the accommodation
+// that applies to student $2 on exam e: one for the exam itself, else one
+// for the exam's course, else one for all of the student's exams. It yields
+// no row when the student has none.
+const accommodationFor = `LATERAL (
+	SELECT ac.id, ac.time_multiplier, ac.extra_minutes, ac.opens_at, ac.closes_at
+	FROM exam_accommodations ac
+	LEFT JOIN enrollments en ON en.id = ac.enrollment_id
+	WHERE ac.student_id = $2
+	  AND (ac.exam_id IS NULL OR ac.exam_id = e.id)
+	  AND (ac.enrollment_id IS NULL OR en.course_id = e.course_id)
+	ORDER BY ac.exam_id IS NOT NULL DESC, ac.enrollment_id IS NOT NULL DESC, ac.id DESC
+	LIMIT 1
+) ac`
+
+func loadExamPolicy(db queryer, examID, studentID int) (*examPolicy, error) {
+	var p examPolicy
+	var accommodationID sql.NullInt64
+	err := db.QueryRow(`
+		SELECT w.opens_at, w.closes_at, COALESCE(e.max_attempts, 0), COALESCE(e.attempt_scoring, 'best'),
+		       a.attempts, a.next_attempt_at, ac.id, COALESCE(ac.time_multiplier, 1), COALESCE(ac.extra_minutes, 0),
+		       COALESCE(CURRENT_TIMESTAMP < w.opens_at, FALSE),
+		       COALESCE(CURRENT_TIMESTAMP >= w.closes_at, FALSE),
+		       COALESCE(w.closes_at + `+submitGrace+` < CURRENT_TIMESTAMP, FALSE)
+		FROM exams e
+		LEFT JOIN `+accommodationFor+` ON TRUE
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(ac.opens_at, `+examDate("e.start_date")+`) AS opens_at,
+			       COALESCE(ac.closes_at, `+examDate("e.end_date")+`) AS closes_at
+		) w
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS attempts,
+			       CASE WHEN MAX(completed_at) + COALESCE(e.cooldown_minutes, 0) * INTERVAL '1 minute' > CURRENT_TIMESTAMP
+			            THEN MAX(completed_at) + COALESCE(e.cooldown_minutes, 0) * INTERVAL '1 minute' END AS next_attempt_at
+			FROM exam_results WHERE exam_id = e.id AND student_id = $2
+		) a
+		WHERE e.id = $1
+	`, examID, studentID).Scan(&p.OpensAt, &p.ClosesAt, &p.MaxAttempts, &p.Scoring, &p.Attempts,
+		&p.NextAttemptAt, &accommodationID, &p.TimeMultiplier, &p.ExtraMinutes,
+		&p.notOpen, &p.closed, &p.closedForSubmit)
+	if err == sql.ErrNoRows {
+		return nil, errExamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.AccommodationID = nullableInt(accommodationID)
+	return &p, nil
+}
+
+// minutes is the time the student gets for an exam of the given duration:
+// the duration scaled by the accommodation's multiplier, rounded up, plus its
+// extra minutes. Untimed exams stay untimed.
+func (p *examPolicy) minutes(duration int) int {
+	if duration <= 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(duration)*p.TimeMultiplier-1e-9)) + p.ExtraMinutes
+}
+
+// startError says why the student may not start a new attempt now, or
+// returns nil.
+func (p *examPolicy) startError() *policyError {
+	switch {
+	case p.notOpen:
+		return &policyError{Code: codeExamNotOpen, Message: "The exam is not open yet", RetryAt: p.OpensAt}
+	case p.closed:
+		return &policyError{Code: codeExamClosed, Message: "The exam is closed"}
+	case p.MaxAttempts > 0 && p.Attempts >= p.MaxAttempts:
+		return &policyError{Code: codeAttemptLimit,
+			Message: fmt.Sprintf("All %d attempts at this exam have been used", p.MaxAttempts)}
+	case p.NextAttemptAt != nil:
+		return &policyError{Code: codeCooldown,
+			Message: "The next attempt can start when the cool-down ends", RetryAt: p.NextAttemptAt}
+	}
+	return nil
+}
+
+// examStanding works out the student's grade on the exam under its
+// attempt_scoring: the best or latest graded attempt, or the average of all
+// of them.
+func examStanding(db readQueryer, examID, studentID int) (*models.ExamStanding, error) {
+	p, err := loadExamPolicy(db, examID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	var passingScore, duration int
+	err = db.QueryRow(`SELECT COALESCE(passing_score, 0), COALESCE(duration, 0) FROM exams WHERE id = $1`, examID).
+		Scan(&passingScore, &duration)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &models.ExamStanding{
+		ExamID:          examID,
+		StudentID:       studentID,
+		AttemptScoring:  p.Scoring,
+		Attempts:        p.Attempts,
+		MaxAttempts:     p.MaxAttempts,
+		OpensAt:         p.OpensAt,
+		ClosesAt:        p.ClosesAt,
+		NextAttemptAt:   p.NextAttemptAt,
+		CanStart:        true,
+		Status:          "none",
+		CountedResults:  []int{},
+		AccommodationID: p.AccommodationID,
+		DurationMinutes: p.minutes(duration),
+	}
+	if p.MaxAttempts > 0 {
+		left := p.MaxAttempts - p.Attempts
+		if left < 0 {
+			left = 0
+		}
+		st.AttemptsLeft = &left
+	}
+	if perr := p.startError(); perr != nil {
+		st.CanStart = false
+		st.Code = perr.Code
+	}
+
+	rows, err := db.Query(`
+		SELECT id, COALESCE(score, 0), status FROM exam_results
+		WHERE exam_id = $1 AND student_id = $2 AND status <> $3
+		ORDER BY completed_at, id
+	`, examID, studentID, attemptInProgress)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type attempt struct {
+		id     int
+		score  float64
+		status string
+	}
+	var all, graded []attempt
+	for rows.Next() {
+		var a attempt
+		if err := rows.Scan(&a.id, &a.score, &a.status); err != nil {
+			return nil, err
+		}
+		all = append(all, a)
+		if a.status != attemptPending {
+			graded = append(graded, a)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return st, nil
+	}
+
+	count := func(a attempt) {
+		score := a.score
+		st.Score = &score
+		st.Status = a.status
+		st.CountedResults = []int{a.id}
+	}
+	switch p.Scoring {
+	case scoreLatest:
+		count(all[len(all)-1])
+	case scoreAverage:
+		if len(graded) > 0 {
+			sum := 0.0
+			for _, a := range graded {
+				sum += a.score
+				st.CountedResults = append(st.CountedResults, a.id)
+			}
+			avg := math.Round(sum/float64(len(graded))*100) / 100
+			st.Score = &avg
+			st.Status = attemptFailed
+			if avg >= float64(passingScore) {
+				st.Status = attemptPassed
+			}
+		}
+		if len(graded) < len(all) {
+			st.Status = attemptPending
+		}
+	default:
+		if len(graded) == 0 {
+			st.Status = attemptPending
+			break
+		}
+		best := graded[0]
+		for _, a := range graded[1:] {
+			if a.score > best.score {
+				best = a
+			}
+		}
+		count(best)
+	}
+	return st, nil
+}
+
+// GetExamStanding shows a student their attempts at an exam, whether they
+// may start another, and the grade that counts.
+func (h *ExamResultHandler) GetExamStanding(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+	studentID, err := strconv.Atoi(c.Query("student_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "student_id is required"})
+		return
+	}
+
+	st, err := examStanding(h.DB, examID, studentID)
+	if err == errExamNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, st)
+}
@@ -3,7 +3,10 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
+	"uedu-api/internal/auth"
 	"uedu-api/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -21,10 +24,11 @@ type SubmitExamRequest struct {
 	ExamID      int                    `json:"exam_id" binding:"required"`
 	StudentID   int                    `json:"student_id" binding:"required"`
 	Answers     map[int]string         `json:"answers" binding:"required"`
-	StartedAt   string                 `json:"started_at"`
-	CompletedAt string                 `json:"completed_at"`
 }
 
+// SubmitExam submits the student's open attempt at the exam. It predates the
+// attempt endpoints and is kept for older clients; timing always comes from
+// the attempt, never from the request.
 func (h *ExamResultHandler) SubmitExam(c *gin.Context) {
 	var req SubmitExamRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,103 +36,18 @@ func (h *ExamResultHandler) SubmitExam(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.DB.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !auth.CanAccessStudent(c, req.StudentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only submit exams for yourself"})
 		return
 	}
-	defer tx.Rollback()
-
-	var exam models.Exam
-	err = tx.QueryRow(`
-		SELECT id, passing_score, total_points 
-		FROM exams WHERE id = $1
-	`, req.ExamID).Scan(&exam.ID, &exam.PassingScore, &exam.TotalPoints)
 
+	id, err := openAttemptID(h.DB, req.ExamID, req.StudentID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(attemptErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	totalEarnedPoints := 0
-	
-	for questionID, selectedAnswer := range req.Answers {
-		var correctAnswer string
-		var points int
-		
-		err := tx.QueryRow(`
-			SELECT correct_answer, points FROM questions WHERE id = $1 AND exam_id = $2
-		`, questionID, req.ExamID).Scan(&correctAnswer, &points)
-		
-		if err != nil {
-			continue
-		}
-		
-		isCorrect := (selectedAnswer == correctAnswer)
-		if isCorrect {
-			totalEarnedPoints += points
-		}
-	}
-
-	score := float64(totalEarnedPoints) / float64(exam.TotalPoints) * 100
-	status := "failed"
-	if score >= float64(exam.PassingScore) {
-		status = "passed"
-	}
-
-	var examResult models.ExamResult
-	err = tx.QueryRow(`
-		INSERT INTO exam_results (exam_id, student_id, score, total_points, status, started_at, completed_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7) 
-		RETURNING id, created_at, updated_at
-	`, req.ExamID, req.StudentID, score, exam.TotalPoints, status, req.StartedAt, req.CompletedAt).Scan(&examResult.ID, &examResult.CreatedAt, &examResult.UpdatedAt)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	for questionID, selectedAnswer := range req.Answers {
-		var correctAnswer string
-		var points int
-		
-		err := tx.QueryRow(`
-			SELECT correct_answer, points FROM questions WHERE id = $1 AND exam_id = $2
-		`, questionID, req.ExamID).Scan(&correctAnswer, &points)
-		
-		if err != nil {
-			continue
-		}
-		
-		isCorrect := (selectedAnswer == correctAnswer)
-		pointsEarned := 0
-		if isCorrect {
-			pointsEarned = points
-		}
-
-		_, err = tx.Exec(`
-			INSERT INTO answers (exam_result_id, question_id, selected_answer, is_correct, points_earned) 
-			VALUES ($1, $2, $3, $4, $5)
-		`, examResult.ID, questionID, selectedAnswer, isCorrect, pointsEarned)
-		
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	}
-
-	if err = tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	examResult.ExamID = req.ExamID
-	examResult.StudentID = req.StudentID
-	examResult.Score = score
-	examResult.TotalPoints = exam.TotalPoints
-	examResult.Status = status
-
-	c.JSON(http.StatusCreated, examResult)
+	h.submitAttempt(c, id, req.Answers)
 }
 
 func (h *ExamResultHandler) GetExamResults(c *gin.Context) {
@@ -136,8 +55,10 @@ func (h *ExamResultHandler) GetExamResults(c *gin.Context) {
 	examID := c.Query("exam_id")
 
 	query := `
-		SELECT er.id, er.exam_id, er.student_id, er.score, er.total_points, er.status, 
-		       er.started_at, er.completed_at, er.time_taken, er.created_at, er.updated_at,
+		SELECT er.id, er.exam_id, er.exam_version_id, er.student_id, er.score, er.total_points, er.status, 
+		       er.started_at, er.completed_at, COALESCE(er.time_taken, 0), er.deadline_at,
+		       COALESCE(er.auto_submitted, FALSE), er.accommodation_id, COALESCE(er.accommodated, FALSE),
+		       er.created_at, er.updated_at,
 		       s.first_name, s.last_name, e.title as exam_title
 		FROM exam_results er
 		JOIN students s ON er.student_id = s.id
@@ -145,18 +66,20 @@ func (h *ExamResultHandler) GetExamResults(c *gin.Context) {
 		WHERE 1=1
 	`
 	args := []interface{}{}
-	argIndex := 1
 
 	if studentID != "" {
-		query += " AND er.student_id = $" + string(rune(argIndex))
 		args = append(args, studentID)
-		argIndex++
+		query += fmt.Sprintf(" AND er.student_id = $%d", len(args))
 	}
 
 	if examID != "" {
-		query += " AND er.exam_id = $" + string(rune(argIndex))
 		args = append(args, examID)
-		argIndex++
+		query += fmt.Sprintf(" AND er.exam_id = $%d", len(args))
+	}
+
+	if accommodated := c.Query("accommodated"); accommodated != "" {
+		args = append(args, accommodated == "true")
+		query += fmt.Sprintf(" AND COALESCE(er.accommodated, FALSE) = $%d", len(args))
 	}
 
 	query += " ORDER BY er.created_at DESC"
@@ -172,8 +95,9 @@ func (h *ExamResultHandler) GetExamResults(c *gin.Context) {
 	for rows.Next() {
 		var er models.ExamResult
 		var firstName, lastName, examTitle string
-		if err := rows.Scan(&er.ID, &er.ExamID, &er.StudentID, &er.Score, &er.TotalPoints, &er.Status, 
-			&er.StartedAt, &er.CompletedAt, &er.TimeTaken, &er.CreatedAt, &er.UpdatedAt,
+		if err := rows.Scan(&er.ID, &er.ExamID, &er.ExamVersionID, &er.StudentID, &er.Score, &er.TotalPoints, &er.Status, 
+			&er.StartedAt, &er.CompletedAt, &er.TimeTaken, &er.DeadlineAt, &er.AutoSubmitted, &er.AccommodationID,
+			&er.Accommodated, &er.CreatedAt, &er.UpdatedAt,
 			&firstName, &lastName, &examTitle); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -181,6 +105,7 @@ func (h *ExamResultHandler) GetExamResults(c *gin.Context) {
 		results = append(results, map[string]interface{}{
 			"id":         er.ID,
 			"exam_id":    er.ExamID,
+			"exam_version_id": er.ExamVersionID,
 			"exam_title": examTitle,
 			"student_id": er.StudentID,
 			"student_name": firstName + " " + lastName,
@@ -190,6 +115,9 @@ func (h *ExamResultHandler) GetExamResults(c *gin.Context) {
 			"started_at": er.StartedAt,
 			"completed_at": er.CompletedAt,
 			"time_taken": er.TimeTaken,
+			"auto_submitted": er.AutoSubmitted,
+			"accommodation_id": er.AccommodationID,
+			"accommodated": er.Accommodated,
 			"created_at": er.CreatedAt,
 		})
 	}
@@ -201,18 +129,22 @@ func (h *ExamResultHandler) GetExamResultDetails(c *gin.Context) {
 	id := c.Param("id")
 	var er models.ExamResult
 	var studentName, examTitle string
+	var questionOrder, optionOrder []byte
 
 	err := h.DB.QueryRow(`
-		SELECT er.id, er.exam_id, er.student_id, er.score, er.total_points, er.status, 
-		       er.started_at, er.completed_at, er.time_taken, er.created_at, er.updated_at,
+		SELECT er.id, er.exam_id, er.exam_version_id, er.student_id, er.score, er.total_points, er.status, 
+		       er.started_at, er.completed_at, COALESCE(er.time_taken, 0), er.deadline_at,
+		       COALESCE(er.auto_submitted, FALSE), er.released_at, er.shuffle_seed, er.question_order, er.option_order,
+		       er.accommodation_id, COALESCE(er.accommodated, FALSE), er.created_at, er.updated_at,
 		       s.first_name || ' ' || s.last_name as student_name, e.title as exam_title
 		FROM exam_results er
 		JOIN students s ON er.student_id = s.id
 		JOIN exams e ON er.exam_id = e.id
 		WHERE er.id = $1
-	`, id).Scan(&er.ID, &er.ExamID, &er.StudentID, &er.Score, &er.TotalPoints, &er.Status, 
-		&er.StartedAt, &er.CompletedAt, &er.TimeTaken, &er.CreatedAt, &er.UpdatedAt,
-		&studentName, &examTitle)
+	`, id).Scan(&er.ID, &er.ExamID, &er.ExamVersionID, &er.StudentID, &er.Score, &er.TotalPoints, &er.Status, 
+		&er.StartedAt, &er.CompletedAt, &er.TimeTaken, &er.DeadlineAt, &er.AutoSubmitted, &er.ReleasedAt,
+		&er.ShuffleSeed, &questionOrder, &optionOrder, &er.AccommodationID, &er.Accommodated,
+		&er.CreatedAt, &er.UpdatedAt, &studentName, &examTitle)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Exam result not found"})
@@ -223,12 +155,38 @@ func (h *ExamResultHandler) GetExamResultDetails(c *gin.Context) {
 		return
 	}
 
+	if err := decodeLayout(&er, questionOrder, optionOrder); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !auth.CanAccessStudent(c, er.StudentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own records"})
+		return
+	}
+
+	if er.Status == attemptInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "The exam attempt is still in progress"})
+		return
+	}
+
+	// Students see the key and explanations only once the result is
+	// released; until then they get their own answers back and nothing more.
+	showKey := canSeeAnswerKey(c) || er.ReleasedAt != nil
+
 	rows, err := h.DB.Query(`
-		SELECT a.id, a.question_id, a.selected_answer, a.is_correct, a.points_earned, a.created_at,
-		       q.question_text, q.correct_answer, q.points
+		SELECT a.id, a.question_id, COALESCE(a.selected_answer, ''), a.is_correct, a.points_earned,
+		       COALESCE(a.grading_status, 'auto'), a.created_at,
+		       q.question_text, COALESCE(q.options::text, ''), q.correct_answer, COALESCE(q.explanation, ''), q.points,
+		       we.id, COALESCE(we.score, 0), COALESCE(we.max_score, 0), COALESCE(we.feedback, ''),
+		       COALESCE(we.strengths::text, ''), COALESCE(we.improvements::text, ''), COALESCE(we.corrected_text, ''),
+		       COALESCE(we.suggestions, ''), COALESCE(we.criteria_scores::text, ''), we.evaluated_at
 		FROM answers a
-		JOIN questions q ON a.question_id = q.id
+		JOIN exam_results er ON a.exam_result_id = er.id
+		JOIN `+attemptQuestions+` ON q.id = a.question_id
+		LEFT JOIN writing_evaluations we ON we.answer_id = a.id
 		WHERE a.exam_result_id = $1
+		ORDER BY q.order_num, q.id
 	`, id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -239,36 +197,62 @@ func (h *ExamResultHandler) GetExamResultDetails(c *gin.Context) {
 	var answers []map[string]interface{}
 	for rows.Next() {
 		var a models.Answer
-		var questionText, correctAnswer string
+		var questionText, rawOptions, correctAnswer, explanation string
 		var questionPoints int
-		if err := rows.Scan(&a.ID, &a.QuestionID, &a.SelectedAnswer, &a.IsCorrect, &a.PointsEarned, &a.CreatedAt,
-			&questionText, &correctAnswer, &questionPoints); err != nil {
+		var ev models.WritingEvaluation
+		var evaluationID sql.NullInt64
+		var evaluatedAt sql.NullTime
+		if err := rows.Scan(&a.ID, &a.QuestionID, &a.SelectedAnswer, &a.IsCorrect, &a.PointsEarned, &a.GradingStatus, &a.CreatedAt,
+			&questionText, &rawOptions, &correctAnswer, &explanation, &questionPoints,
+			&evaluationID, &ev.Score, &ev.MaxScore, &ev.Feedback, &ev.Strengths, &ev.Improvements,
+			&ev.CorrectedText, &ev.Suggestions, &ev.CriteriaScores, &evaluatedAt); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		
-		var options []string
-		if q.Options != nil {
-			json.Unmarshal([]byte(q.Options), &options)
+
+		rawOptions = arrangeOptions(er, a.QuestionID, rawOptions)
+		if !canSeeAnswerKey(c) {
+			rawOptions = stripAnswerKey(rawOptions)
+		}
+		var options interface{}
+		if rawOptions != "" {
+			json.Unmarshal([]byte(rawOptions), &options)
 		}
 
-		answers = append(answers, map[string]interface{}{
+		answer := map[string]interface{}{
 			"id":              a.ID,
 			"question_id":     a.QuestionID,
 			"question_text":   questionText,
 			"options":         options,
-			"correct_answer":  correctAnswer,
 			"points":          questionPoints,
 			"selected_answer": a.SelectedAnswer,
-			"is_correct":     a.IsCorrect,
-			"points_earned":  a.PointsEarned,
-		})
+			"grading_status":  a.GradingStatus,
+		}
+		if showKey {
+			answer["correct_answer"] = correctAnswer
+			answer["explanation"] = explanation
+			answer["is_correct"] = a.IsCorrect
+			answer["points_earned"] = a.PointsEarned
+			if evaluationID.Valid {
+				ev.ID = int(evaluationID.Int64)
+				ev.AnswerID = a.ID
+				ev.EvaluatedAt = evaluatedAt.Time
+				answer["evaluation"] = ev
+			}
+		}
+		answers = append(answers, answer)
 	}
 
+	position := questionPositions(er)
+	sort.SliceStable(answers, func(i, j int) bool {
+		return position(answers[i]["question_id"].(int)) < position(answers[j]["question_id"].(int))
+	})
+
 	c.JSON(http.StatusOK, gin.H{
 		"exam_result": map[string]interface{}{
 			"id":          er.ID,
 			"exam_id":     er.ExamID,
+			"exam_version_id": er.ExamVersionID,
 			"exam_title":  examTitle,
 			"student_id":  er.StudentID,
 			"student_name": studentName,
@@ -278,6 +262,14 @@ func (h *ExamResultHandler) GetExamResultDetails(c *gin.Context) {
 			"started_at":  er.StartedAt,
 			"completed_at": er.CompletedAt,
 			"time_taken":  er.TimeTaken,
+			"deadline_at": er.DeadlineAt,
+			"auto_submitted": er.AutoSubmitted,
+			"accommodation_id": er.AccommodationID,
+			"accommodated": er.Accommodated,
+			"released_at": er.ReleasedAt,
+			"shuffle_seed": er.ShuffleSeed,
+			"question_order": er.QuestionOrder,
+			"option_order": er.OptionOrder,
 			"created_at":  er.CreatedAt,
 		},
 		"answers": answers,
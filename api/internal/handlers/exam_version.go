@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	versionDraft     = "draft"
+	versionPublished = "published"
+)
+
+var errExamNotFound = errors.New("exam not found")
+
+// versionQuestionFields are the question columns a version snapshots. The
+// snapshot table declares them with the same types as questions so the two
+// can be read through one query.
+const versionQuestionFields = `exam_id, question_text, question_type, options, correct_answer, points,
+	order_num, passage, audio_url, explanation, grading_rubric, skill, cefr_level, topic, difficulty,
+	created_at, updated_at`
+
+// attemptQuestions is a lateral subquery, aliased q, over the questions on
+// attempt er as they were delivered: the snapshot in the attempt's exam
+// version, or for attempts from before versions, the live questions. Join
+// it ON q.id = <question id>, or ON TRUE for all of them.
+const attemptQuestions = `LATERAL (
+	SELECT question_id AS id, ` + versionQuestionFields + ` FROM exam_version_questions
+	WHERE version_id = er.exam_version_id AND er.question_order @> to_jsonb(question_id)
+	UNION ALL
+	SELECT id, ` + versionQuestionFields + ` FROM questions q
+	WHERE er.exam_version_id IS NULL AND ` + attemptQuestionFilter + `
+) q`
+
+const examVersionColumns = `v.id, v.exam_id, v.version, v.status, COALESCE(v.title, ''), COALESCE(v.duration, 0),
+	COALESCE(v.passing_score, 0), COALESCE(v.total_points, 0), COALESCE(v.is_random, FALSE), v.blueprint,
+	(SELECT COUNT(*) FROM exam_version_questions WHERE version_id = v.id AND NOT drawn),
+	v.published_at, v.published_by, v.created_at, v.adaptive`
+
+func scanExamVersion(row interface{ Scan(...interface{}) error }, v *models.ExamVersion) error {
+	var blueprint, adaptive []byte
+	var publishedBy sql.NullInt64
+	if err := row.Scan(&v.ID, &v.ExamID, &v.Version, &v.Status, &v.Title, &v.Duration, &v.PassingScore,
+		&v.TotalPoints, &v.IsRandom, &blueprint, &v.QuestionCount, &v.PublishedAt, &publishedBy,
+		&v.CreatedAt, &adaptive); err != nil {
+		return err
+	}
+	v.PublishedBy = nullableInt(publishedBy)
+	if len(blueprint) > 0 {
+		if err := json.Unmarshal(blueprint, &v.Blueprint); err != nil {
+			return err
+		}
+	}
+	if len(adaptive) > 0 {
+		return json.Unmarshal(adaptive, &v.Adaptive)
+	}
+	return nil
+}
+
+// markExamDraft opens a draft version of an exam that has been published,
+// recording that the live exam has moved on from its latest version. An
+// exam that was never published, or already has a draft, is left alone.
+func markExamDraft(db execer, examID interface{}) error {
+	_, err := db.Exec(`
+		INSERT INTO exam_versions (exam_id, version, status)
+		SELECT exam_id, MAX(version) + 1, $2 FROM exam_versions WHERE exam_id = $1
+		GROUP BY exam_id
+		HAVING NOT BOOL_OR(status = $2)
+		ON CONFLICT (exam_id, version) DO NOTHING
+	`, examID, versionDraft)
+	return err
+}
+
+// publishExam snapshots the exam's settings, blueprint, adaptive settings
+// and questions with their keys and points into a published version. The
+// open draft becomes that version; with no draft nothing has changed since
+// the last version, which is returned as it is.
+func publishExam(tx *sql.Tx, examID int, publishedBy interface{}) (*models.ExamVersion, error) {
+	var e models.Exam
+	err := tx.QueryRow(`
+		SELECT title, COALESCE(duration, 0), COALESCE(passing_score, 0), COALESCE(total_points, 0), COALESCE(is_random, FALSE)
+		FROM exams WHERE id = $1 FOR UPDATE
+	`, examID).Scan(&e.Title, &e.Duration, &e.PassingScore, &e.TotalPoints, &e.IsRandom)
+	if err == sql.ErrNoRows {
+		return nil, errExamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var v models.ExamVersion
+	err = scanExamVersion(tx.QueryRow(`
+		SELECT `+examVersionColumns+` FROM exam_versions v WHERE v.exam_id = $1 ORDER BY v.version DESC LIMIT 1
+	`, examID), &v)
+	if err == nil && v.Status == versionPublished {
+		return &v, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	sections, err := getBlueprint(tx, examID)
+	if err != nil {
+		return nil, err
+	}
+	var blueprint interface{}
+	if len(sections) > 0 {
+		encoded, err := json.Marshal(sections)
+		if err != nil {
+			return nil, err
+		}
+		blueprint = string(encoded)
+	}
+	settings, err := getAdaptiveSettings(tx, examID)
+	if err != nil {
+		return nil, err
+	}
+	var adaptive interface{}
+	if settings != nil {
+		encoded, err := json.Marshal(settings)
+		if err != nil {
+			return nil, err
+		}
+		adaptive = string(encoded)
+	}
+
+	var versionID int
+	err = tx.QueryRow(`
+		UPDATE exam_versions
+		SET status = $2, title = $3, duration = $4, passing_score = $5, total_points = $6, is_random = $7,
+		    blueprint = $8, published_at = CURRENT_TIMESTAMP, published_by = $9, adaptive = $11
+		WHERE exam_id = $1 AND status = $10
+		RETURNING id
+	`, examID, versionPublished, e.Title, e.Duration, e.PassingScore, e.TotalPoints, e.IsRandom,
+		blueprint, publishedBy, versionDraft, adaptive).Scan(&versionID)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(`
+			INSERT INTO exam_versions (exam_id, version, status, title, duration, passing_score, total_points, is_random,
+			                           blueprint, published_at, published_by, adaptive)
+			SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP, $9, $10
+			FROM exam_versions WHERE exam_id = $1
+			RETURNING id
+		`, examID, versionPublished, e.Title, e.Duration, e.PassingScore, e.TotalPoints, e.IsRandom,
+			blueprint, publishedBy, adaptive).Scan(&versionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := snapshotQuestions(tx, versionID, false, `exam_id = $3`, examID); err != nil {
+		return nil, err
+	}
+	if err := scanExamVersion(tx.QueryRow(`SELECT `+examVersionColumns+` FROM exam_versions v WHERE v.id = $1`, versionID), &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// snapshotQuestions copies the questions matching filter into a version.
+// Bank questions drawn by a blueprint are copied the first time they are
+// drawn for the version and stay as they were then. filter's placeholders
+// start at $3.
+func snapshotQuestions(tx *sql.Tx, versionID int, drawn bool, filter string, args ...interface{}) error {
+	_, err := tx.Exec(`
+		INSERT INTO exam_version_questions (version_id, question_id, drawn, `+versionQuestionFields+`)
+		SELECT $1, id, $2, `+versionQuestionFields+` FROM questions WHERE `+filter+`
+		ON CONFLICT (version_id, question_id) DO NOTHING
+	`, append([]interface{}{versionID, drawn}, args...)...)
+	return err
+}
+
+// currentVersion returns the version new attempts at an exam are delivered
+// from: its latest published version. An exam that was never published is
+// published on its first attempt.
+func currentVersion(tx *sql.Tx, examID int) (*models.ExamVersion, error) {
+	var v models.ExamVersion
+	err := scanExamVersion(tx.QueryRow(`
+		SELECT `+examVersionColumns+` FROM exam_versions v
+		WHERE v.exam_id = $1 AND v.status = $2 ORDER BY v.version DESC LIMIT 1
+	`, examID, versionPublished), &v)
+	if err == sql.ErrNoRows {
+		return publishExam(tx, examID, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// PublishExam freezes the exam as it stands into a new version. Attempts
+// started from now on are delivered from it; attempts already taken keep
+// the version they were delivered.
+func (h *ExamHandler) PublishExam(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+	var publishedBy interface{}
+	if claims := auth.ClaimsFromContext(c); claims != nil && claims.UserID != 0 {
+		publishedBy = claims.UserID
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	v, err := publishExam(tx, examID, publishedBy)
+	if err == errExamNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
+
+// GetExamVersions lists an exam's versions, newest first. A draft at the
+// top means the exam has been edited since it was last published.
+func (h *ExamHandler) GetExamVersions(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT `+examVersionColumns+` FROM exam_versions v WHERE v.exam_id = $1 ORDER BY v.version DESC
+	`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	versions := []models.ExamVersion{}
+	for rows.Next() {
+		var v models.ExamVersion
+		if err := scanExamVersion(rows, &v); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetExamVersion returns one version with its snapshot of questions and
+// keys. Bank questions drawn by its blueprint are listed after the exam's
+// own questions.
+func (h *ExamHandler) GetExamVersion(c *gin.Context) {
+	var v models.ExamVersion
+	err := scanExamVersion(h.DB.QueryRow(`
+		SELECT `+examVersionColumns+` FROM exam_versions v WHERE v.exam_id = $1 AND v.version = $2
+	`, c.Param("id"), c.Param("version")), &v)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam version not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	v.Questions, err = listQuestions(h.DB, `
+		SELECT `+questionColumns+` FROM (
+			SELECT question_id AS id, drawn, `+versionQuestionFields+` FROM exam_version_questions WHERE version_id = $1
+		) q
+		ORDER BY drawn, order_num, id
+	`, v.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
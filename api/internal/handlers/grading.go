@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/grading"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GradingHandler serves the queue of writing and speaking answers that a
+// teacher has to grade by hand.
+type GradingHandler struct {
+	DB *sql.DB
+}
+
+func NewGradingHandler(db *sql.DB) *GradingHandler {
+	return &GradingHandler{DB: db}
+}
+
+var (
+	errAnswerNotFound    = errors.New("answer not found")
+	errNotManualAnswer   = errors.New("only writing and speaking answers are graded by hand")
+	errResultInProgress  = errors.New("the exam attempt is still in progress")
+	errNotExamTeacher    = errors.New("you can only grade exams for your own courses")
+	errGradeOutOfRange   = errors.New("score must be between 0 and the question's points")
+	errRubricUnreadable  = errors.New("the question's grading_rubric is not a list of criteria")
+	errRubricScoreNeeded = errors.New("score every criterion of the question's grading_rubric")
+)
+
+func gradingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errAnswerNotFound), errors.Is(err, errQuestionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errNotExamTeacher):
+		return http.StatusForbidden
+	case errors.Is(err, errResultInProgress):
+		return http.StatusConflict
+	case errors.Is(err, errNotManualAnswer), errors.Is(err, errGradeOutOfRange),
+		errors.Is(err, errRubricUnreadable), errors.Is(err, errRubricScoreNeeded):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// teachesExamClause restricts exams e (joined to courses co) to those the
+// teacher in placeholder n runs the course of or teaches a class in.
+func teachesExamClause(n int) string {
+	return fmt.Sprintf(`(co.teacher_id = $%d OR EXISTS (
+		SELECT 1 FROM classes cl WHERE cl.course_id = e.course_id AND cl.teacher_id = $%d))`, n, n)
+}
+
+// canGradeExam reports whether the caller may grade answers on the exam.
+// Admins grade everything; teachers grade the exams of their courses.
+func canGradeExam(db queryer, c *gin.Context, examID int) (bool, error) {
+	claims := auth.ClaimsFromContext(c)
+	if claims == nil {
+		return false, nil
+	}
+	if claims.Role == auth.RoleAdmin {
+		return true, nil
+	}
+	if claims.Role != auth.RoleTeacher || claims.TeacherID == 0 {
+		return false, nil
+	}
+	var ok bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM exams e LEFT JOIN courses co ON e.course_id = co.id
+			WHERE e.id = $1 AND `+teachesExamClause(2)+`
+		)
+	`, examID, claims.TeacherID).Scan(&ok)
+	return ok, err
+}
+
+// rubricCriterion is one line of a question's grading_rubric, in the shape
+// the rubric generator produces.
+type rubricCriterion struct {
+	Criteria    string `json:"criteria"`
+	MaxPoints   int    `json:"max_points"`
+	Description string `json:"description"`
+}
+
+// parseRubric reads a grading_rubric: a JSON list of criteria, or an object
+// holding one under "criteria". An empty rubric has no criteria.
+func parseRubric(raw string) ([]rubricCriterion, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var criteria []rubricCriterion
+	if json.Unmarshal([]byte(raw), &criteria) != nil {
+		var wrapped struct {
+			Criteria []rubricCriterion `json:"criteria"`
+		}
+		if json.Unmarshal([]byte(raw), &wrapped) != nil {
+			return nil, errRubricUnreadable
+		}
+		criteria = wrapped.Criteria
+	}
+	for _, cr := range criteria {
+		if strings.TrimSpace(cr.Criteria) == "" || cr.MaxPoints <= 0 {
+			return nil, errRubricUnreadable
+		}
+	}
+	return criteria, nil
+}
+
+// GradeAnswerRequest grades one answer. With a rubric, Criteria scores every
+// criterion by name; without one, Score is out of the question's points.
+type GradeAnswerRequest struct {
+	Criteria      map[string]int `json:"criteria"`
+	Score         *int           `json:"score"`
+	Feedback      string         `json:"feedback"`
+	Strengths     []string       `json:"strengths"`
+	Improvements  []string       `json:"improvements"`
+	CorrectedText string         `json:"corrected_text"`
+	Suggestions   string         `json:"suggestions"`
+}
+
+// rubricScore totals the request's criterion scores against the rubric and
+// returns the score and the most it could have been.
+func rubricScore(rubric []rubricCriterion, req GradeAnswerRequest, points int) (int, int, error) {
+	if len(rubric) == 0 {
+		if req.Score == nil || *req.Score < 0 || *req.Score > points {
+			return 0, 0, errGradeOutOfRange
+		}
+		return *req.Score, points, nil
+	}
+
+	if len(req.Criteria) != len(rubric) {
+		return 0, 0, errRubricScoreNeeded
+	}
+	score, max := 0, 0
+	for _, cr := range rubric {
+		s, ok := req.Criteria[cr.Criteria]
+		if !ok {
+			return 0, 0, fmt.Errorf("%w: missing %q", errRubricScoreNeeded, cr.Criteria)
+		}
+		if s < 0 || s > cr.MaxPoints {
+			return 0, 0, fmt.Errorf("%w: %q is out of %d", errRubricScoreNeeded, cr.Criteria, cr.MaxPoints)
+		}
+		score += s
+		max += cr.MaxPoints
+	}
+	return score, max, nil
+}
+
+// jsonList encodes a list for a JSONB column, or NULL when it is empty.
+func jsonList(list []string) (interface{}, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// GetQueue lists the writing and speaking answers still waiting for a grade,
+// oldest submission first. Teachers see the exams of their own courses;
+// exam_id, course_id and question_type narrow the list.
+func (h *GradingHandler) GetQueue(c *gin.Context) {
+	query := `
+		SELECT a.id, er.id, e.id, e.title, e.course_id, er.student_id, s.first_name || ' ' || s.last_name,
+		       q.id, q.question_text, COALESCE(q.question_type, ''), COALESCE(q.passage, ''), q.points,
+		       COALESCE(q.grading_rubric::text, ''), COALESCE(a.selected_answer, ''), COALESCE(a.audio_url, ''),
+		       er.completed_at
+		FROM answers a
+		JOIN exam_results er ON a.exam_result_id = er.id
+		JOIN exams e ON er.exam_id = e.id
+		LEFT JOIN courses co ON e.course_id = co.id
+		JOIN students s ON er.student_id = s.id
+		JOIN ` + attemptQuestions + ` ON q.id = a.question_id
+		WHERE a.grading_status = $1 AND er.status <> $2`
+	args := []interface{}{answerPending, attemptInProgress}
+
+	if claims := auth.ClaimsFromContext(c); claims == nil || claims.Role != auth.RoleAdmin {
+		teacherID := 0
+		if claims != nil {
+			teacherID = claims.TeacherID
+		}
+		args = append(args, teacherID)
+		query += " AND " + teachesExamClause(len(args))
+	}
+	filters := []struct{ param, column string }{
+		{"exam_id", "e.id"},
+		{"course_id", "e.course_id"},
+		{"question_type", "q.question_type"},
+	}
+	for _, f := range filters {
+		if v := strings.TrimSpace(c.Query(f.param)); v != "" {
+			args = append(args, v)
+			query += fmt.Sprintf(" AND %s = $%d", f.column, len(args))
+		}
+	}
+	query += " ORDER BY er.completed_at ASC, er.id, q.order_num, q.id"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.GradingQueueItem{}
+	for rows.Next() {
+		var it models.GradingQueueItem
+		var courseID sql.NullInt64
+		if err := rows.Scan(&it.AnswerID, &it.ExamResultID, &it.ExamID, &it.ExamTitle, &courseID,
+			&it.StudentID, &it.StudentName, &it.QuestionID, &it.QuestionText, &it.QuestionType,
+			&it.Passage, &it.Points, &it.GradingRubric, &it.SelectedAnswer, &it.AudioURL,
+			&it.SubmittedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		it.CourseID = nullableInt(courseID)
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items, "count": len(items)})
+}
+
+// GradeAnswer records a teacher's grade and feedback for a writing or
+// speaking answer, then rescores its result. The result stays pending until
+// its last manual answer is graded. Grading an answer again replaces the
+// earlier evaluation.
+func (h *GradingHandler) GradeAnswer(c *gin.Context) {
+	var req GradeAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var r models.ExamResult
+	var questionType, rawRubric string
+	var points int
+	err = tx.QueryRow(`
+		SELECT er.id, er.exam_id, er.student_id, er.total_points, er.status,
+		       COALESCE(q.question_type, ''), q.points, COALESCE(q.grading_rubric::text, '')
+		FROM answers a
+		JOIN exam_results er ON a.exam_result_id = er.id
+		JOIN `+attemptQuestions+` ON q.id = a.question_id
+		WHERE a.id = $1
+		FOR UPDATE OF er, a
+	`, c.Param("id")).Scan(&r.ID, &r.ExamID, &r.StudentID, &r.TotalPoints, &r.Status,
+		&questionType, &points, &rawRubric)
+	if err == sql.ErrNoRows {
+		err = errAnswerNotFound
+	}
+	if err == nil {
+		var ok bool
+		if ok, err = canGradeExam(tx, c, r.ExamID); err == nil && !ok {
+			err = errNotExamTeacher
+		}
+	}
+	if err == nil && r.Status == attemptInProgress {
+		err = errResultInProgress
+	}
+	if err == nil && !grading.IsManual(questionType) {
+		err = errNotManualAnswer
+	}
+	var rubric []rubricCriterion
+	if err == nil {
+		rubric, err = parseRubric(rawRubric)
+	}
+	var score, maxScore int
+	if err == nil {
+		score, maxScore, err = rubricScore(rubric, req, points)
+	}
+	if err != nil {
+		c.JSON(gradingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	earned := 0.0
+	if maxScore > 0 {
+		earned = math.Round(float64(score)/float64(maxScore)*float64(points)*100) / 100
+	}
+	if _, err := tx.Exec(`
+		UPDATE answers SET points_earned = $1, is_correct = $2, grading_status = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, earned, points > 0 && earned >= float64(points), answerGraded, c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var criteria interface{}
+	if len(rubric) > 0 {
+		encoded, err := json.Marshal(req.Criteria)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		criteria = string(encoded)
+	}
+	strengths, err := jsonList(req.Strengths)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	improvements, err := jsonList(req.Improvements)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var gradedBy interface{}
+	if claims := auth.ClaimsFromContext(c); claims != nil && claims.UserID != 0 {
+		gradedBy = claims.UserID
+	}
+
+	var ev models.WritingEvaluation
+	var graderID sql.NullInt64
+	err = tx.QueryRow(`
+		INSERT INTO writing_evaluations (answer_id, score, max_score, feedback, strengths, improvements,
+		                                 corrected_text, suggestions, criteria_scores, graded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (answer_id) DO UPDATE
+		SET score = EXCLUDED.score, max_score = EXCLUDED.max_score, feedback = EXCLUDED.feedback,
+		    strengths = EXCLUDED.strengths, improvements = EXCLUDED.improvements,
+		    corrected_text = EXCLUDED.corrected_text, suggestions = EXCLUDED.suggestions,
+		    criteria_scores = EXCLUDED.criteria_scores, graded_by = EXCLUDED.graded_by,
+		    evaluated_at = CURRENT_TIMESTAMP
+		RETURNING id, answer_id, score, max_score, COALESCE(feedback, ''), COALESCE(strengths::text, ''),
+		          COALESCE(improvements::text, ''), COALESCE(corrected_text, ''), COALESCE(suggestions, ''),
+		          COALESCE(criteria_scores::text, ''), graded_by, evaluated_at
+	`, c.Param("id"), score, maxScore, req.Feedback, strengths, improvements,
+		req.CorrectedText, req.Suggestions, criteria, gradedBy).Scan(&ev.ID, &ev.AnswerID, &ev.Score, &ev.MaxScore,
+		&ev.Feedback, &ev.Strengths, &ev.Improvements, &ev.CorrectedText, &ev.Suggestions,
+		&ev.CriteriaScores, &graderID, &ev.EvaluatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ev.GradedBy = nullableInt(graderID)
+
+	if err := scoreResult(tx, &r); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"evaluation":    ev,
+		"points_earned": earned,
+		"exam_result":   gin.H{"id": r.ID, "score": r.Score, "status": r.Status},
+	})
+}
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/integrity"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxIntegrityBatch caps the events accepted in one request.
+const maxIntegrityBatch = 200
+
+// integrityFlushWindow is how long after an attempt closes the student app
+// may still send the events it had queued.
+const integrityFlushWindow = `INTERVAL '5 minutes'`
+
+type IntegrityHandler struct {
+	DB *sql.DB
+}
+
+func NewIntegrityHandler(db *sql.DB) *IntegrityHandler {
+	return &IntegrityHandler{DB: db}
+}
+
+type IntegrityEventInput struct {
+	EventType  string     `json:"event_type" binding:"required"`
+	Details    string     `json:"details"`
+	DurationMs int        `json:"duration_ms"`
+	OccurredAt *time.Time `json:"occurred_at"`
+}
+
+type IntegrityEventsRequest struct {
+	Events []IntegrityEventInput `json:"events" binding:"required"`
+}
+
+// assessAttempt counts up the attempt's integrity events, scores them and
+// stores the score and summary on the result.
+func assessAttempt(tx *sql.Tx, resultID int) (*models.IntegritySummary, error) {
+	var counts integrity.Counts
+	var s models.IntegritySummary
+	var focusLostMs int64
+	err := tx.QueryRow(`
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE event_type = $2),
+		       COALESCE(SUM(duration_ms) FILTER (WHERE event_type IN ($2, $3)), 0),
+		       COUNT(*) FILTER (WHERE event_type = $4),
+		       COUNT(*) FILTER (WHERE event_type = $5),
+		       COUNT(*) FILTER (WHERE event_type = $6),
+		       COUNT(*) FILTER (WHERE event_type IN ($7, $8))
+		FROM exam_integrity_logs WHERE exam_result_id = $1
+	`, resultID, integrity.TabSwitch, integrity.FocusLost, integrity.Paste, integrity.Copy, integrity.DevTools,
+		integrity.ContextMenu, integrity.FullscreenExit).Scan(&s.Events, &counts.TabSwitches, &focusLostMs,
+		&counts.PasteAttempts, &counts.CopyAttempts, &counts.DevToolsAttempts, &counts.OtherEvents)
+	if err != nil {
+		return nil, err
+	}
+	counts.FocusLostSeconds = int(focusLostMs / 1000)
+
+	// The address the attempt started from comes first, then each batch's
+	// address in the order received.
+	rows, err := tx.Query(`
+		SELECT ip FROM (
+			SELECT COALESCE(client_ip, '') AS ip, 0 AS part, started_at AS at, id FROM exam_results WHERE id = $1
+			UNION ALL
+			SELECT COALESCE(ip_address, ''), 1, timestamp, id FROM exam_integrity_logs WHERE exam_result_id = $1
+		) seen
+		ORDER BY part, at, id
+	`, resultID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var addresses []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, ip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	counts.IPChanges = integrity.IPChanges(addresses)
+
+	s.TabSwitches = counts.TabSwitches
+	s.FocusLostSeconds = counts.FocusLostSeconds
+	s.PasteAttempts = counts.PasteAttempts
+	s.CopyAttempts = counts.CopyAttempts
+	s.DevToolsAttempts = counts.DevToolsAttempts
+	s.IPChanges = counts.IPChanges
+	s.OtherEvents = counts.OtherEvents
+	s.RiskScore, s.Flagged, s.Reasons = integrity.Assess(counts)
+
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		UPDATE exam_results SET risk_score = $1, risk_flagged = $2, integrity_summary = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, s.RiskScore, s.Flagged, string(encoded), resultID)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// RecordEvents stores a batch of integrity events from the student app
+// against an attempt and rescores it. The client address is taken from the
+// request, never from the body. Events are accepted while the attempt runs
+// and for a few minutes after it closes, so a queued batch can still arrive.
+func (h *IntegrityHandler) RecordEvents(c *gin.Context) {
+	resultID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attempt id"})
+		return
+	}
+	var req IntegrityEventsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Events) == 0 || len(req.Events) > maxIntegrityBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Send between 1 and %d events", maxIntegrityBatch)})
+		return
+	}
+	for i, e := range req.Events {
+		if !integrity.Known(e.EventType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("events[%d]: event_type must be one of %s",
+				i, strings.Join(integrity.EventTypes, ", "))})
+			return
+		}
+		if e.DurationMs < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("events[%d]: duration_ms cannot be negative", i)})
+			return
+		}
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var studentID int
+	var accepting bool
+	err = tx.QueryRow(`
+		SELECT student_id, status = $2 OR COALESCE(completed_at + `+integrityFlushWindow+` > CURRENT_TIMESTAMP, FALSE)
+		FROM exam_results WHERE id = $1 FOR UPDATE
+	`, resultID, attemptInProgress).Scan(&studentID, &accepting)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": errAttemptNotFound.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.CanAccessStudent(c, studentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only report events for your own attempts"})
+		return
+	}
+	if !accepting {
+		c.JSON(http.StatusConflict, gin.H{"error": errAttemptClosed.Error(), "code": codeAttemptClosed})
+		return
+	}
+
+	ip := c.ClientIP()
+	for _, e := range req.Events {
+		_, err := tx.Exec(`
+			INSERT INTO exam_integrity_logs (exam_result_id, student_id, event_type, event_details, duration_ms, occurred_at, ip_address)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, resultID, studentID, e.EventType, e.Details, e.DurationMs, e.OccurredAt, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if _, err := assessAttempt(tx, resultID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accepted": len(req.Events)})
+}
+
+// GetFlagged lists attempts for proctors to review, riskiest first: those
+// flagged by their score, or with min_score set, those scoring at least
+// that. Teachers see the exams of their own courses.
+func (h *IntegrityHandler) GetFlagged(c *gin.Context) {
+	query := `
+		SELECT er.id, e.id, e.title, er.student_id, s.first_name || ' ' || s.last_name, er.status,
+		       er.started_at, er.completed_at, COALESCE(er.client_ip, ''), er.integrity_summary
+		FROM exam_results er
+		JOIN exams e ON er.exam_id = e.id
+		LEFT JOIN courses co ON e.course_id = co.id
+		JOIN students s ON er.student_id = s.id
+		WHERE er.integrity_summary IS NOT NULL`
+	args := []interface{}{}
+
+	if minScore := c.Query("min_score"); minScore != "" {
+		n, err := strconv.Atoi(minScore)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_score must be a number"})
+			return
+		}
+		args = append(args, n)
+		query += fmt.Sprintf(" AND COALESCE(er.risk_score, 0) >= $%d", len(args))
+	} else {
+		query += " AND COALESCE(er.risk_flagged, FALSE)"
+	}
+	if claims := auth.ClaimsFromContext(c); claims == nil || claims.Role != auth.RoleAdmin {
+		teacherID := 0
+		if claims != nil {
+			teacherID = claims.TeacherID
+		}
+		args = append(args, teacherID)
+		query += " AND " + teachesExamClause(len(args))
+	}
+	filters := []struct{ param, column string }{
+		{"exam_id", "e.id"},
+		{"course_id", "e.course_id"},
+		{"student_id", "er.student_id"},
+	}
+	for _, f := range filters {
+		if v := strings.TrimSpace(c.Query(f.param)); v != "" {
+			args = append(args, v)
+			query += fmt.Sprintf(" AND %s = $%d", f.column, len(args))
+		}
+	}
+	query += " ORDER BY er.risk_score DESC, er.started_at DESC"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.IntegrityReview{}
+	for rows.Next() {
+		var r models.IntegrityReview
+		var summary []byte
+		if err := rows.Scan(&r.ExamResultID, &r.ExamID, &r.ExamTitle, &r.StudentID, &r.StudentName, &r.Status,
+			&r.StartedAt, &r.CompletedAt, &r.ClientIP, &summary); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := json.Unmarshal(summary, &r.Summary); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		items = append(items, r)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items, "count": len(items)})
+}
+
+// GetResultIntegrity returns one attempt's integrity summary with every
+// event it reported, in the order received.
+func (h *IntegrityHandler) GetResultIntegrity(c *gin.Context) {
+	resultID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam result id"})
+		return
+	}
+
+	var examID int
+	var clientIP string
+	var summary []byte
+	err = h.DB.QueryRow(`
+		SELECT exam_id, COALESCE(client_ip, ''), integrity_summary FROM exam_results WHERE id = $1
+	`, resultID).Scan(&examID, &clientIP, &summary)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam result not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ok, err := canGradeExam(h.DB, c, examID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": errNotExamTeacher.Error()})
+		return
+	}
+
+	s := models.IntegritySummary{Reasons: []string{}}
+	if len(summary) > 0 {
+		if err := json.Unmarshal(summary, &s); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT id, exam_result_id, COALESCE(student_id, 0), event_type, COALESCE(event_details, ''),
+		       COALESCE(duration_ms, 0), occurred_at, timestamp, COALESCE(ip_address, '')
+		FROM exam_integrity_logs WHERE exam_result_id = $1
+		ORDER BY timestamp, id
+	`, resultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.ExamIntegrityLog{}
+	for rows.Next() {
+		var e models.ExamIntegrityLog
+		if err := rows.Scan(&e.ID, &e.ExamResultID, &e.StudentID, &e.EventType, &e.EventDetails,
+			&e.DurationMs, &e.OccurredAt, &e.Timestamp, &e.IPAddress); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"exam_result_id": resultID,
+		"client_ip":      clientIP,
+		"summary":        s,
+		"events":         events,
+	})
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/models"
+	"uedu-api/internal/placement"
+
+	"github.com/gin-gonic/gin"
+)
+
+// examPlacement is the exam type whose results place students at a level.
+const examPlacement = "pre_registration"
+
+var errNotPlacementExam = errors.New("placement bands can only be set on pre_registration exams")
+
+type PlacementHandler struct {
+	DB *sql.DB
+}
+
+func NewPlacementHandler(db *sql.DB) *PlacementHandler {
+	return &PlacementHandler{DB: db}
+}
+
+type SavePlacementRequest struct {
+	Bands        []models.PlacementBand        `json:"bands"`
+	SkillWeights []models.PlacementSkillWeight `json:"skill_weights"`
+}
+
+func getPlacementConfig(db queryerRows, examID int) ([]models.PlacementBand, []models.PlacementSkillWeight, error) {
+	rows, err := db.Query(`
+		SELECT id, exam_id, min_score, cefr_level, created_at
+		FROM placement_bands WHERE exam_id = $1 ORDER BY min_score
+	`, examID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	bands := []models.PlacementBand{}
+	for rows.Next() {
+		var b models.PlacementBand
+		if err := rows.Scan(&b.ID, &b.ExamID, &b.MinScore, &b.CEFRLevel, &b.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		bands = append(bands, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	wrows, err := db.Query(`SELECT skill, weight FROM placement_skill_weights WHERE exam_id = $1 ORDER BY skill`, examID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer wrows.Close()
+	weights := []models.PlacementSkillWeight{}
+	for wrows.Next() {
+		var w models.PlacementSkillWeight
+		if err := wrows.Scan(&w.Skill, &w.Weight); err != nil {
+			return nil, nil, err
+		}
+		weights = append(weights, w)
+	}
+	return bands, weights, wrows.Err()
+}
+
+// validatePlacement normalises the bands into score order and checks that
+// levels never drop as scores rise.
+func validatePlacement(req *SavePlacementRequest) error {
+	for i := range req.Bands {
+		b := &req.Bands[i]
+		b.CEFRLevel = strings.ToUpper(strings.TrimSpace(b.CEFRLevel))
+		switch {
+		case b.MinScore < 0 || b.MinScore > 100:
+			return fmt.Errorf("band %d: min_score must be between 0 and 100", i+1)
+		case cefrRank(b.CEFRLevel) < 0:
+			return fmt.Errorf("band %d: cefr_level must be one of %s", i+1, strings.Join(cefrLevels, ", "))
+		}
+	}
+	sort.SliceStable(req.Bands, func(i, j int) bool { return req.Bands[i].MinScore < req.Bands[j].MinScore })
+	for i := 1; i < len(req.Bands); i++ {
+		prev, b := req.Bands[i-1], req.Bands[i]
+		if b.MinScore == prev.MinScore {
+			return fmt.Errorf("two bands start at %g", b.MinScore)
+		}
+		if cefrRank(b.CEFRLevel) < cefrRank(prev.CEFRLevel) {
+			return fmt.Errorf("the band from %g places lower than the band from %g", b.MinScore, prev.MinScore)
+		}
+	}
+
+	seen := map[string]bool{}
+	for i := range req.SkillWeights {
+		w := &req.SkillWeights[i]
+		w.Skill = strings.ToLower(strings.TrimSpace(w.Skill))
+		switch {
+		case !isSkill(w.Skill) && w.Skill != untaggedSkill:
+			return fmt.Errorf("skill_weights: skill must be one of %s, %s", strings.Join(skillNames, ", "), untaggedSkill)
+		case w.Weight < 0:
+			return fmt.Errorf("skill_weights: the weight of %s cannot be negative", w.Skill)
+		case seen[w.Skill]:
+			return fmt.Errorf("skill_weights: %s is weighted twice", w.Skill)
+		}
+		seen[w.Skill] = true
+	}
+	return nil
+}
+
+// resultSkills totals the points earned and available per skill over the
+// questions delivered in a result.
+func resultSkills(db queryerRows, resultID int) ([]placement.Skill, error) {
+	rows, err := db.Query(`
+		SELECT COALESCE(q.skill, ''), COALESCE(q.question_type, ''), COALESCE(a.points_earned, 0), COALESCE(q.points, 0)
+		FROM exam_results er
+		JOIN `+attemptQuestions+` ON TRUE
+		LEFT JOIN answers a ON a.exam_result_id = er.id AND a.question_id = q.id
+		WHERE er.id = $1
+	`, resultID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := map[string]int{}
+	var skills []placement.Skill
+	for rows.Next() {
+		var skill, questionType string
+		var earned, points float64
+		if err := rows.Scan(&skill, &questionType, &earned, &points); err != nil {
+			return nil, err
+		}
+		skill = answerSkill(skill, questionType)
+		i, ok := index[skill]
+		if !ok {
+			i = len(skills)
+			index[skill] = i
+			skills = append(skills, placement.Skill{Skill: skill})
+		}
+		skills[i].Earned += earned
+		skills[i].Points += points
+	}
+	return skills, rows.Err()
+}
+
+// placeResult places the student from a scored placement exam result using
+// the exam's bands as they stand. An adaptive result places the student at
+// the level of their ability estimate instead. The student's level is only
+// changed by their most recent placement, so regrading an older one leaves
+// it alone. Results of other exams, and exams without bands, are left
+// unplaced.
+func placeResult(db readQueryerExecer, r *models.ExamResult) error {
+	var examType, abilityLevel string
+	var adaptive bool
+	if err := db.QueryRow(`
+		SELECT COALESCE(e.exam_type, ''), COALESCE(er.adaptive, FALSE), COALESCE(er.ability_level, '')
+		FROM exam_results er JOIN exams e ON er.exam_id = e.id
+		WHERE er.id = $1
+	`, r.ID).Scan(&examType, &adaptive, &abilityLevel); err != nil {
+		return err
+	}
+	if examType != examPlacement {
+		return nil
+	}
+
+	score, level := r.Score, abilityLevel
+	if !adaptive {
+		bands, weights, err := getPlacementConfig(db, r.ExamID)
+		if err != nil || len(bands) == 0 {
+			return err
+		}
+		skills, err := resultSkills(db, r.ID)
+		if err != nil {
+			return err
+		}
+
+		lookup := make([]placement.Band, len(bands))
+		for i, b := range bands {
+			lookup[i] = placement.Band{MinScore: b.MinScore, Level: b.CEFRLevel}
+		}
+		weightBySkill := map[string]float64{}
+		for _, w := range weights {
+			weightBySkill[w.Skill] = w.Weight
+		}
+		score, _ = placement.Score(r.Score, skills, weightBySkill)
+		level = placement.Level(lookup, score)
+	}
+
+	if _, err := db.Exec(`
+		UPDATE exam_results SET placement_score = $1, placement_level = NULLIF($2, '') WHERE id = $3
+	`, score, level, r.ID); err != nil {
+		return err
+	}
+	if level == "" {
+		return nil
+	}
+	_, err := db.Exec(`
+		UPDATE students SET level = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND NOT EXISTS (
+			SELECT 1 FROM exam_results o
+			JOIN exam_results cur ON cur.id = $3
+			WHERE o.student_id = $2 AND o.id <> cur.id AND o.placement_level IS NOT NULL
+			  AND (o.completed_at, o.id) > (cur.completed_at, cur.id)
+		)
+	`, level, r.StudentID, r.ID)
+	return err
+}
+
+// courseOffers ranks the upcoming courses at a level that still have free
+// seats and that the student is not already in: the soonest first, then
+// those with the most room.
+func courseOffers(db queryerRows, studentID int, level string) ([]models.CourseOffer, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.name, COALESCE(c.description, ''), COALESCE(c.level, ''), COALESCE(c.teacher_id, 0),
+		       COALESCE(c.capacity, 0), COALESCE(c.price, 0), c.start_date, COALESCE(c.end_date, c.start_date),
+		       c.created_at, c.updated_at, seats.active
+		FROM courses c
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS active FROM enrollments e WHERE e.course_id = c.id AND e.status = $3
+		) seats
+		WHERE UPPER(TRIM(c.level)) = $1 AND c.start_date > CURRENT_TIMESTAMP
+		  AND (COALESCE(c.capacity, 0) <= 0 OR seats.active < c.capacity)
+		  AND NOT EXISTS (
+			SELECT 1 FROM enrollments e WHERE e.course_id = c.id AND e.student_id = $2 AND e.status IN ($3, $4)
+		  )
+		ORDER BY c.start_date, COALESCE(c.capacity, 0) <= 0 DESC, c.capacity - seats.active DESC, c.id
+	`, level, studentID, enrollmentActive, enrollmentWaitlisted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	offers := []models.CourseOffer{}
+	for rows.Next() {
+		var o models.CourseOffer
+		var active int
+		if err := rows.Scan(&o.ID, &o.Name, &o.Description, &o.Level, &o.TeacherID, &o.Capacity, &o.Price,
+			&o.StartDate, &o.EndDate, &o.CreatedAt, &o.UpdatedAt, &active); err != nil {
+			return nil, err
+		}
+		if o.Capacity > 0 {
+			free := o.Capacity - active
+			o.FreeSeats = &free
+		}
+		o.Rank = len(offers) + 1
+		offers = append(offers, o)
+	}
+	return offers, rows.Err()
+}
+
+// loadPlacement returns the placement of a result with its course offers,
+// or nil when the result has not placed the student.
+func loadPlacement(db readQueryer, resultID int) (*models.Placement, error) {
+	p := models.Placement{ExamResultID: resultID}
+	var level sql.NullString
+	err := db.QueryRow(`
+		SELECT er.exam_id, er.student_id, COALESCE(er.score, 0), COALESCE(er.placement_score, 0), er.placement_level,
+		       COALESCE(s.level, '')
+		FROM exam_results er
+		JOIN students s ON er.student_id = s.id
+		WHERE er.id = $1 AND er.placement_score IS NOT NULL
+	`, resultID).Scan(&p.ExamID, &p.StudentID, &p.Score, &p.PlacementScore, &level, &p.StudentLevel)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.CEFRLevel = level.String
+
+	skills, err := resultSkills(db, resultID)
+	if err != nil {
+		return nil, err
+	}
+	_, p.SkillScores = placement.Score(p.Score, skills, nil)
+
+	p.Courses = []models.CourseOffer{}
+	if p.CEFRLevel != "" {
+		if p.Courses, err = courseOffers(db, p.StudentID, p.CEFRLevel); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+func (h *PlacementHandler) respondPlacementConfig(c *gin.Context, examID int) {
+	bands, weights, err := getPlacementConfig(h.DB, examID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"exam_id":       examID,
+		"bands":         bands,
+		"skill_weights": weights,
+	})
+}
+
+// GetPlacementConfig lists a placement exam's score bands, lowest first,
+// and its skill weights.
+func (h *PlacementHandler) GetPlacementConfig(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+	h.respondPlacementConfig(c, examID)
+}
+
+// SavePlacementConfig replaces a placement exam's score bands and skill
+// weights. They apply to results scored from then on, including regrades;
+// results already placed keep their level until then. Empty bands stop the
+// exam placing students.
+func (h *PlacementHandler) SavePlacementConfig(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+	var req SavePlacementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePlacement(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var examType string
+	err = tx.QueryRow(`SELECT COALESCE(exam_type, '') FROM exams WHERE id = $1`, examID).Scan(&examType)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if examType != examPlacement {
+		c.JSON(http.StatusConflict, gin.H{"error": errNotPlacementExam.Error()})
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM placement_bands WHERE exam_id = $1`, examID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM placement_skill_weights WHERE exam_id = $1`, examID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, b := range req.Bands {
+		if _, err := tx.Exec(`
+			INSERT INTO placement_bands (exam_id, min_score, cefr_level) VALUES ($1, $2, $3)
+		`, examID, b.MinScore, b.CEFRLevel); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	for _, w := range req.SkillWeights {
+		if _, err := tx.Exec(`
+			INSERT INTO placement_skill_weights (exam_id, skill, weight) VALUES ($1, $2, $3)
+		`, examID, w.Skill, w.Weight); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondPlacementConfig(c, examID)
+}
+
+// GetResultPlacement returns the level a placement exam result placed the
+// student at and the courses currently offered at that level.
+func (h *PlacementHandler) GetResultPlacement(c *gin.Context) {
+	resultID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam result id"})
+		return
+	}
+	var studentID int
+	var status string
+	err = h.DB.QueryRow(`SELECT student_id, status FROM exam_results WHERE id = $1`, resultID).Scan(&studentID, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam result not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !auth.CanAccessStudent(c, studentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only view your own placement"})
+		return
+	}
+
+	p, err := loadPlacement(h.DB, resultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if p == nil {
+		msg := "This result has not placed the student"
+		if status == attemptPending || status == attemptInProgress {
+			msg = "The placement is made once the result is graded"
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": msg, "status": status})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
@@ -2,12 +2,41 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
+	"strings"
 	"uedu-api/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
 
+// maxDifficulty is the top of the 1-5 difficulty scale; 0 means unrated.
+const maxDifficulty = 5
+
+var skillNames = []string{"grammar", "vocabulary", "reading", "listening", "writing", "speaking"}
+
+var cefrLevels = []string{"A1", "A2", "B1", "B2", "C1", "C2"}
+
+func isSkill(skill string) bool {
+	for _, s := range skillNames {
+		if s == skill {
+			return true
+		}
+	}
+	return false
+}
+
+// cefrRank returns the position of a CEFR level from A1 = 0 to C2 = 5, or
+// -1 for anything else.
+func cefrRank(level string) int {
+	for i, l := range cefrLevels {
+		if strings.EqualFold(l, level) {
+			return i
+		}
+	}
+	return -1
+}
+
 type QuestionHandler struct {
 	DB *sql.DB
 }
@@ -16,30 +45,100 @@ func NewQuestionHandler(db *sql.DB) *QuestionHandler {
 	return &QuestionHandler{DB: db}
 }
 
-func (h *QuestionHandler) GetQuestions(c *gin.Context) {
-	examID := c.Param("exam_id")
-	rows, err := h.DB.Query(`
-		SELECT id, exam_id, question_text, question_type, options, correct_answer, points, order_num, 
-		       passage, audio_url, explanation, grading_rubric, created_at, updated_at 
-		FROM questions WHERE exam_id = $1 ORDER BY order_num ASC
-	`, examID)
+const questionColumns = `id, exam_id, question_text, COALESCE(question_type, ''), COALESCE(options::text, ''),
+	correct_answer, points, order_num, COALESCE(passage, ''), COALESCE(audio_url, ''), COALESCE(explanation, ''),
+	COALESCE(grading_rubric::text, ''), COALESCE(skill, ''), COALESCE(cefr_level, ''), COALESCE(topic, ''),
+	COALESCE(difficulty, 0), created_at, updated_at`
+
+func scanQuestion(row interface{ Scan(...interface{}) error }, q *models.Question) error {
+	return row.Scan(&q.ID, &q.ExamID, &q.QuestionText, &q.QuestionType, &q.Options,
+		&q.CorrectAnswer, &q.Points, &q.Order, &q.Passage, &q.AudioURL, &q.Explanation,
+		&q.GradingRubric, &q.Skill, &q.CEFRLevel, &q.Topic, &q.Difficulty, &q.CreatedAt, &q.UpdatedAt)
+}
+
+// listQuestions runs a query selecting questionColumns.
+func listQuestions(db queryerRows, query string, args ...interface{}) ([]models.Question, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
-	var questions []models.Question
+	questions := []models.Question{}
 	for rows.Next() {
 		var q models.Question
-		if err := rows.Scan(&q.ID, &q.ExamID, &q.QuestionText, &q.QuestionType, &q.Options, 
-			&q.CorrectAnswer, &q.Points, &q.Order, &q.Passage, &q.AudioURL, &q.Explanation, 
-			&q.GradingRubric, &q.CreatedAt, &q.UpdatedAt); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+		if err := scanQuestion(rows, &q); err != nil {
+			return nil, err
 		}
 		questions = append(questions, q)
 	}
+	return questions, rows.Err()
+}
+
+// validateQuestion checks the bank tags. All of them are optional.
+func validateQuestion(q *models.Question) error {
+	q.Skill = strings.ToLower(strings.TrimSpace(q.Skill))
+	q.CEFRLevel = strings.ToUpper(strings.TrimSpace(q.CEFRLevel))
+	q.Topic = strings.TrimSpace(q.Topic)
+	if q.Skill != "" && !isSkill(q.Skill) {
+		return fmt.Errorf("skill must be one of %s", strings.Join(skillNames, ", "))
+	}
+	if q.CEFRLevel != "" && cefrRank(q.CEFRLevel) < 0 {
+		return fmt.Errorf("cefr_level must be one of %s", strings.Join(cefrLevels, ", "))
+	}
+	if q.Difficulty < 0 || q.Difficulty > maxDifficulty {
+		return fmt.Errorf("difficulty must be 0 (unrated) to %d", maxDifficulty)
+	}
+	return nil
+}
+
+func (h *QuestionHandler) GetQuestions(c *gin.Context) {
+	examID := c.Param("id")
+	questions, err := listQuestions(h.DB, `
+		SELECT `+questionColumns+` FROM questions WHERE exam_id = $1 ORDER BY order_num ASC
+	`, examID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, questions)
+}
+
+// GetQuestionBank lists reusable questions, those not tied to an exam,
+// filtered by skill, cefr_level, topic, difficulty, question_type and a
+// free-text q.
+func (h *QuestionHandler) GetQuestionBank(c *gin.Context) {
+	query := `SELECT ` + questionColumns + ` FROM questions WHERE exam_id IS NULL`
+	args := []interface{}{}
+
+	filters := []struct{ param, column string }{
+		{"skill", "skill"},
+		{"cefr_level", "cefr_level"},
+		{"topic", "topic"},
+		{"question_type", "question_type"},
+	}
+	for _, f := range filters {
+		if v := strings.TrimSpace(c.Query(f.param)); v != "" {
+			args = append(args, v)
+			query += fmt.Sprintf(" AND LOWER(%s) = LOWER($%d)", f.column, len(args))
+		}
+	}
+	if v := c.Query("difficulty"); v != "" {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND difficulty = $%d", len(args))
+	}
+	if v := strings.TrimSpace(c.Query("q")); v != "" {
+		args = append(args, "%"+v+"%")
+		query += fmt.Sprintf(" AND (question_text ILIKE $%d OR passage ILIKE $%d)", len(args), len(args))
+	}
+	query += " ORDER BY cefr_level, skill, topic, id"
+
+	questions, err := listQuestions(h.DB, query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, questions)
 }
@@ -47,13 +146,7 @@ func (h *QuestionHandler) GetQuestions(c *gin.Context) {
 func (h *QuestionHandler) GetQuestion(c *gin.Context) {
 	id := c.Param("id")
 	var q models.Question
-	err := h.DB.QueryRow(`
-		SELECT id, exam_id, question_text, question_type, options, correct_answer, points, order_num, 
-		       passage, audio_url, explanation, grading_rubric, created_at, updated_at 
-		FROM questions WHERE id = $1
-	`, id).Scan(&q.ID, &q.ExamID, &q.QuestionText, &q.QuestionType, &q.Options, 
-		&q.CorrectAnswer, &q.Points, &q.Order, &q.Passage, &q.AudioURL, &q.Explanation, 
-		&q.GradingRubric, &q.CreatedAt, &q.UpdatedAt)
+	err := scanQuestion(h.DB.QueryRow(`SELECT `+questionColumns+` FROM questions WHERE id = $1`, id), &q)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
@@ -74,17 +167,29 @@ func (h *QuestionHandler) CreateQuestion(c *gin.Context) {
 		return
 	}
 
+	if err := validateQuestion(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	err := h.DB.QueryRow(`
-		INSERT INTO questions (exam_id, question_text, question_type, options, correct_answer, points, order_num, passage, audio_url, explanation, grading_rubric) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) 
+		INSERT INTO questions (exam_id, question_text, question_type, options, correct_answer, points, order_num, passage, audio_url, explanation, grading_rubric,
+		                       skill, cefr_level, topic, difficulty) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), NULLIF($13, ''), NULLIF($14, ''), NULLIF($15, 0)) 
 		RETURNING id, created_at, updated_at
 	`, q.ExamID, q.QuestionText, q.QuestionType, q.Options, q.CorrectAnswer, q.Points, q.Order, 
-		q.Passage, q.AudioURL, q.Explanation, q.GradingRubric).Scan(&q.ID, &q.CreatedAt, &q.UpdatedAt)
+		q.Passage, q.AudioURL, q.Explanation, q.GradingRubric, q.Skill, q.CEFRLevel, q.Topic, q.Difficulty).Scan(&q.ID, &q.CreatedAt, &q.UpdatedAt)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if q.ExamID != nil {
+		if err := markExamDraft(h.DB, *q.ExamID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	c.JSON(http.StatusCreated, q)
 }
@@ -97,18 +202,45 @@ func (h *QuestionHandler) UpdateQuestion(c *gin.Context) {
 		return
 	}
 
-	_, err := h.DB.Exec(`
+	if err := validateQuestion(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var oldExamID sql.NullInt64
+	err := h.DB.QueryRow(`SELECT exam_id FROM questions WHERE id = $1`, id).Scan(&oldExamID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = h.DB.Exec(`
 		UPDATE questions 
 		SET exam_id=$1, question_text=$2, question_type=$3, options=$4, correct_answer=$5, 
-		    points=$6, order_num=$7, passage=$8, audio_url=$9, explanation=$10, grading_rubric=$11, updated_at=CURRENT_TIMESTAMP 
-		WHERE id=$12
+		    points=$6, order_num=$7, passage=$8, audio_url=$9, explanation=$10, grading_rubric=$11,
+		    skill=NULLIF($12, ''), cefr_level=NULLIF($13, ''), topic=NULLIF($14, ''), difficulty=NULLIF($15, 0), updated_at=CURRENT_TIMESTAMP 
+		WHERE id=$16
 	`, q.ExamID, q.QuestionText, q.QuestionType, q.Options, q.CorrectAnswer, q.Points, q.Order, 
-		q.Passage, q.AudioURL, q.Explanation, q.GradingRubric, id)
+		q.Passage, q.AudioURL, q.Explanation, q.GradingRubric, q.Skill, q.CEFRLevel, q.Topic, q.Difficulty, id)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// Either exam the question belonged to has moved on from its version.
+	for _, examID := range []*int{nullableInt(oldExamID), q.ExamID} {
+		if examID == nil {
+			continue
+		}
+		if err := markExamDraft(h.DB, *examID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, q)
 }
@@ -116,16 +248,21 @@ func (h *QuestionHandler) UpdateQuestion(c *gin.Context) {
 func (h *QuestionHandler) DeleteQuestion(c *gin.Context) {
 	id := c.Param("id")
 
-	result, err := h.DB.Exec("DELETE FROM questions WHERE id = $1", id)
+	var examID sql.NullInt64
+	err := h.DB.QueryRow("DELETE FROM questions WHERE id = $1 RETURNING exam_id", id).Scan(&examID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Question not found"})
-		return
+	if examID.Valid {
+		if err := markExamDraft(h.DB, examID.Int64); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Question deleted successfully"})
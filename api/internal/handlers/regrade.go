@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/grading"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RegradeRequest struct {
+	Reason string `json:"reason"`
+}
+
+var errQuestionNotFound = errors.New("question not found")
+
+// regradeAnswers grades again, against the current key and points, every
+// answer on a submitted result that matches filter (over answers a and
+// exam_results er). Writing and speaking answers a teacher has graded keep
+// their evaluation, rescaled to the question's points.
+func regradeAnswers(tx *sql.Tx, filter string, args ...interface{}) error {
+	type regraded struct {
+		id      int
+		status  string
+		outcome grading.Outcome
+	}
+	rows, err := tx.Query(`
+		SELECT a.id, COALESCE(a.selected_answer, ''), COALESCE(q.question_type, ''), q.correct_answer,
+		       COALESCE(q.options::text, ''), q.points, we.id IS NOT NULL, COALESCE(we.score, 0), COALESCE(we.max_score, 0)
+		FROM answers a
+		JOIN exam_results er ON a.exam_result_id = er.id
+		JOIN `+attemptQuestions+` ON q.id = a.question_id
+		LEFT JOIN writing_evaluations we ON we.answer_id = a.id
+		WHERE er.status <> '`+attemptInProgress+`' AND `+filter, args...)
+	if err != nil {
+		return err
+	}
+	var answers []regraded
+	for rows.Next() {
+		var id, evScore, evMax int
+		var answer string
+		var evaluated bool
+		var q grading.Question
+		if err := rows.Scan(&id, &answer, &q.Type, &q.CorrectAnswer, &q.Options, &q.Points,
+			&evaluated, &evScore, &evMax); err != nil {
+			rows.Close()
+			return err
+		}
+		r := regraded{id: id, status: answerAuto}
+		switch {
+		case !grading.IsManual(q.Type):
+			r.outcome = grading.Grade(q, answer)
+		case evaluated && evMax > 0:
+			points := math.Round(float64(evScore)/float64(evMax)*q.Points*100) / 100
+			r.status = answerGraded
+			r.outcome = grading.Outcome{Points: points, Correct: q.Points > 0 && points >= q.Points}
+		default:
+			r.status = answerPending
+		}
+		answers = append(answers, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range answers {
+		if _, err := tx.Exec(`
+			UPDATE answers SET is_correct = $1, points_earned = $2, grading_status = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $4
+		`, r.outcome.Correct, r.outcome.Points, r.status, r.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retotalResult works out what a result is out of the same way a new
+// attempt would: the drawn questions' points for a blueprint exam, otherwise
+// the exam's total_points, both as of the attempt's version.
+func retotalResult(tx *sql.Tx, r *models.ExamResult) error {
+	return tx.QueryRow(`
+		UPDATE exam_results er
+		SET total_points = CASE
+		    WHEN CASE WHEN er.exam_version_id IS NULL
+		              THEN EXISTS (SELECT 1 FROM exam_blueprint_sections WHERE exam_id = er.exam_id)
+		              ELSE (SELECT blueprint IS NOT NULL FROM exam_versions WHERE id = er.exam_version_id) END
+		    THEN (SELECT COALESCE(SUM(q.points), 0) FROM `+attemptQuestions+`)
+		    ELSE COALESCE((SELECT total_points FROM exam_versions WHERE id = er.exam_version_id),
+		                  (SELECT total_points FROM exams WHERE id = er.exam_id)) END
+		WHERE er.id = $1
+		RETURNING er.total_points
+	`, r.ID).Scan(&r.TotalPoints)
+}
+
+// correctVersions copies the current answer key and points of the question
+// into the version snapshots matching filter (over exam_version_questions
+// vq).
+// A regrade is the one change that reaches versions already delivered.
+func correctVersions(tx *sql.Tx, filter string, args ...interface{}) error {
+	_, err := tx.Exec(`
+		UPDATE exam_version_questions vq
+		SET correct_answer = q.correct_answer, points = q.points
+		FROM questions q
+		WHERE q.id = vq.question_id AND `+filter, args...)
+	return err
+}
+
+// regradeScope says what a regrade covers, as filters sharing one set of
+// arguments: the results (over exam_results er), the answers on them (over
+// answers a and er) and the questions whose key is corrected in the exam
+// versions (over exam_version_questions vq).
+type regradeScope struct {
+	results, answers, keys string
+	args                   []interface{}
+}
+
+// regrade rescores the submitted results in scope and records the old and
+// new score of each in a regrade audit entry. Adaptive results have their
+// ability estimated again first, so they pass and place on the new one. Each student's analytics
+// profile is rebuilt once, after all their results are rescored.
+func regrade(tx *sql.Tx, audit models.Regrade, scope regradeScope) (*models.Regrade, error) {
+	rows, err := tx.Query(`
+		SELECT er.id, er.exam_id, er.student_id, s.first_name || ' ' || s.last_name,
+		       COALESCE(er.score, 0), er.status
+		FROM exam_results er
+		JOIN students s ON er.student_id = s.id
+		WHERE er.status <> '`+attemptInProgress+`' AND `+scope.results+`
+		ORDER BY er.id
+		FOR UPDATE OF er
+	`, scope.args...)
+	if err != nil {
+		return nil, err
+	}
+	var changes []models.RegradeChange
+	for rows.Next() {
+		var ch models.RegradeChange
+		if err := rows.Scan(&ch.ExamResultID, &ch.ExamID, &ch.StudentID, &ch.StudentName,
+			&ch.OldScore, &ch.OldStatus); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		changes = append(changes, ch)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := correctVersions(tx, scope.keys, scope.args...); err != nil {
+		return nil, err
+	}
+	if err := regradeAnswers(tx, scope.answers, scope.args...); err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO regrades (exam_id, question_id, reason, regraded_by)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+		RETURNING id, created_at
+	`, audit.ExamID, audit.QuestionID, audit.Reason, audit.RegradedBy).Scan(&audit.ID, &audit.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Changes, audit.NowPassed, audit.NowFailed = []models.RegradeChange{}, []models.RegradeChange{}, []models.RegradeChange{}
+	var students []int
+	seen := map[int]bool{}
+	for _, ch := range changes {
+		r := models.ExamResult{ID: ch.ExamResultID, ExamID: ch.ExamID}
+		if err := reestimateAdaptive(tx, r.ID); err != nil {
+			return nil, err
+		}
+		if err := retotalResult(tx, &r); err != nil {
+			return nil, err
+		}
+		if err := rescoreResult(tx, &r); err != nil {
+			return nil, err
+		}
+		ch.NewScore, ch.NewStatus = r.Score, r.Status
+		if _, err := tx.Exec(`
+			INSERT INTO regrade_results (regrade_id, exam_result_id, old_score, new_score, old_status, new_status)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, audit.ID, ch.ExamResultID, ch.OldScore, ch.NewScore, ch.OldStatus, ch.NewStatus); err != nil {
+			return nil, err
+		}
+
+		addRegradeChange(&audit, ch)
+		if !seen[ch.StudentID] {
+			seen[ch.StudentID] = true
+			students = append(students, ch.StudentID)
+		}
+	}
+	for _, id := range students {
+		if _, err := refreshStudentAnalytics(tx, id); err != nil {
+			return nil, err
+		}
+	}
+	return &audit, nil
+}
+
+// addRegradeChange counts a regraded result and lists it if its score or
+// status moved, and again if it crossed the pass mark.
+func addRegradeChange(rg *models.Regrade, ch models.RegradeChange) {
+	rg.Regraded++
+	if ch.OldScore == ch.NewScore && ch.OldStatus == ch.NewStatus {
+		return
+	}
+	rg.Changes = append(rg.Changes, ch)
+	switch {
+	case ch.OldStatus == attemptFailed && ch.NewStatus == attemptPassed:
+		rg.NowPassed = append(rg.NowPassed, ch)
+	case ch.OldStatus == attemptPassed && ch.NewStatus == attemptFailed:
+		rg.NowFailed = append(rg.NowFailed, ch)
+	}
+}
+
+// runRegrade wraps regrade in a transaction and writes the response.
+func (h *GradingHandler) runRegrade(c *gin.Context, audit models.Regrade, scope regradeScope) {
+	var req RegradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Reason = req.Reason
+	if claims := auth.ClaimsFromContext(c); claims != nil && claims.UserID != 0 {
+		audit.RegradedBy = &claims.UserID
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := regrade(tx, audit, scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RegradeQuestion regrades every submitted answer to a question, on any
+// exam, after its key or points changed. Teachers may regrade questions of
+// their own exams; bank questions need an admin.
+func (h *GradingHandler) RegradeQuestion(c *gin.Context) {
+	questionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question id"})
+		return
+	}
+
+	var examID sql.NullInt64
+	err = h.DB.QueryRow(`SELECT exam_id FROM questions WHERE id = $1`, questionID).Scan(&examID)
+	if err == sql.ErrNoRows {
+		err = errQuestionNotFound
+	}
+	if err == nil {
+		ok := false
+		if examID.Valid {
+			ok, err = canGradeExam(h.DB, c, int(examID.Int64))
+		} else {
+			claims := auth.ClaimsFromContext(c)
+			ok = claims != nil && claims.Role == auth.RoleAdmin
+		}
+		if err == nil && !ok {
+			err = errNotExamTeacher
+		}
+	}
+	if err != nil {
+		c.JSON(gradingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.runRegrade(c, models.Regrade{QuestionID: &questionID}, regradeScope{
+		results: `EXISTS (SELECT 1 FROM answers WHERE exam_result_id = er.id AND question_id = $1)`,
+		answers: `a.question_id = $1`,
+		keys:    `vq.question_id = $1`,
+		args:    []interface{}{questionID},
+	})
+}
+
+// RegradeExam regrades every submitted result of an exam.
+func (h *GradingHandler) RegradeExam(c *gin.Context) {
+	examID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exam id"})
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM exams WHERE id = $1)`, examID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return
+	}
+	ok, err := canGradeExam(h.DB, c, examID)
+	if err == nil && !ok {
+		err = errNotExamTeacher
+	}
+	if err != nil {
+		c.JSON(gradingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.runRegrade(c, models.Regrade{ExamID: &examID}, regradeScope{
+		results: `er.exam_id = $1`,
+		answers: `er.exam_id = $1`,
+		keys:    `vq.version_id IN (SELECT id FROM exam_versions WHERE exam_id = $1)`,
+		args:    []interface{}{examID},
+	})
+}
+
+// GetExamRegrades lists the audit trail of regrades that touched an exam's
+// results, newest first, with each result's old and new score.
+func (h *GradingHandler) GetExamRegrades(c *gin.Context) {
+	rows, err := h.DB.Query(`
+		SELECT rg.id, rg.exam_id, rg.question_id, COALESCE(rg.reason, ''), rg.regraded_by, rg.created_at,
+		       rr.exam_result_id, er.exam_id, er.student_id, s.first_name || ' ' || s.last_name,
+		       rr.old_score, rr.new_score, rr.old_status, rr.new_status
+		FROM regrade_results rr
+		JOIN regrades rg ON rr.regrade_id = rg.id
+		JOIN exam_results er ON rr.exam_result_id = er.id
+		JOIN students s ON er.student_id = s.id
+		WHERE er.exam_id = $1
+		ORDER BY rg.created_at DESC, rg.id DESC, rr.exam_result_id
+	`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	regrades := []*models.Regrade{}
+	for rows.Next() {
+		var rg models.Regrade
+		var examID, questionID, regradedBy sql.NullInt64
+		var ch models.RegradeChange
+		if err := rows.Scan(&rg.ID, &examID, &questionID, &rg.Reason, &regradedBy, &rg.CreatedAt,
+			&ch.ExamResultID, &ch.ExamID, &ch.StudentID, &ch.StudentName,
+			&ch.OldScore, &ch.NewScore, &ch.OldStatus, &ch.NewStatus); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if n := len(regrades); n == 0 || regrades[n-1].ID != rg.ID {
+			rg.ExamID, rg.QuestionID, rg.RegradedBy = nullableInt(examID), nullableInt(questionID), nullableInt(regradedBy)
+			rg.Changes, rg.NowPassed, rg.NowFailed = []models.RegradeChange{}, []models.RegradeChange{}, []models.RegradeChange{}
+			regrades = append(regrades, &rg)
+		}
+		addRegradeChange(regrades[len(regrades)-1], ch)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, regrades)
+}
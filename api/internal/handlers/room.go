@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// equipmentAudio is the tag a room needs to host listening and speaking
+// exams.
+const equipmentAudio = "audio"
+
+var (
+	errRoomNotFound  = errors.New("room not found")
+	errRoomNameTaken = errors.New("room name already exists")
+	errRoomNameBlank = errors.New("room name cannot be blank")
+)
+
+type RoomHandler struct {
+	DB *sql.DB
+}
+
+func NewRoomHandler(db *sql.DB) *RoomHandler {
+	return &RoomHandler{DB: db}
+}
+
+const roomColumns = `id, name, COALESCE(building, ''), COALESCE(branch, ''), COALESCE(capacity, 0),
+	COALESCE(equipment, '[]'::jsonb), is_active, created_at, updated_at`
+
+func scanRoom(row interface{ Scan(...interface{}) error }, r *models.Room) error {
+	var equipment []byte
+	if err := row.Scan(&r.ID, &r.Name, &r.Building, &r.Branch, &r.Capacity, &equipment,
+		&r.IsActive, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return err
+	}
+	r.Equipment = []string{}
+	return json.Unmarshal(equipment, &r.Equipment)
+}
+
+// normalizeEquipment lower-cases, trims and de-duplicates equipment tags so
+// that containment checks are exact.
+func normalizeEquipment(tags []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// resolveRoom loads the room a booking references and copies its name into
+// the booking's free-text room, which conflict checks and calendar feeds
+// read. A nil roomID leaves the free-text room as given.
+func resolveRoom(db queryer, roomID *int, room *string) (*models.Room, error) {
+	if roomID == nil {
+		return nil, nil
+	}
+	var r models.Room
+	err := scanRoom(db.QueryRow(`SELECT `+roomColumns+` FROM rooms WHERE id = $1`, *roomID), &r)
+	if err == sql.ErrNoRows {
+		return nil, errRoomNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	*room = r.Name
+	return &r, nil
+}
+
+// roomFitIssues explains why a room is unsuitable for a booking of the given
+// number of seats that needs the given equipment. A room with no recorded
+// capacity is not checked for size.
+func roomFitIssues(r *models.Room, seats int, equipment []string) []string {
+	if r == nil {
+		return nil
+	}
+	var issues []string
+	if !r.IsActive {
+		issues = append(issues, fmt.Sprintf("room %s is not in use", r.Name))
+	}
+	if r.Capacity > 0 && seats > r.Capacity {
+		issues = append(issues, fmt.Sprintf("room %s seats %d but %d are needed", r.Name, r.Capacity, seats))
+	}
+	has := map[string]bool{}
+	for _, tag := range r.Equipment {
+		has[tag] = true
+	}
+	for _, tag := range equipment {
+		if !has[tag] {
+			issues = append(issues, fmt.Sprintf("room %s has no %s equipment", r.Name, tag))
+		}
+	}
+	return issues
+}
+
+func courseSeats(db queryer, courseID int) (int, error) {
+	var capacity int
+	err := db.QueryRow(`SELECT COALESCE(capacity, 0) FROM courses WHERE id = $1`, courseID).Scan(&capacity)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return capacity, err
+}
+
+// examEquipment lists the equipment an exam's questions need: audio for
+// speaking questions, any question with a recording, and blueprint sections
+// that draw speaking or listening questions.
+func examEquipment(db queryer, examID int) ([]string, error) {
+	if examID == 0 {
+		return nil, nil
+	}
+	var needsAudio bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM questions
+			WHERE exam_id = $1 AND (question_type = 'speaking' OR COALESCE(audio_url, '') <> '')
+		) OR EXISTS (
+			SELECT 1 FROM exam_blueprint_sections
+			WHERE exam_id = $1 AND (question_type = 'speaking' OR skill IN ('speaking', 'listening'))
+		)
+	`, examID).Scan(&needsAudio)
+	if err != nil || !needsAudio {
+		return nil, err
+	}
+	return []string{equipmentAudio}, nil
+}
+
+func (h *RoomHandler) GetRooms(c *gin.Context) {
+	query := `SELECT ` + roomColumns + ` FROM rooms`
+	var conditions []string
+	args := []interface{}{}
+	if branch := c.Query("branch"); branch != "" {
+		args = append(args, branch)
+		conditions = append(conditions, fmt.Sprintf("branch = $%d", len(args)))
+	}
+	if building := c.Query("building"); building != "" {
+		args = append(args, building)
+		conditions = append(conditions, fmt.Sprintf("building = $%d", len(args)))
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY branch, building, name"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var rooms []models.Room
+	for rows.Next() {
+		var r models.Room
+		if err := scanRoom(rows, &r); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		rooms = append(rooms, r)
+	}
+
+	c.JSON(http.StatusOK, rooms)
+}
+
+func (h *RoomHandler) GetRoom(c *gin.Context) {
+	id := c.Param("id")
+	var r models.Room
+	err := scanRoom(h.DB.QueryRow(`SELECT `+roomColumns+` FROM rooms WHERE id = $1`, id), &r)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+func (h *RoomHandler) CreateRoom(c *gin.Context) {
+	var r models.Room
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errRoomNameBlank.Error()})
+		return
+	}
+	r.Equipment = normalizeEquipment(r.Equipment)
+	r.IsActive = true
+	equipment, _ := json.Marshal(r.Equipment)
+
+	err := h.DB.QueryRow(`
+		INSERT INTO rooms (name, building, branch, capacity, equipment, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at
+	`, r.Name, r.Building, r.Branch, r.Capacity, string(equipment), r.IsActive).Scan(&r.ID, &r.CreatedAt, &r.UpdatedAt)
+
+	if isUniqueViolation(err, "idx_rooms_name") {
+		c.JSON(http.StatusConflict, gin.H{"error": errRoomNameTaken.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, r)
+}
+
+// UpdateRoom also renames the room on every class, series and exam booked
+// into it, so schedules and calendar feeds show the new name.
+func (h *RoomHandler) UpdateRoom(c *gin.Context) {
+	id := c.Param("id")
+	var r models.Room
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errRoomNameBlank.Error()})
+		return
+	}
+	r.Equipment = normalizeEquipment(r.Equipment)
+	equipment, _ := json.Marshal(r.Equipment)
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	err = scanRoom(tx.QueryRow(`
+		UPDATE rooms
+		SET name=$1, building=$2, branch=$3, capacity=$4, equipment=$5, is_active=$6, updated_at=CURRENT_TIMESTAMP
+		WHERE id=$7
+		RETURNING `+roomColumns,
+		r.Name, r.Building, r.Branch, r.Capacity, string(equipment), r.IsActive, id), &r)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	if isUniqueViolation(err, "idx_rooms_name") {
+		c.JSON(http.StatusConflict, gin.H{"error": errRoomNameTaken.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, table := range []string{"classes", "class_series", "exams"} {
+		if _, err := tx.Exec(`UPDATE `+table+` SET room = $1 WHERE room_id = $2`, r.Name, r.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+func (h *RoomHandler) DeleteRoom(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.DB.Exec("DELETE FROM rooms WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Room deleted successfully"})
+}
+
+// GetAvailableRooms lists active rooms that are free for the whole window
+// from start to end (or start plus duration minutes) and meet the optional
+// min_capacity, equipment (comma-separated tags) and branch filters.
+func (h *RoomHandler) GetAvailableRooms(c *gin.Context) {
+	start, err := time.Parse(time.RFC3339, c.Query("start"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start must be an RFC 3339 date-time"})
+		return
+	}
+	var end time.Time
+	if v := c.Query("end"); v != "" {
+		if end, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end must be an RFC 3339 date-time"})
+			return
+		}
+	} else {
+		end = scheduleSlot{Start: start, Duration: atoiDefault(c.Query("duration"), defaultDuration)}.end()
+	}
+	if !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end must be after start"})
+		return
+	}
+
+	minCapacity := atoiDefault(c.Query("min_capacity"), 0)
+	equipment, _ := json.Marshal(normalizeEquipment(strings.Split(c.Query("equipment"), ",")))
+
+	query := `
+		SELECT ` + roomColumns + `
+		FROM rooms r
+		WHERE r.is_active = TRUE
+		  AND COALESCE(r.capacity, 0) >= $3
+		  AND COALESCE(r.equipment, '[]'::jsonb) @> $4::jsonb
+		  AND NOT EXISTS (
+			SELECT 1 FROM classes c
+			WHERE c.cancelled_at IS NULL
+			  AND (c.room_id = r.id OR LOWER(TRIM(c.room)) = LOWER(r.name))
+			  AND c.class_date < $2
+			  AND c.class_date + COALESCE(NULLIF(c.duration, 0), $5) * INTERVAL '1 minute' > $1
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM exams e
+			WHERE e.start_date IS NOT NULL
+			  AND (e.room_id = r.id OR LOWER(TRIM(e.room)) = LOWER(r.name))
+			  AND e.start_date < $2
+			  AND e.start_date + COALESCE(NULLIF(e.duration, 0), $5) * INTERVAL '1 minute' > $1
+		  )`
+	args := []interface{}{start, end, minCapacity, string(equipment), defaultDuration}
+	if branch := c.Query("branch"); branch != "" {
+		args = append(args, branch)
+		query += fmt.Sprintf(" AND r.branch = $%d", len(args))
+	}
+	query += " ORDER BY r.capacity ASC, r.name ASC"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	rooms := []models.Room{}
+	for rows.Next() {
+		var r models.Room
+		if err := scanRoom(rows, &r); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		rooms = append(rooms, r)
+	}
+
+	c.JSON(http.StatusOK, rooms)
+}
+
+func atoiDefault(s string, def int) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return def
+}
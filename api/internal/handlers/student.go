@@ -3,6 +3,8 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"strconv"
+	"uedu-api/internal/auth"
 	"uedu-api/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -60,14 +62,32 @@ func (h *StudentHandler) GetStudent(c *gin.Context) {
 	c.JSON(http.StatusOK, s)
 }
 
+type CreateStudentRequest struct {
+	models.Student
+	CreateAccount bool `json:"create_account"` // provision a login and email an invite
+}
+
+type CreateStudentResponse struct {
+	models.Student
+	Account *models.User `json:"account,omitempty"`
+}
+
 func (h *StudentHandler) CreateStudent(c *gin.Context) {
-	var s models.Student
-	if err := c.ShouldBindJSON(&s); err != nil {
+	var req CreateStudentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	s := req.Student
 
-	err := h.DB.QueryRow(`
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
 		INSERT INTO students (first_name, last_name, email, phone, level) 
 		VALUES ($1, $2, $3, $4, $5) 
 		RETURNING id, enrolled_at, created_at, updated_at
@@ -78,18 +98,51 @@ func (h *StudentHandler) CreateStudent(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, s)
+	resp := CreateStudentResponse{Student: s}
+	var inviteToken string
+	if req.CreateAccount {
+		studentID := s.ID
+		account, token, err := insertUser(tx, CreateUserRequest{
+			Email:     s.Email,
+			Role:      auth.RoleStudent,
+			StudentID: &studentID,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		resp.Account = &account
+		inviteToken = token
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if inviteToken != "" {
+		if err := sendInviteEmail(s.Email, inviteToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Student created but invite email failed: " + err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, resp)
 }
 
 func (h *StudentHandler) UpdateStudent(c *gin.Context) {
-	id := c.Param("id")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
 	var s models.Student
 	if err := c.ShouldBindJSON(&s); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err := h.DB.Exec(`
+	_, err = h.DB.Exec(`
 		UPDATE students 
 		SET first_name=$1, last_name=$2, email=$3, phone=$4, level=$5, updated_at=CURRENT_TIMESTAMP 
 		WHERE id=$6
@@ -100,7 +153,7 @@ func (h *StudentHandler) UpdateStudent(c *gin.Context) {
 		return
 	}
 
-	s.ID, _ = c.Params.Get("id")
+	s.ID = id
 	c.JSON(http.StatusOK, s)
 }
 
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"uedu-api/internal/models"
+	"uedu-api/internal/skillprofile"
+
+	"github.com/gin-gonic/gin"
+)
+
+// untaggedSkill collects answers to questions with no skill tag whose type
+// does not imply one.
+const untaggedSkill = "general"
+
+// typeSkills are the skills implied by question types, for questions that
+// were never tagged.
+var typeSkills = map[string]string{
+	"reading_comprehension": "reading",
+	"writing":               "writing",
+	"speaking":              "speaking",
+}
+
+func answerSkill(skill, questionType string) string {
+	if skill != "" {
+		return skill
+	}
+	if s, ok := typeSkills[questionType]; ok {
+		return s
+	}
+	return untaggedSkill
+}
+
+// refreshStudentAnalytics rebuilds a student's analytics profile from their
+// submitted results and stores it. Every question delivered counts, with
+// unanswered ones as nothing earned; answers still waiting for a teacher
+// are left out until they are graded.
+func refreshStudentAnalytics(db readQueryerExecer, studentID int) (*models.StudentAnalytics, error) {
+	a := models.StudentAnalytics{StudentID: studentID}
+	err := db.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE status = $2), COUNT(*) FILTER (WHERE status = $3),
+		       COALESCE(AVG(score) FILTER (WHERE status IN ($2, $3)), 0)
+		FROM exam_results WHERE student_id = $1 AND status <> $4
+	`, studentID, attemptPassed, attemptFailed, attemptInProgress).Scan(&a.TotalExamsTaken, &a.TotalPasses,
+		&a.TotalFails, &a.AverageScore)
+	if err != nil {
+		return nil, err
+	}
+	a.AverageScore = math.Round(a.AverageScore*100) / 100
+
+	rows, err := db.Query(`
+		SELECT er.id, COALESCE(er.completed_at, er.started_at), COALESCE(q.skill, ''), COALESCE(q.question_type, ''),
+		       COALESCE(q.cefr_level, ''), COALESCE(a.points_earned, 0), COALESCE(q.points, 0)
+		FROM exam_results er
+		JOIN `+attemptQuestions+` ON TRUE
+		LEFT JOIN answers a ON a.exam_result_id = er.id AND a.question_id = q.id
+		WHERE er.student_id = $1 AND er.status <> $2
+		  AND (a.id IS NULL OR COALESCE(a.grading_status, 'auto') <> $3)
+	`, studentID, attemptInProgress, answerPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var answers []skillprofile.Answer
+	for rows.Next() {
+		var ans skillprofile.Answer
+		var questionType string
+		if err := rows.Scan(&ans.ResultID, &ans.CompletedAt, &ans.Skill, &questionType, &ans.Level,
+			&ans.Earned, &ans.Points); err != nil {
+			return nil, err
+		}
+		ans.Skill = answerSkill(ans.Skill, questionType)
+		answers = append(answers, ans)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	p := skillprofile.Build(answers, cefrLevels)
+	a.SkillBreakdown = p.Skills
+	a.LevelBreakdown = p.Levels
+	a.Weaknesses = p.Weaknesses
+	a.Strengths = p.Strengths
+	a.RecommendedLevel = p.RecommendedLevel
+
+	var encoded [4][]byte
+	for i, v := range []interface{}{a.SkillBreakdown, a.LevelBreakdown, a.Weaknesses, a.Strengths} {
+		if encoded[i], err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	err = db.QueryRow(`
+		INSERT INTO student_analytics (student_id, total_exams_taken, total_passes, total_fails, average_score,
+		                               skill_breakdown, level_breakdown, weaknesses, strengths, recommended_level,
+		                               last_updated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), CURRENT_TIMESTAMP)
+		ON CONFLICT (student_id) DO UPDATE SET
+			total_exams_taken = EXCLUDED.total_exams_taken, total_passes = EXCLUDED.total_passes,
+			total_fails = EXCLUDED.total_fails, average_score = EXCLUDED.average_score,
+			skill_breakdown = EXCLUDED.skill_breakdown, level_breakdown = EXCLUDED.level_breakdown,
+			weaknesses = EXCLUDED.weaknesses, strengths = EXCLUDED.strengths,
+			recommended_level = EXCLUDED.recommended_level, last_updated = EXCLUDED.last_updated
+		RETURNING id, last_updated
+	`, studentID, a.TotalExamsTaken, a.TotalPasses, a.TotalFails, a.AverageScore, string(encoded[0]),
+		string(encoded[1]), string(encoded[2]), string(encoded[3]), a.RecommendedLevel).Scan(&a.ID, &a.LastUpdated)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func scanStudentAnalytics(row interface{ Scan(...interface{}) error }, a *models.StudentAnalytics) error {
+	var skills, levels, weaknesses, strengths []byte
+	if err := row.Scan(&a.ID, &a.StudentID, &a.TotalExamsTaken, &a.TotalPasses, &a.TotalFails, &a.AverageScore,
+		&skills, &levels, &weaknesses, &strengths, &a.RecommendedLevel, &a.LastUpdated); err != nil {
+		return err
+	}
+	a.SkillBreakdown, a.LevelBreakdown, a.Weaknesses, a.Strengths =
+		[]models.SkillStat{}, []models.LevelStat{}, []string{}, []string{}
+	for _, f := range []struct {
+		raw  []byte
+		dest interface{}
+	}{{skills, &a.SkillBreakdown}, {levels, &a.LevelBreakdown}, {weaknesses, &a.Weaknesses}, {strengths, &a.Strengths}} {
+		if len(f.raw) > 0 {
+			if err := json.Unmarshal(f.raw, f.dest); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetStudentAnalytics returns a student's analytics profile. It is built on
+// the spot when missing or when refresh=true.
+func (h *StudentHandler) GetStudentAnalytics(c *gin.Context) {
+	studentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student id"})
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM students WHERE id = $1)`, studentID).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	var a models.StudentAnalytics
+	err = sql.ErrNoRows
+	if c.Query("refresh") != "true" {
+		err = scanStudentAnalytics(h.DB.QueryRow(`
+			SELECT id, student_id, COALESCE(total_exams_taken, 0), COALESCE(total_passes, 0), COALESCE(total_fails, 0),
+			       COALESCE(average_score, 0), skill_breakdown, level_breakdown, weaknesses, strengths,
+			       COALESCE(recommended_level, ''), last_updated
+			FROM student_analytics WHERE student_id = $1
+		`, studentID), &a)
+	}
+	if err == sql.ErrNoRows {
+		fresh, err := refreshStudentAnalytics(h.DB, studentID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, fresh)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, a)
+}
@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+	"uedu-api/internal/models"
+	"uedu-api/internal/recurrence"
+	"uedu-api/internal/timetable"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidTimetable = errors.New("invalid timetable request")
+
+type TimetableHandler struct {
+	DB *sql.DB
+}
+
+func NewTimetableHandler(db *sql.DB) *TimetableHandler {
+	return &TimetableHandler{DB: db}
+}
+
+type TimetableCourse struct {
+	CourseID        int  `json:"course_id" binding:"required"`
+	SessionsPerWeek int  `json:"sessions_per_week" binding:"required,min=1"`
+	Duration        int  `json:"duration"` // minutes, default 60
+	RoomID          *int `json:"room_id"`  // pin the course to one room
+}
+
+type TeacherAvailability struct {
+	TeacherID int    `json:"teacher_id" binding:"required"`
+	Weekday   string `json:"weekday" binding:"required"` // MO, TU, ...
+	Start     string `json:"start" binding:"required"`   // HH:MM
+	End       string `json:"end" binding:"required"`
+}
+
+type TimetableRequest struct {
+	TermStart           string                `json:"term_start" binding:"required"` // YYYY-MM-DD
+	TermEnd             string                `json:"term_end" binding:"required"`
+	Weekdays            []string              `json:"weekdays"`     // default MO-FR
+	DayStart            string                `json:"day_start"`    // default 08:00
+	DayEnd              string                `json:"day_end"`      // default 21:00
+	SlotMinutes         int                   `json:"slot_minutes"` // default 30
+	Courses             []TimetableCourse     `json:"courses" binding:"required,min=1,dive"`
+	TeacherAvailability []TeacherAvailability `json:"teacher_availability" binding:"dive"`
+	RoomIDs             []int                 `json:"room_ids"` // default all active rooms
+	BlackoutDates       []string              `json:"blackout_dates"`
+}
+
+type TimetableCommitRequest struct {
+	TimetableRequest
+	Fingerprint string `json:"fingerprint" binding:"required"`
+}
+
+type TimetableSlot struct {
+	CourseID   int    `json:"course_id"`
+	CourseName string `json:"course_name"`
+	TeacherID  int    `json:"teacher_id"`
+	RoomID     int    `json:"room_id"`
+	Room       string `json:"room"`
+	Weekday    string `json:"weekday"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+	Sessions   int    `json:"sessions"` // classes over the term after blackouts
+}
+
+type TimetableUnscheduled struct {
+	CourseID   int    `json:"course_id"`
+	CourseName string `json:"course_name"`
+	Sessions   int    `json:"sessions"` // weekly sessions that could not be placed
+	Reason     string `json:"reason"`
+}
+
+type TimetableProposal struct {
+	Slots             []TimetableSlot        `json:"slots"`
+	Classes           []models.Class         `json:"classes"`
+	Unscheduled       []TimetableUnscheduled `json:"unscheduled"`
+	TeacherGapMinutes int                    `json:"teacher_gap_minutes"`
+	RoomChanges       int                    `json:"room_changes"`
+	// Fingerprint identifies the proposal; commit only succeeds if solving
+	// again gives the same timetable.
+	Fingerprint string `json:"fingerprint"`
+}
+
+type timetableCourseInfo struct {
+	Name      string
+	TeacherID int
+	Capacity  int
+}
+
+// timetableInput is everything a proposal is built from.
+type timetableInput struct {
+	problem timetable.Problem
+	courses map[int]timetableCourseInfo
+	rooms   map[int]models.Room
+}
+
+func parseClock(value, fallback string) (int, error) {
+	if value == "" {
+		value = fallback
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a HH:MM time", errInvalidTimetable, value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// parseTimetableRequest validates the request and fills in the parts of the
+// problem that do not need the database.
+func parseTimetableRequest(req TimetableRequest) (timetable.Problem, error) {
+	var p timetable.Problem
+	var err error
+
+	if p.TermStart, err = time.Parse("2006-01-02", req.TermStart); err != nil {
+		return p, fmt.Errorf("%w: term_start must be YYYY-MM-DD", errInvalidTimetable)
+	}
+	if p.TermEnd, err = time.Parse("2006-01-02", req.TermEnd); err != nil {
+		return p, fmt.Errorf("%w: term_end must be YYYY-MM-DD", errInvalidTimetable)
+	}
+	if p.TermEnd.Before(p.TermStart) {
+		return p, fmt.Errorf("%w: term_end is before term_start", errInvalidTimetable)
+	}
+	if weeks := p.TermEnd.Sub(p.TermStart).Hours() / 24 / 7; weeks > float64(recurrence.MaxOccurrences) {
+		return p, fmt.Errorf("%w: term is too long", errInvalidTimetable)
+	}
+
+	weekdays := req.Weekdays
+	if len(weekdays) == 0 {
+		weekdays = []string{"MO", "TU", "WE", "TH", "FR"}
+	}
+	for _, code := range weekdays {
+		day, err := recurrence.ParseWeekday(code)
+		if err != nil {
+			return p, fmt.Errorf("%w: %v", errInvalidTimetable, err)
+		}
+		p.Weekdays = append(p.Weekdays, day)
+	}
+
+	if p.DayStart, err = parseClock(req.DayStart, "08:00"); err != nil {
+		return p, err
+	}
+	if p.DayEnd, err = parseClock(req.DayEnd, "21:00"); err != nil {
+		return p, err
+	}
+	if p.DayEnd <= p.DayStart {
+		return p, fmt.Errorf("%w: day_end must be after day_start", errInvalidTimetable)
+	}
+	p.Step = req.SlotMinutes
+	if p.Step <= 0 {
+		p.Step = 30
+	}
+
+	p.Availability = map[int][]timetable.Window{}
+	for _, a := range req.TeacherAvailability {
+		day, err := recurrence.ParseWeekday(a.Weekday)
+		if err != nil {
+			return p, fmt.Errorf("%w: %v", errInvalidTimetable, err)
+		}
+		start, err := parseClock(a.Start, "")
+		if err != nil {
+			return p, err
+		}
+		end, err := parseClock(a.End, "")
+		if err != nil {
+			return p, err
+		}
+		p.Availability[a.TeacherID] = append(p.Availability[a.TeacherID], timetable.Window{Weekday: day, Start: start, End: end})
+	}
+
+	p.Blackouts = map[string]bool{}
+	for _, d := range req.BlackoutDates {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return p, fmt.Errorf("%w: blackout date %q must be YYYY-MM-DD", errInvalidTimetable, d)
+		}
+		p.Blackouts[d] = true
+	}
+	return p, nil
+}
+
+// loadTimetableInput reads the courses, rooms and existing bookings the
+// solver needs.
+func loadTimetableInput(db readQueryer, req TimetableRequest) (timetableInput, error) {
+	in := timetableInput{courses: map[int]timetableCourseInfo{}, rooms: map[int]models.Room{}}
+	p, err := parseTimetableRequest(req)
+	if err != nil {
+		return in, err
+	}
+
+	seen := map[int]bool{}
+	wanted := map[int]bool{}
+	for _, id := range req.RoomIDs {
+		wanted[id] = true
+	}
+	for _, tc := range req.Courses {
+		if seen[tc.CourseID] {
+			return in, fmt.Errorf("%w: course %d is listed twice", errInvalidTimetable, tc.CourseID)
+		}
+		seen[tc.CourseID] = true
+
+		var info timetableCourseInfo
+		var teacherID sql.NullInt64
+		err := db.QueryRow(`SELECT name, teacher_id, COALESCE(capacity, 0) FROM courses WHERE id = $1`, tc.CourseID).
+			Scan(&info.Name, &teacherID, &info.Capacity)
+		if err == sql.ErrNoRows {
+			return in, fmt.Errorf("%w: course %d not found", errInvalidTimetable, tc.CourseID)
+		}
+		if err != nil {
+			return in, err
+		}
+		if !teacherID.Valid {
+			return in, fmt.Errorf("%w: course %d has no teacher", errInvalidTimetable, tc.CourseID)
+		}
+		info.TeacherID = int(teacherID.Int64)
+		in.courses[tc.CourseID] = info
+
+		duration := tc.Duration
+		if duration <= 0 {
+			duration = defaultDuration
+		}
+		course := timetable.Course{
+			ID:              tc.CourseID,
+			TeacherID:       info.TeacherID,
+			Seats:           info.Capacity,
+			SessionsPerWeek: tc.SessionsPerWeek,
+			Duration:        duration,
+		}
+		if tc.RoomID != nil {
+			course.RoomID = *tc.RoomID
+			if len(wanted) > 0 {
+				wanted[*tc.RoomID] = true
+			}
+		}
+		p.Courses = append(p.Courses, course)
+	}
+
+	rows, err := db.Query(`SELECT ` + roomColumns + ` FROM rooms WHERE is_active = TRUE ORDER BY id`)
+	if err != nil {
+		return in, err
+	}
+	defer rows.Close()
+	roomByName := map[string]int{}
+	for rows.Next() {
+		var r models.Room
+		if err := scanRoom(rows, &r); err != nil {
+			return in, err
+		}
+		roomByName[normalizeRoom(r.Name)] = r.ID
+		if len(wanted) > 0 && !wanted[r.ID] {
+			continue
+		}
+		in.rooms[r.ID] = r
+		p.Rooms = append(p.Rooms, timetable.Room{ID: r.ID, Capacity: r.Capacity})
+	}
+	if err := rows.Err(); err != nil {
+		return in, err
+	}
+	for _, c := range p.Courses {
+		if _, ok := in.rooms[c.RoomID]; c.RoomID != 0 && !ok {
+			return in, fmt.Errorf("%w: room %d is not an active room", errInvalidTimetable, c.RoomID)
+		}
+	}
+
+	p.TeacherBusy, p.RoomBusy, err = loadBookings(db, p.TermStart, p.TermEnd.AddDate(0, 0, 1), roomByName)
+	if err != nil {
+		return in, err
+	}
+
+	in.problem = p
+	return in, nil
+}
+
+// loadBookings returns the classes and exam sittings between from and to as
+// busy intervals per teacher and per room. Bookings made with a free-text
+// room are matched to rooms by name, as findConflicts does.
+func loadBookings(db queryerRows, from, to time.Time, roomByName map[string]int) (map[int][]timetable.Interval, map[int][]timetable.Interval, error) {
+	teacherBusy := map[int][]timetable.Interval{}
+	roomBusy := map[int][]timetable.Interval{}
+
+	rows, err := db.Query(`
+		SELECT COALESCE(teacher_id, 0), COALESCE(room_id, 0), COALESCE(room, ''), class_date,
+		       COALESCE(NULLIF(duration, 0), $3)
+		FROM classes
+		WHERE cancelled_at IS NULL AND class_date < $2
+		  AND class_date + COALESCE(NULLIF(duration, 0), $3) * INTERVAL '1 minute' > $1
+		UNION ALL
+		SELECT 0, COALESCE(room_id, 0), COALESCE(room, ''), start_date,
+		       COALESCE(NULLIF(duration, 0), $3)
+		FROM exams
+		WHERE start_date IS NOT NULL AND start_date < $2
+		  AND start_date + COALESCE(NULLIF(duration, 0), $3) * INTERVAL '1 minute' > $1
+	`, from, to, defaultDuration)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teacherID, roomID, duration int
+		var room string
+		var start time.Time
+		if err := rows.Scan(&teacherID, &roomID, &room, &start, &duration); err != nil {
+			return nil, nil, err
+		}
+		busy := timetable.Interval{Start: start, End: start.Add(time.Duration(duration) * time.Minute)}
+		if teacherID != 0 {
+			teacherBusy[teacherID] = append(teacherBusy[teacherID], busy)
+		}
+		if roomID == 0 && room != "" {
+			roomID = roomByName[normalizeRoom(room)]
+		}
+		if roomID != 0 {
+			roomBusy[roomID] = append(roomBusy[roomID], busy)
+		}
+	}
+	return teacherBusy, roomBusy, rows.Err()
+}
+
+// buildProposal solves the problem and expands the weekly slots into the
+// classes that committing would create.
+func buildProposal(in timetableInput) (TimetableProposal, timetable.Solution) {
+	sol := timetable.Solve(in.problem)
+	proposal := TimetableProposal{
+		Slots:             []TimetableSlot{},
+		Classes:           []models.Class{},
+		Unscheduled:       []TimetableUnscheduled{},
+		TeacherGapMinutes: sol.TeacherGapMinutes,
+		RoomChanges:       sol.RoomChanges,
+	}
+
+	hash := sha256.New()
+	for _, slot := range sol.Slots {
+		course, room := in.courses[slot.CourseID], in.rooms[slot.RoomID]
+		roomID := slot.RoomID
+		dates := in.problem.Dates(slot)
+		proposal.Slots = append(proposal.Slots, TimetableSlot{
+			CourseID:   slot.CourseID,
+			CourseName: course.Name,
+			TeacherID:  slot.TeacherID,
+			RoomID:     slot.RoomID,
+			Room:       room.Name,
+			Weekday:    recurrence.WeekdayCode(slot.Weekday),
+			StartTime:  formatClock(slot.Start),
+			EndTime:    formatClock(slot.End()),
+			Sessions:   len(dates),
+		})
+		for _, d := range dates {
+			proposal.Classes = append(proposal.Classes, models.Class{
+				CourseID:  slot.CourseID,
+				TeacherID: slot.TeacherID,
+				Title:     course.Name,
+				ClassDate: timetable.At(d, slot.Start),
+				Duration:  slot.Duration,
+				Room:      room.Name,
+				RoomID:    &roomID,
+			})
+		}
+		fmt.Fprintln(hash, slot.String())
+	}
+	sort.Slice(proposal.Classes, func(i, j int) bool {
+		return proposal.Classes[i].ClassDate.Before(proposal.Classes[j].ClassDate)
+	})
+
+	for _, u := range sol.Unscheduled {
+		proposal.Unscheduled = append(proposal.Unscheduled, TimetableUnscheduled{
+			CourseID:   u.CourseID,
+			CourseName: in.courses[u.CourseID].Name,
+			Sessions:   u.Sessions,
+			Reason:     u.Reason,
+		})
+		fmt.Fprintf(hash, "unscheduled:%d:%d\n", u.CourseID, u.Sessions)
+	}
+	proposal.Fingerprint = hex.EncodeToString(hash.Sum(nil))
+	return proposal, sol
+}
+
+func timetableErrorStatus(err error) int {
+	if errors.Is(err, errInvalidTimetable) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// PreviewTimetable solves the term timetable without saving anything.
+func (h *TimetableHandler) PreviewTimetable(c *gin.Context) {
+	var req TimetableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	in, err := loadTimetableInput(h.DB, req)
+	if err != nil {
+		c.JSON(timetableErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	proposal, _ := buildProposal(in)
+	c.JSON(http.StatusOK, proposal)
+}
+
+// CommitTimetable solves the request again inside one transaction and, if
+// the result still matches the previewed fingerprint, saves each weekly slot
+// as a class series (blackout dates become exception dates) together with
+// its classes.
+func (h *TimetableHandler) CommitTimetable(c *gin.Context) {
+	var req TimetableCommitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Keep other writers from booking classes between the check and insert.
+	if _, err := tx.Exec(`LOCK TABLE classes IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	in, err := loadTimetableInput(tx, req.TimetableRequest)
+	if err != nil {
+		c.JSON(timetableErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	proposal, sol := buildProposal(in)
+	if proposal.Fingerprint != req.Fingerprint {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "The schedule changed since the preview; preview the timetable again",
+			"proposal": proposal,
+		})
+		return
+	}
+
+	until := in.problem.TermEnd.Add(24*time.Hour - time.Second)
+	var series []models.ClassSeries
+	created := 0
+	for _, slot := range sol.Slots {
+		course, room := in.courses[slot.CourseID], in.rooms[slot.RoomID]
+		rule := recurrence.Rule{Interval: 1, ByWeekday: []time.Weekday{slot.Weekday}, Until: &until}
+
+		roomID := slot.RoomID
+		s := models.ClassSeries{
+			CourseID:       slot.CourseID,
+			TeacherID:      slot.TeacherID,
+			Title:          course.Name,
+			Duration:       slot.Duration,
+			Room:           room.Name,
+			RoomID:         &roomID,
+			RRule:          rule.String(),
+			ExceptionDates: []string{},
+		}
+		first := in.problem.FirstDate(slot.Weekday)
+		s.StartsAt = timetable.At(first, slot.Start)
+		for d := first; !d.After(in.problem.TermEnd); d = d.AddDate(0, 0, 7) {
+			if key := recurrence.DateKey(d); in.problem.Blackouts[key] {
+				s.ExceptionDates = append(s.ExceptionDates, key)
+			}
+		}
+
+		if err := insertSeries(tx, &s); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		n, err := generateOccurrences(tx, s, rule, s.StartsAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		created += n
+		series = append(series, s)
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"series":          series,
+		"classes_created": created,
+		"unscheduled":     proposal.Unscheduled,
+	})
+}
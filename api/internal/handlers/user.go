@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"uedu-api/internal/auth"
+	"uedu-api/internal/mailer"
+	"uedu-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tokenPurposeReset  = "password_reset"
+	tokenPurposeInvite = "invite"
+)
+
+type UserHandler struct {
+	DB *sql.DB
+}
+
+func NewUserHandler(db *sql.DB) *UserHandler {
+	return &UserHandler{DB: db}
+}
+
+type CreateUserRequest struct {
+	Email     string `json:"email" binding:"required,email"`
+	Role      string `json:"role" binding:"required"`
+	Password  string `json:"password"` // leave empty to send an invite instead
+	StudentID *int   `json:"student_id"`
+	TeacherID *int   `json:"teacher_id"`
+}
+
+type UpdateUserRequest struct {
+	Role      string `json:"role" binding:"required"`
+	IsActive  bool   `json:"is_active"`
+	StudentID *int   `json:"student_id"`
+	TeacherID *int   `json:"teacher_id"`
+}
+
+// validateAccountLink checks that an account points at exactly the profile
+// its role needs: students at a students row, teachers at a teachers row and
+// admins at neither.
+func validateAccountLink(role string, studentID, teacherID *int) error {
+	switch role {
+	case auth.RoleAdmin:
+		if studentID != nil || teacherID != nil {
+			return fmt.Errorf("admin accounts cannot be linked to a student or teacher")
+		}
+	case auth.RoleStudent:
+		if studentID == nil || teacherID != nil {
+			return fmt.Errorf("student accounts must be linked to a student_id only")
+		}
+	case auth.RoleTeacher:
+		if teacherID == nil || studentID != nil {
+			return fmt.Errorf("teacher accounts must be linked to a teacher_id only")
+		}
+	default:
+		return fmt.Errorf("role must be one of admin, teacher, student")
+	}
+	return nil
+}
+
+// createAccountToken stores a hashed single-use token for password resets
+// and invitations and returns the raw value to put in the emailed link.
+func createAccountToken(db execer, userID int, purpose string, ttl time.Duration) (string, error) {
+	raw, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO account_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, purpose, hash, time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+func appURL() string {
+	if url := os.Getenv("APP_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:3002"
+}
+
+func sendPasswordResetEmail(email, token string) error {
+	body := fmt.Sprintf("We received a request to reset your uEdu password.\n\n"+
+		"Open the link below within %d minutes to choose a new password:\n%s/reset-password?token=%s\n\n"+
+		"If you did not ask for this, you can ignore this email.",
+		int(auth.PasswordResetTTL.Minutes()), appURL(), token)
+	return mailer.Send(email, "Reset your uEdu password", body)
+}
+
+func sendInviteEmail(email, token string) error {
+	body := fmt.Sprintf("You have been invited to uEdu.\n\n"+
+		"Open the link below within %d days to set your password:\n%s/accept-invite?token=%s",
+		int(auth.InviteTTL.Hours()/24), appURL(), token)
+	return mailer.Send(email, "Your uEdu account", body)
+}
+
+// insertUser creates an account. An empty password leaves the account in the
+// invite-pending state and returns the invite token to email.
+func insertUser(db queryerExecer, req CreateUserRequest) (models.User, string, error) {
+	var u models.User
+	var hash sql.NullString
+	if req.Password != "" {
+		if err := auth.ValidatePassword(req.Password); err != nil {
+			return u, "", err
+		}
+		h, err := auth.HashPassword(req.Password)
+		if err != nil {
+			return u, "", err
+		}
+		hash = sql.NullString{String: h, Valid: true}
+	}
+
+	err := scanUser(db.QueryRow(`
+		INSERT INTO users (email, password_hash, role, student_id, teacher_id)
+		VALUES (LOWER($1), $2, $3, $4, $5)
+		RETURNING `+userColumns,
+		strings.TrimSpace(req.Email), hash, req.Role, req.StudentID, req.TeacherID), &u)
+	if err != nil {
+		return u, "", err
+	}
+
+	if hash.Valid {
+		return u, "", nil
+	}
+	token, err := createAccountToken(db, u.ID, tokenPurposeInvite, auth.InviteTTL)
+	return u, token, err
+}
+
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	query := `SELECT ` + userColumns + ` FROM users`
+	args := []interface{}{}
+	if role := c.Query("role"); role != "" {
+		query += ` WHERE role = $1`
+		args = append(args, role)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := scanUser(rows, &u); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		users = append(users, u)
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func (h *UserHandler) GetUser(c *gin.Context) {
+	id := c.Param("id")
+	var u models.User
+	err := scanUser(h.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id), &u)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAccountLink(req.Role, req.StudentID, req.TeacherID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	u, inviteToken, err := insertUser(tx, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if inviteToken != "" {
+		if err := sendInviteEmail(u.Email, inviteToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Account created but invite email failed: " + err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, u)
+}
+
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	id := c.Param("id")
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAccountLink(req.Role, req.StudentID, req.TeacherID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var u models.User
+	err := scanUser(h.DB.QueryRow(`
+		UPDATE users
+		SET role=$1, is_active=$2, student_id=$3, teacher_id=$4, updated_at=CURRENT_TIMESTAMP
+		WHERE id=$5
+		RETURNING `+userColumns,
+		req.Role, req.IsActive, req.StudentID, req.TeacherID, id), &u)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !u.IsActive {
+		if _, err := h.DB.Exec(`
+			UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND revoked_at IS NULL
+		`, u.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.DB.Exec("DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.DB.Exec(`
+		UPDATE users SET failed_login_attempts = 0, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
+
+// ResendInvite issues a fresh invite link for an account that has not set a
+// password yet. Earlier invite links stay valid until they expire.
+func (h *UserHandler) ResendInvite(c *gin.Context) {
+	id := c.Param("id")
+	var u models.User
+	err := scanUser(h.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id), &u)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !u.InvitePending {
+		c.JSON(http.StatusConflict, gin.H{"error": "User has already set a password"})
+		return
+	}
+
+	token, err := createAccountToken(h.DB, u.ID, tokenPurposeInvite, auth.InviteTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := sendInviteEmail(u.Email, token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite sent successfully"})
+}
@@ -0,0 +1,192 @@
+// Package ical writes RFC 5545 iCalendar feeds.
+package ical
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	localLayout = "20060102T150405"
+	utcLayout   = "20060102T150405Z"
+	// lineLimit is the maximum line length in octets, excluding CRLF.
+	lineLimit = 75
+)
+
+type Status string
+
+const (
+	StatusConfirmed Status = "CONFIRMED"
+	StatusCancelled Status = "CANCELLED"
+)
+
+type Event struct {
+	UID          string
+	Summary      string
+	Description  string
+	Location     string
+	Start        time.Time // wall-clock time in the calendar's location
+	End          time.Time
+	Status       Status
+	LastModified time.Time
+}
+
+type Calendar struct {
+	Name     string
+	Location *time.Location
+	Events   []Event
+}
+
+// Write renders the calendar. Event times are written as local times with a
+// TZID that refers to a VTIMEZONE generated from the Go zone database for the
+// span of the events.
+func (cal Calendar) Write(w *strings.Builder) {
+	loc := cal.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	now := time.Now().UTC()
+
+	line(w, "BEGIN:VCALENDAR")
+	line(w, "VERSION:2.0")
+	line(w, "PRODID:-//uEdu//Schedule//EN")
+	line(w, "CALSCALE:GREGORIAN")
+	line(w, "METHOD:PUBLISH")
+	if cal.Name != "" {
+		line(w, "X-WR-CALNAME:"+escape(cal.Name))
+	}
+	line(w, "X-WR-TIMEZONE:"+loc.String())
+	from, to := cal.span(now)
+	writeTimezone(w, loc, from, to)
+
+	for _, e := range cal.Events {
+		status := e.Status
+		if status == "" {
+			status = StatusConfirmed
+		}
+		stamp := e.LastModified
+		if stamp.IsZero() {
+			stamp = now
+		}
+
+		line(w, "BEGIN:VEVENT")
+		line(w, "UID:"+escape(e.UID))
+		line(w, "DTSTAMP:"+stamp.UTC().Format(utcLayout))
+		line(w, "LAST-MODIFIED:"+stamp.UTC().Format(utcLayout))
+		line(w, fmt.Sprintf("DTSTART;TZID=%s:%s", loc.String(), inLocation(e.Start, loc).Format(localLayout)))
+		line(w, fmt.Sprintf("DTEND;TZID=%s:%s", loc.String(), inLocation(e.End, loc).Format(localLayout)))
+		line(w, "SUMMARY:"+escape(e.Summary))
+		if e.Description != "" {
+			line(w, "DESCRIPTION:"+escape(e.Description))
+		}
+		if e.Location != "" {
+			line(w, "LOCATION:"+escape(e.Location))
+		}
+		line(w, "STATUS:"+string(status))
+		line(w, "END:VEVENT")
+	}
+
+	line(w, "END:VCALENDAR")
+}
+
+// inLocation reinterprets a wall-clock time as being in loc. Times read from
+// TIMESTAMP columns carry no zone, so their clock reading is what counts.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+}
+
+func (cal Calendar) span(now time.Time) (time.Time, time.Time) {
+	from, to := now, now
+	for _, e := range cal.Events {
+		if e.Start.Before(from) {
+			from = e.Start
+		}
+		if e.End.After(to) {
+			to = e.End
+		}
+	}
+	return from.AddDate(-1, 0, 0), to.AddDate(1, 0, 0)
+}
+
+// writeTimezone emits a VTIMEZONE with one observance per UTC offset change
+// between from and to, found with time.ZoneBounds.
+func writeTimezone(w *strings.Builder, loc *time.Location, from, to time.Time) {
+	from, to = from.In(loc), to.In(loc)
+
+	line(w, "BEGIN:VTIMEZONE")
+	line(w, "TZID:"+loc.String())
+
+	name, offset := from.Zone()
+	start, end := from.ZoneBounds()
+	if start.IsZero() {
+		start = from // fixed zones have no transitions
+	}
+	_, prevOffset := start.Add(-time.Second).Zone()
+	observance(w, from.IsDST(), start.In(loc), name, prevOffset, offset)
+
+	for !end.IsZero() && end.Before(to) {
+		t := end.In(loc)
+		name, next := t.Zone()
+		observance(w, t.IsDST(), t, name, offset, next)
+		offset = next
+		_, end = t.ZoneBounds()
+	}
+
+	line(w, "END:VTIMEZONE")
+}
+
+func observance(w *strings.Builder, dst bool, start time.Time, name string, from, to int) {
+	kind := "STANDARD"
+	if dst {
+		kind = "DAYLIGHT"
+	}
+	// DTSTART of an observance is the local time in the offset being left.
+	local := start.UTC().Add(time.Duration(from) * time.Second)
+
+	line(w, "BEGIN:"+kind)
+	line(w, "DTSTART:"+local.Format(localLayout))
+	line(w, "TZOFFSETFROM:"+formatOffset(from))
+	line(w, "TZOFFSETTO:"+formatOffset(to))
+	if name != "" {
+		line(w, "TZNAME:"+escape(name))
+	}
+	line(w, "END:"+kind)
+}
+
+func formatOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// escape applies TEXT value escaping.
+func escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\r\n", `\n`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return s
+}
+
+// line writes a content line folded at 75 octets without splitting UTF-8
+// sequences, terminated by CRLF.
+func line(w *strings.Builder, s string) {
+	limit := lineLimit
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		limit = lineLimit - 1 // continuation lines start with a space
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
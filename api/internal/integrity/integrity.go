@@ -0,0 +1,114 @@
+// Package integrity scores how suspicious an exam attempt looks from the
+// events the student app reports while it runs. The score is a guide for a
+// proctor's review, not a verdict: every point it adds can be traced to a
+// reason.
+package integrity
+
+import "fmt"
+
+// Event types the student app reports.
+const (
+	TabSwitch      = "tab_switch"
+	FocusLost      = "focus_lost" // DurationMs is how long the exam was out of view
+	Paste          = "paste"
+	Copy           = "copy"
+	DevTools       = "devtools"
+	ContextMenu    = "context_menu"
+	FullscreenExit = "fullscreen_exit"
+)
+
+// EventTypes lists every event type the API accepts.
+var EventTypes = []string{TabSwitch, FocusLost, Paste, Copy, DevTools, ContextMenu, FullscreenExit}
+
+// Known reports whether t is an accepted event type.
+func Known(t string) bool {
+	for _, known := range EventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts summarises the events of one attempt.
+type Counts struct {
+	TabSwitches      int
+	FocusLostSeconds int
+	PasteAttempts    int
+	CopyAttempts     int
+	DevToolsAttempts int
+	IPChanges        int // times the client address changed during the attempt
+	OtherEvents      int // context menus and leaving full screen
+}
+
+// FlagThreshold is the score at which an attempt is flagged for review.
+const FlagThreshold = 40
+
+// MaxScore caps the score.
+const MaxScore = 100
+
+// A weight adds points per occurrence, up to a cap so that one noisy
+// signal cannot flag an attempt on its own unless it is serious.
+type weight struct {
+	points, max int
+}
+
+var (
+	tabSwitchWeight = weight{8, 40}
+	focusWeight     = weight{1, 30} // per started 10 seconds out of view
+	pasteWeight     = weight{15, 45}
+	copyWeight      = weight{5, 15}
+	devToolsWeight  = weight{10, 30}
+	ipChangeWeight  = weight{25, 50}
+	otherWeight     = weight{2, 10}
+)
+
+func (w weight) score(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if s := n * w.points; s < w.max {
+		return s
+	}
+	return w.max
+}
+
+// Assess returns the attempt's risk score from 0 to MaxScore, whether it is
+// flagged, and the reasons behind each contribution.
+func Assess(c Counts) (score int, flagged bool, reasons []string) {
+	reasons = []string{}
+	add := func(w weight, n int, reason string) {
+		if s := w.score(n); s > 0 {
+			score += s
+			reasons = append(reasons, fmt.Sprintf("%s (+%d)", reason, s))
+		}
+	}
+	add(tabSwitchWeight, c.TabSwitches, fmt.Sprintf("%d tab switches", c.TabSwitches))
+	add(focusWeight, (c.FocusLostSeconds+9)/10, fmt.Sprintf("%ds out of focus", c.FocusLostSeconds))
+	add(pasteWeight, c.PasteAttempts, fmt.Sprintf("%d paste attempts", c.PasteAttempts))
+	add(copyWeight, c.CopyAttempts, fmt.Sprintf("%d copy attempts", c.CopyAttempts))
+	add(devToolsWeight, c.DevToolsAttempts, fmt.Sprintf("%d developer tools attempts", c.DevToolsAttempts))
+	add(ipChangeWeight, c.IPChanges, fmt.Sprintf("%d IP address changes", c.IPChanges))
+	add(otherWeight, c.OtherEvents, fmt.Sprintf("%d other events", c.OtherEvents))
+	if score > MaxScore {
+		score = MaxScore
+	}
+	return score, score >= FlagThreshold, reasons
+}
+
+// IPChanges counts the changes in a sequence of client addresses in the
+// order they were seen. Empty addresses are skipped.
+func IPChanges(addresses []string) int {
+	changes := 0
+	last := ""
+	for _, a := range addresses {
+		if a == "" {
+			continue
+		}
+		if last != "" && a != last {
+			changes++
+		}
+		last = a
+	}
+	return changes
+}
@@ -0,0 +1,420 @@
+// Package irt calibrates item parameters from scored responses by marginal
+// maximum likelihood, fitted with EM over a fixed quadrature (Bock and
+// Aitkin). Abilities are taken to be standard normal, which fixes the scale
+// the adaptive test engine reads the parameters on. It also reports how
+// well each item fits the model and flags the ones that do not.
+package irt
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"uedu-api/internal/models"
+)
+
+// Models that can be calibrated.
+const (
+	ModelRasch = "rasch"
+	Model2PL   = "2pl"
+)
+
+// Item statuses in a calibration.
+const (
+	StatusCalibrated = "calibrated"
+	StatusTooFew     = "too_few" // fewer responses than the minimum
+	StatusExtreme    = "extreme" // every response right, or every one wrong
+)
+
+// Items fit when their infit and outfit mean squares fall in this range;
+// 2PL items must also discriminate at least minDiscrimination.
+const (
+	minFit            = 0.5
+	maxFit            = 1.5
+	minDiscrimination = 0.3
+)
+
+// Bounds keep estimates for items with little information finite. An item
+// that discriminates the wrong way, such as one with a wrong key, ends at
+// the lowest discrimination and is flagged.
+const (
+	minA, maxA = 0.05, 4.0
+	maxAbsB    = 6.0
+)
+
+const (
+	quadMin, quadMax = -4.0, 4.0
+	quadPoints       = 41
+	newtonSteps      = 10
+	halvings         = 10
+)
+
+// Response is one scored response of a respondent to an item.
+type Response struct {
+	Respondent int
+	Item       int
+	Correct    bool
+}
+
+// Options control a calibration.
+type Options struct {
+	Model         string
+	MinResponses  int
+	MaxIterations int
+	Tolerance     float64 // largest parameter change at which EM has converged
+}
+
+// Result is what a calibration produced. Items are in id order.
+type Result struct {
+	Items         []models.ItemCalibration
+	Respondents   int
+	Responses     int
+	Iterations    int
+	Converged     bool
+	LogLikelihood float64
+}
+
+type param struct{ a, b float64 }
+
+func prob(theta float64, p param) float64 {
+	return 1 / (1 + math.Exp(-p.a*(theta-p.b)))
+}
+
+// Calibrate estimates the parameters of every item with enough responses
+// that are not all alike. Under Rasch every discrimination is 1.
+func Calibrate(responses []Response, opts Options) Result {
+	if opts.MaxIterations <= 0 {
+		opts.MaxIterations = 500
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = 1e-4
+	}
+
+	type tally struct{ n, correct int }
+	counts := map[int]*tally{}
+	for _, r := range responses {
+		if counts[r.Item] == nil {
+			counts[r.Item] = &tally{}
+		}
+		counts[r.Item].n++
+		if r.Correct {
+			counts[r.Item].correct++
+		}
+	}
+	ids := make([]int, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var result Result
+	index := map[int]int{}
+	var params []param
+	for _, id := range ids {
+		t := counts[id]
+		st := models.ItemCalibration{QuestionID: id, Responses: t.n, PValue: round(float64(t.correct)/float64(t.n), 4)}
+		switch {
+		case t.n < opts.MinResponses:
+			st.Status = StatusTooFew
+		case t.correct == 0 || t.correct == t.n:
+			st.Status = StatusExtreme
+		default:
+			st.Status = StatusCalibrated
+			index[id] = len(params)
+			// Start from the logit of the proportion wrong.
+			p := float64(t.correct) / float64(t.n)
+			params = append(params, param{a: 1, b: clamp(math.Log((1-p)/p), -maxAbsB, maxAbsB)})
+		}
+		result.Items = append(result.Items, st)
+	}
+
+	// Group the responses to calibrated items by respondent, in a fixed
+	// order so sums always come out the same.
+	byRespondent := map[int][]Response{}
+	for _, r := range responses {
+		if _, ok := index[r.Item]; ok {
+			byRespondent[r.Respondent] = append(byRespondent[r.Respondent], r)
+		}
+	}
+	respondents := make([]int, 0, len(byRespondent))
+	for id := range byRespondent {
+		respondents = append(respondents, id)
+		result.Responses += len(byRespondent[id])
+	}
+	sort.Ints(respondents)
+	result.Respondents = len(respondents)
+	if len(params) == 0 {
+		result.Converged = true
+		return result
+	}
+
+	nodes, weights := quadrature()
+	n := make([][]float64, len(params))
+	r := make([][]float64, len(params))
+	for i := range params {
+		n[i] = make([]float64, len(nodes))
+		r[i] = make([]float64, len(nodes))
+	}
+	probs := make([][]float64, len(params))
+	for i := range params {
+		probs[i] = make([]float64, len(nodes))
+	}
+	posterior := make([]float64, len(nodes))
+
+	// likelihoods fills posterior with the weight of each node times the
+	// likelihood of the respondent's responses there, and returns the sum.
+	// probs must hold every item's probabilities at the nodes.
+	likelihoods := func(id int) float64 {
+		total := 0.0
+		for q := range nodes {
+			l := weights[q]
+			for _, resp := range byRespondent[id] {
+				p := probs[index[resp.Item]][q]
+				if resp.Correct {
+					l *= p
+				} else {
+					l *= 1 - p
+				}
+			}
+			posterior[q] = l
+			total += l
+		}
+		return total
+	}
+
+	// estep spreads each respondent over the quadrature nodes by their
+	// posterior and returns the marginal log-likelihood.
+	estep := func() float64 {
+		for i, p := range params {
+			for q, theta := range nodes {
+				probs[i][q] = prob(theta, p)
+				n[i][q], r[i][q] = 0, 0
+			}
+		}
+		logLike := 0.0
+		for _, id := range respondents {
+			total := likelihoods(id)
+			if total <= 0 {
+				continue
+			}
+			logLike += math.Log(total)
+			for _, resp := range byRespondent[id] {
+				i := index[resp.Item]
+				for q := range nodes {
+					w := posterior[q] / total
+					n[i][q] += w
+					if resp.Correct {
+						r[i][q] += w
+					}
+				}
+			}
+		}
+		return logLike
+	}
+
+	for result.Iterations < opts.MaxIterations {
+		result.Iterations++
+		result.LogLikelihood = estep()
+		change := 0.0
+		for i := range params {
+			next := maximize(params[i], nodes, n[i], r[i], opts.Model)
+			change = math.Max(change, math.Max(math.Abs(next.a-params[i].a), math.Abs(next.b-params[i].b)))
+			params[i] = next
+		}
+		if change < opts.Tolerance {
+			result.Converged = true
+			break
+		}
+	}
+	result.LogLikelihood = round(estep(), 4)
+
+	// Standard errors come from the expected information at the estimates,
+	// fit from each respondent's expected a posteriori ability.
+	abilities := map[int]float64{}
+	for _, id := range respondents {
+		total := likelihoods(id)
+		if total <= 0 {
+			continue
+		}
+		mean := 0.0
+		for q, theta := range nodes {
+			mean += posterior[q] * theta
+		}
+		abilities[id] = mean / total
+	}
+	type fitSums struct{ squared, variance, outfit float64 }
+	fits := make([]fitSums, len(params))
+	for _, id := range respondents {
+		for _, resp := range byRespondent[id] {
+			i := index[resp.Item]
+			p := prob(abilities[id], params[i])
+			x := 0.0
+			if resp.Correct {
+				x = 1
+			}
+			v := p * (1 - p)
+			fits[i].squared += (x - p) * (x - p)
+			fits[i].variance += v
+			if v > 0 {
+				fits[i].outfit += (x - p) * (x - p) / v
+			}
+		}
+	}
+
+	for k := range result.Items {
+		st := &result.Items[k]
+		i, ok := index[st.QuestionID]
+		if !ok {
+			continue
+		}
+		p := params[i]
+		a, b := round(p.a, 4), round(p.b, 4)
+		st.Discrimination, st.Difficulty = &a, &b
+		seA, seB := standardErrors(p, nodes, n[i], opts.Model)
+		if seB > 0 {
+			seB = round(seB, 4)
+			st.DifficultySE = &seB
+		}
+		if opts.Model == Model2PL && seA > 0 {
+			seA = round(seA, 4)
+			st.DiscriminationSE = &seA
+		}
+		if fits[i].variance > 0 {
+			infit := round(fits[i].squared/fits[i].variance, 4)
+			outfit := round(fits[i].outfit/float64(st.Responses), 4)
+			st.Infit, st.Outfit = &infit, &outfit
+		}
+		st.FlagReasons = flagReasons(st, opts.Model)
+		st.Flagged = len(st.FlagReasons) > 0
+	}
+	return result
+}
+
+func flagReasons(st *models.ItemCalibration, model string) []string {
+	reasons := []string{}
+	if st.Infit != nil && (*st.Infit < minFit || *st.Infit > maxFit) {
+		reasons = append(reasons, fmt.Sprintf("infit %.2f outside %.1f-%.1f", *st.Infit, minFit, maxFit))
+	}
+	if st.Outfit != nil && (*st.Outfit < minFit || *st.Outfit > maxFit) {
+		reasons = append(reasons, fmt.Sprintf("outfit %.2f outside %.1f-%.1f", *st.Outfit, minFit, maxFit))
+	}
+	if model == Model2PL && *st.Discrimination < minDiscrimination {
+		reasons = append(reasons, fmt.Sprintf("discrimination %.2f below %.1f", *st.Discrimination, minDiscrimination))
+	}
+	return reasons
+}
+
+// expected is one item's expected complete-data log-likelihood: n[q]
+// respondents expected at node q, r[q] of them right.
+func expected(p param, nodes, n, r []float64) float64 {
+	l := 0.0
+	for q, theta := range nodes {
+		pr := prob(theta, p)
+		if r[q] > 0 {
+			l += r[q] * math.Log(pr)
+		}
+		if n[q] > r[q] {
+			l += (n[q] - r[q]) * math.Log(1-pr)
+		}
+	}
+	return l
+}
+
+// maximize runs Fisher scoring on an item's expected log-likelihood,
+// halving any step that would lower it.
+func maximize(p param, nodes, n, r []float64, model string) param {
+	current := expected(p, nodes, n, r)
+	for step := 0; step < newtonSteps; step++ {
+		var ga, gb, haa, hab, hbb float64
+		for q, theta := range nodes {
+			pr := prob(theta, p)
+			resid := r[q] - n[q]*pr
+			w := n[q] * pr * (1 - pr)
+			d := theta - p.b
+			ga += resid * d
+			gb -= p.a * resid
+			haa += w * d * d
+			hab -= p.a * w * d
+			hbb += p.a * p.a * w
+		}
+		var da, db float64
+		if model != Model2PL {
+			if hbb <= 0 {
+				return p
+			}
+			db = gb / hbb
+		} else {
+			det := haa*hbb - hab*hab
+			if det <= 1e-12 {
+				return p
+			}
+			// Solve the information matrix against the gradient.
+			da = (hbb*ga - hab*gb) / det
+			db = (haa*gb - hab*ga) / det
+		}
+		moved := false
+		for h := 0; h < halvings; h++ {
+			next := param{a: clamp(p.a+da, minA, maxA), b: clamp(p.b+db, -maxAbsB, maxAbsB)}
+			if l := expected(next, nodes, n, r); l >= current {
+				p, current, moved = next, l, true
+				break
+			}
+			da, db = da/2, db/2
+		}
+		if !moved || (math.Abs(da) < 1e-8 && math.Abs(db) < 1e-8) {
+			break
+		}
+	}
+	return p
+}
+
+// standardErrors inverts the expected information of an item's
+// parameters. Under Rasch only the difficulty has one.
+func standardErrors(p param, nodes, n []float64, model string) (seA, seB float64) {
+	var haa, hab, hbb float64
+	for q, theta := range nodes {
+		pr := prob(theta, p)
+		w := n[q] * pr * (1 - pr)
+		d := theta - p.b
+		haa += w * d * d
+		hab -= p.a * w * d
+		hbb += p.a * p.a * w
+	}
+	if model != Model2PL {
+		if hbb <= 0 {
+			return 0, 0
+		}
+		return 0, 1 / math.Sqrt(hbb)
+	}
+	det := haa*hbb - hab*hab
+	if det <= 1e-12 {
+		return 0, 0
+	}
+	return math.Sqrt(hbb / det), math.Sqrt(haa / det)
+}
+
+// quadrature returns evenly spaced ability nodes with standard normal
+// weights summing to 1.
+func quadrature() ([]float64, []float64) {
+	nodes := make([]float64, quadPoints)
+	weights := make([]float64, quadPoints)
+	step := (quadMax - quadMin) / float64(quadPoints-1)
+	total := 0.0
+	for q := range nodes {
+		nodes[q] = quadMin + float64(q)*step
+		weights[q] = math.Exp(-nodes[q] * nodes[q] / 2)
+		total += weights[q]
+	}
+	for q := range weights {
+		weights[q] /= total
+	}
+	return nodes, weights
+}
+
+func clamp(x, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, x))
+}
+
+func round(x float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(x*p) / p
+}
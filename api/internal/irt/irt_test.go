@@ -0,0 +1,122 @@
+package irt
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// simulate draws standard normal abilities for n respondents and their
+// responses to items with the given parameters. It is seeded, so every run
+// sees the same data.
+func simulate(items []param, n int) []Response {
+	rng := rand.New(rand.NewSource(7))
+	var responses []Response
+	for p := 0; p < n; p++ {
+		theta := rng.NormFloat64()
+		for i, it := range items {
+			responses = append(responses, Response{Respondent: p, Item: i + 1, Correct: rng.Float64() < prob(theta, it)})
+		}
+	}
+	return responses
+}
+
+func TestCalibrateRecovery(t *testing.T) {
+	const respondents = 4000
+	tests := []struct {
+		model  string
+		items  []param
+		flagAt int // item expected to be flagged; 0 for none
+	}{
+		{
+			model: ModelRasch,
+			items: []param{{1, -1.5}, {1, -0.8}, {1, -0.3}, {1, 0}, {1, 0.4}, {1, 0.9}, {1, 1.6}, {1, 0.2}},
+		},
+		{
+			model: Model2PL,
+			items: []param{{0.8, -1.5}, {1.5, -0.8}, {1.0, -0.3}, {2.0, 0}, {0.7, 0.4}, {1.2, 0.9}, {1.6, 1.6}, {1.0, 0.2}},
+		},
+		{
+			// Item 8 is keyed wrong: stronger students tend to miss it.
+			model:  Model2PL,
+			items:  []param{{0.8, -1.5}, {1.5, -0.8}, {1.0, -0.3}, {2.0, 0}, {0.7, 0.4}, {1.2, 0.9}, {1.6, 1.6}, {-1.0, 0}},
+			flagAt: 8,
+		},
+	}
+	for _, tt := range tests {
+		name := tt.model
+		if tt.flagAt != 0 {
+			name += " with a wrong key"
+		}
+		t.Run(name, func(t *testing.T) {
+			res := Calibrate(simulate(tt.items, respondents), Options{Model: tt.model, MinResponses: 30})
+			if !res.Converged {
+				t.Errorf("did not converge in %d iterations", res.Iterations)
+			}
+			if res.Respondents != respondents || res.Responses != respondents*len(tt.items) {
+				t.Errorf("counted %d respondents and %d responses", res.Respondents, res.Responses)
+			}
+			if len(res.Items) != len(tt.items) {
+				t.Fatalf("got %d items, want %d", len(res.Items), len(tt.items))
+			}
+			for i, it := range res.Items {
+				want := tt.items[i]
+				if it.QuestionID != i+1 || it.Status != StatusCalibrated {
+					t.Fatalf("item %d: question %d with status %s", i+1, it.QuestionID, it.Status)
+				}
+				if it.QuestionID == tt.flagAt {
+					if !it.Flagged || *it.Discrimination > minDiscrimination {
+						t.Errorf("item %d: a=%.2f flagged=%v, want it flagged near zero", it.QuestionID, *it.Discrimination, it.Flagged)
+					}
+					continue
+				}
+				if it.Flagged {
+					t.Errorf("item %d flagged: %v", it.QuestionID, it.FlagReasons)
+				}
+				// Each estimate must land within three of its own standard
+				// errors, which must themselves be small at this sample size.
+				if se := *it.DifficultySE; se <= 0 || se > 0.15 || math.Abs(*it.Difficulty-want.b) > 3*se {
+					t.Errorf("item %d: b=%.2f±%.2f, want %.2f", it.QuestionID, *it.Difficulty, se, want.b)
+				}
+				if tt.model == ModelRasch {
+					if *it.Discrimination != 1 || it.DiscriminationSE != nil {
+						t.Errorf("item %d: Rasch discrimination %.2f with an SE", it.QuestionID, *it.Discrimination)
+					}
+				} else if se := *it.DiscriminationSE; se <= 0 || se > 0.15 || math.Abs(*it.Discrimination-want.a) > 3*se {
+					t.Errorf("item %d: a=%.2f±%.2f, want %.2f", it.QuestionID, *it.Discrimination, se, want.a)
+				}
+			}
+		})
+	}
+}
+
+func TestCalibrateSkips(t *testing.T) {
+	responses := simulate([]param{{1, -0.5}, {1, 0.5}}, 200)
+	for p := 0; p < 200; p++ {
+		responses = append(responses, Response{Respondent: p, Item: 3, Correct: true})
+	}
+	for p := 0; p < 10; p++ {
+		responses = append(responses, Response{Respondent: p, Item: 4, Correct: p%2 == 0})
+	}
+
+	res := Calibrate(responses, Options{Model: Model2PL, MinResponses: 30})
+	want := []string{StatusCalibrated, StatusCalibrated, StatusExtreme, StatusTooFew}
+	if len(res.Items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(res.Items), len(want))
+	}
+	for i, it := range res.Items {
+		if it.Status != want[i] {
+			t.Errorf("item %d: status %s, want %s", it.QuestionID, it.Status, want[i])
+		}
+		if it.Status != StatusCalibrated && (it.Difficulty != nil || it.Discrimination != nil) {
+			t.Errorf("item %d: %s item was given parameters", it.QuestionID, it.Status)
+		}
+	}
+	if res.Items[2].PValue != 1 || res.Items[3].PValue != 0.5 {
+		t.Errorf("p-values %.2f and %.2f, want 1 and 0.5", res.Items[2].PValue, res.Items[3].PValue)
+	}
+	// Only responses to calibrated items count.
+	if res.Responses != 400 {
+		t.Errorf("counted %d responses, want 400", res.Responses)
+	}
+}
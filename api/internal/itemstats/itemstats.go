@@ -0,0 +1,288 @@
+// Package itemstats runs classical item analysis over graded exam
+// attempts: how hard each question was, how well it separated strong
+// students from weak ones, which wrong options drew answers, and how
+// reliable the exam was as a whole.
+package itemstats
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"uedu-api/internal/models"
+)
+
+// Item is a question as it was delivered.
+type Item struct {
+	ID            int
+	Type          string
+	Options       string // JSON list of choices, for choice questions
+	CorrectAnswer string
+	Points        float64
+}
+
+// Response is one attempt's answer to one item.
+type Response struct {
+	Item     int
+	Earned   float64 // points earned
+	Answer   string
+	Answered bool
+}
+
+// Attempt is the responses of one graded attempt, one per item delivered.
+type Attempt struct {
+	Responses []Response
+}
+
+// Report is the analysis of a set of attempts.
+type Report struct {
+	Questions         []models.QuestionStat
+	Reliability       *float64
+	ReliabilityMethod string
+	ReliabilityItems  int
+}
+
+// distractorTypes are the question types whose answers are one option out
+// of a list.
+var distractorTypes = map[string]bool{
+	"multiple_choice":       true,
+	"true_false":            true,
+	"reading_comprehension": true,
+}
+
+// Analyze analyses the attempts. Questions are reported in the order of
+// items; items no attempt was delivered are left out.
+func Analyze(items []Item, attempts []Attempt) Report {
+	byID := map[int]Item{}
+	for _, it := range items {
+		byID[it.ID] = it
+	}
+
+	// Each attempt's totals, to take each item's own share out of.
+	earned := make([]float64, len(attempts))
+	possible := make([]float64, len(attempts))
+	for i, a := range attempts {
+		for _, r := range a.Responses {
+			earned[i] += r.Earned
+			possible[i] += byID[r.Item].Points
+		}
+	}
+
+	type observation struct {
+		score, rest float64
+		hasRest     bool
+		r           Response
+	}
+	seen := map[int][]observation{}
+	for i, a := range attempts {
+		for _, r := range a.Responses {
+			it, ok := byID[r.Item]
+			if !ok {
+				continue
+			}
+			o := observation{score: share(r.Earned, it.Points), r: r}
+			if restPossible := possible[i] - it.Points; restPossible > 0 {
+				o.rest = (earned[i] - r.Earned) / restPossible
+				o.hasRest = true
+			}
+			seen[r.Item] = append(seen[r.Item], o)
+		}
+	}
+
+	var report Report
+	for _, it := range items {
+		obs := seen[it.ID]
+		if len(obs) == 0 {
+			continue
+		}
+		st := models.QuestionStat{QuestionID: it.ID, QuestionType: it.Type, Responses: len(obs)}
+		var scores, xs, ys []float64
+		var answers []Response
+		for _, o := range obs {
+			scores = append(scores, o.score)
+			if o.hasRest {
+				xs = append(xs, o.score)
+				ys = append(ys, o.rest)
+			}
+			if !o.r.Answered || strings.TrimSpace(o.r.Answer) == "" {
+				st.Omitted++
+			}
+			answers = append(answers, o.r)
+		}
+		st.PValue = round(mean(scores), 4)
+		if r, ok := correlation(xs, ys); ok {
+			r = round(r, 4)
+			st.PointBiserial = &r
+		}
+		if distractorTypes[it.Type] {
+			st.Distractors = distractors(it, answers)
+		}
+		report.Questions = append(report.Questions, st)
+	}
+
+	report.Reliability, report.ReliabilityMethod, report.ReliabilityItems = reliability(items, attempts)
+	return report
+}
+
+// reliability computes Cronbach's alpha over the items delivered in every
+// attempt, which for items scored only right or wrong is KR-20.
+func reliability(items []Item, attempts []Attempt) (*float64, string, int) {
+	if len(attempts) < 2 {
+		return nil, "", 0
+	}
+	counts := map[int]int{}
+	for _, a := range attempts {
+		for _, r := range a.Responses {
+			counts[r.Item]++
+		}
+	}
+	var common []Item
+	for _, it := range items {
+		if counts[it.ID] == len(attempts) {
+			common = append(common, it)
+		}
+	}
+	k := len(common)
+	if k < 2 {
+		return nil, "", k
+	}
+
+	index := map[int]int{}
+	for j, it := range common {
+		index[it.ID] = j
+	}
+	columns := make([][]float64, k)
+	totals := make([]float64, len(attempts))
+	dichotomous := true
+	for i, a := range attempts {
+		for _, r := range a.Responses {
+			j, ok := index[r.Item]
+			if !ok {
+				continue
+			}
+			columns[j] = append(columns[j], r.Earned)
+			totals[i] += r.Earned
+			if s := share(r.Earned, common[j].Points); s != 0 && s != 1 {
+				dichotomous = false
+			}
+		}
+	}
+
+	totalVar := variance(totals)
+	if totalVar == 0 {
+		return nil, "", k
+	}
+	itemVar := 0.0
+	for _, col := range columns {
+		itemVar += variance(col)
+	}
+	alpha := round(float64(k)/float64(k-1)*(1-itemVar/totalVar), 4)
+	method := "alpha"
+	if dichotomous {
+		method = "kr20"
+	}
+	return &alpha, method, k
+}
+
+// distractors counts the answers given to a choice question, option by
+// option in the order offered, followed by any other answers given.
+func distractors(it Item, answers []Response) []models.DistractorStat {
+	var options []string
+	if json.Unmarshal([]byte(it.Options), &options) != nil || len(options) == 0 {
+		if it.Type == "true_false" {
+			options = []string{"True", "False"}
+		}
+	}
+
+	var out []models.DistractorStat
+	position := map[string]int{}
+	for _, o := range options {
+		key := normalize(o)
+		if _, dup := position[key]; dup {
+			continue
+		}
+		position[key] = len(out)
+		out = append(out, models.DistractorStat{Option: o, IsKey: key == normalize(it.CorrectAnswer)})
+	}
+	offered := len(out)
+	for _, r := range answers {
+		if !r.Answered || strings.TrimSpace(r.Answer) == "" {
+			continue
+		}
+		key := normalize(r.Answer)
+		if _, ok := position[key]; !ok {
+			position[key] = len(out)
+			out = append(out, models.DistractorStat{Option: r.Answer, IsKey: key == normalize(it.CorrectAnswer)})
+		}
+		out[position[key]].Count++
+	}
+	// Answers outside the offered options sort by text so the report is
+	// the same whatever order the attempts were read in.
+	extra := out[offered:]
+	sort.SliceStable(extra, func(i, j int) bool { return normalize(extra[i].Option) < normalize(extra[j].Option) })
+
+	for i := range out {
+		out[i].Proportion = round(float64(out[i].Count)/float64(len(answers)), 4)
+	}
+	return out
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func share(earned, points float64) float64 {
+	if points <= 0 {
+		return 0
+	}
+	return earned / points
+}
+
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// variance is the population variance.
+func variance(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	m := mean(xs)
+	sum := 0.0
+	for _, x := range xs {
+		sum += (x - m) * (x - m)
+	}
+	return sum / float64(len(xs))
+}
+
+// correlation is Pearson's r, which for a right-or-wrong item is the
+// point-biserial. It is undefined when either side does not vary.
+func correlation(xs, ys []float64) (float64, bool) {
+	if len(xs) < 2 || len(xs) != len(ys) {
+		return 0, false
+	}
+	mx, my := mean(xs), mean(ys)
+	var sxy, sxx, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return sxy / math.Sqrt(sxx*syy), true
+}
+
+func round(x float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(x*p) / p
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Send delivers a plain-text email through the SMTP server configured in the
+// environment. Without SMTP_HOST the message is only logged, which keeps
+// local development working without a mail server. The body can carry
+// reset and invite links, so in release mode it is left out of the log.
+func Send(to, subject, body string) error {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		if gin.Mode() == gin.ReleaseMode {
+			log.Printf("SMTP not configured, email to %s not sent\nSubject: %s", to, subject)
+		} else {
+			log.Printf("SMTP not configured, email to %s not sent\nSubject: %s\n\n%s", to, subject, body)
+		}
+		return nil
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@uedu.local"
+	}
+
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		from, to, subject, body)
+
+	return smtp.SendMail(host+":"+port, auth, from, []string{to}, []byte(msg))
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"uedu-api/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAuth validates the Bearer access token and stores its claims on the
+// request context for the role and ownership checks below.
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+			return
+		}
+
+		claims, err := auth.ParseAccessToken(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		auth.SetClaims(c, claims)
+		c.Next()
+	}
+}
+
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := auth.ClaimsFromContext(c)
+		if claims == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		for _, role := range roles {
+			if claims.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+	}
+}
+
+// OwnStudentParam lets staff through and restricts students to routes whose
+// path parameter is their own student id.
+func OwnStudentParam(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.CanAccessStudentParam(c, c.Param(param)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You can only access your own records"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// OwnTeacherParam lets admins through and restricts teachers to routes whose
+// path parameter is their own teacher id.
+func OwnTeacherParam(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.CanAccessTeacherParam(c, c.Param(param)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You can only access your own records"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// OwnStudentQuery scopes list endpoints filtered by a student query parameter.
+// Students get the filter forced to their own id; asking for anyone else is
+// rejected.
+func OwnStudentQuery(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := auth.ClaimsFromContext(c)
+		if claims == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		if claims.Role != auth.RoleStudent {
+			c.Next()
+			return
+		}
+
+		own := strconv.Itoa(claims.StudentID)
+		if requested := c.Request.URL.Query().Get(key); requested != "" && requested != own {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You can only access your own records"})
+			return
+		}
+		setQuery(c, key, own)
+		c.Next()
+	}
+}
+
+// ScopeEventsToCaller pins the user_type/user_id filters of the events feed to
+// the calling student or teacher. Admins may query any calendar.
+func ScopeEventsToCaller() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := auth.ClaimsFromContext(c)
+		if claims == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		var own string
+		switch claims.Role {
+		case auth.RoleAdmin:
+			c.Next()
+			return
+		case auth.RoleStudent:
+			own = strconv.Itoa(claims.StudentID)
+		case auth.RoleTeacher:
+			own = strconv.Itoa(claims.TeacherID)
+		}
+
+		q := c.Request.URL.Query()
+		userType, userID := q.Get("user_type"), q.Get("user_id")
+		if (userType != "" && userType != claims.Role) || (userID != "" && userID != own) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You can only access your own schedule"})
+			return
+		}
+		setQuery(c, "user_type", claims.Role)
+		setQuery(c, "user_id", own)
+		c.Next()
+	}
+}
+
+// setQuery rewrites the raw query string. Middleware must read the URL
+// directly rather than through c.Query, which caches the parsed values.
+func setQuery(c *gin.Context, key, value string) {
+	q := c.Request.URL.Query()
+	q.Set(key, value)
+	c.Request.URL.RawQuery = q.Encode()
+}
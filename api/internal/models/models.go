@@ -40,13 +40,16 @@ type Course struct {
 }
 
 type Enrollment struct {
-	ID        int       `json:"id"`
-	StudentID int       `json:"student_id" binding:"required"`
-	CourseID  int       `json:"course_id" binding:"required"`
-	Status    string    `json:"status"`
-	EnrolledAt time.Time `json:"enrolled_at"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                    int        `json:"id"`
+	StudentID             int        `json:"student_id" binding:"required"`
+	CourseID              int        `json:"course_id" binding:"required"`
+	Status                string     `json:"status"` // active, waitlisted, dropped, completed, transferred
+	EnrolledAt            time.Time  `json:"enrolled_at"`
+	WaitlistedAt          *time.Time `json:"waitlisted_at,omitempty"`
+	WaitlistPosition      int        `json:"waitlist_position,omitempty"`
+	TransferredToCourseID *int       `json:"transferred_to_course_id,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
 }
 
 type Class struct {
@@ -58,6 +61,7 @@ type Class struct {
 	ClassDate   time.Time `json:"class_date"`
 	Duration    int       `json:"duration"`
 	Room        string    `json:"room"`
+	RoomID      *int      `json:"room_id"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -84,15 +88,83 @@ type Exam struct {
 	StartDate   time.Time `json:"start_date"`
 	EndDate     time.Time `json:"end_date"`
 	IsRandom    bool      `json:"is_random"`
+	Room        string    `json:"room"` // room of an in-person sitting, if any
+	RoomID      *int      `json:"room_id"`
+	MaxAttempts int       `json:"max_attempts"` // 0 for no limit
+	CooldownMinutes int   `json:"cooldown_minutes"` // wait between one attempt ending and the next starting
+	AttemptScoring string `json:"attempt_scoring"` // which attempt counts: best, latest, average
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// ExamAccommodation changes an exam's timing and window for one student.
+// With neither EnrollmentID nor ExamID it covers all of the student's exams;
+// EnrollmentID narrows it to exams of that enrollment's course, and ExamID to
+// one exam.
+type ExamAccommodation struct {
+	ID             int        `json:"id"`
+	StudentID      int        `json:"student_id" binding:"required"`
+	EnrollmentID   *int       `json:"enrollment_id"`
+	ExamID         *int       `json:"exam_id"`
+	TimeMultiplier float64    `json:"time_multiplier"` // applied to the exam's duration; 1 for none
+	ExtraMinutes   int        `json:"extra_minutes"`   // added after the multiplier
+	OpensAt        *time.Time `json:"opens_at"`        // replaces the exam's start_date when set
+	ClosesAt       *time.Time `json:"closes_at"`       // replaces the exam's end_date when set
+	Reason         string     `json:"reason"`
+	CreatedBy      *int       `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ExamStanding is where a student stands on an exam under its policy: the
+// attempts used and left, when the next may start, and the grade that
+// counts.
+type ExamStanding struct {
+	ExamID          int        `json:"exam_id"`
+	StudentID       int        `json:"student_id"`
+	AttemptScoring  string     `json:"attempt_scoring"`
+	Attempts        int        `json:"attempts"`
+	MaxAttempts     int        `json:"max_attempts"`
+	AttemptsLeft    *int       `json:"attempts_left"` // nil when unlimited
+	OpensAt         *time.Time `json:"opens_at"`
+	ClosesAt        *time.Time `json:"closes_at"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at"` // set while a cool-down is running
+	CanStart        bool       `json:"can_start"`
+	Code            string     `json:"code,omitempty"`   // why not, when CanStart is false
+	Score           *float64   `json:"score"`            // the score that counts, nil before any graded attempt
+	Status          string     `json:"status"`           // passed, failed, pending, or none
+	CountedResults  []int      `json:"counted_results"`  // exam results the score is taken from
+	AccommodationID *int       `json:"accommodation_id"` // accommodation that applies to the next attempt
+	DurationMinutes int        `json:"duration_minutes"` // time the next attempt gets, 0 for untimed
+}
+
+// ExamVersion is a frozen copy of an exam as delivered to students: its
+// settings, blueprint and questions with their keys and points. A draft
+// version has no snapshot yet; it marks edits made since the last publish.
+type ExamVersion struct {
+	ID            int                `json:"id"`
+	ExamID        int                `json:"exam_id"`
+	Version       int                `json:"version"`
+	Status        string             `json:"status"` // draft, published
+	Title         string             `json:"title"`
+	Duration      int                `json:"duration"`
+	PassingScore  int                `json:"passing_score"`
+	TotalPoints   int                `json:"total_points"`
+	IsRandom      bool               `json:"is_random"`
+	Blueprint     []BlueprintSection `json:"blueprint,omitempty"`
+	QuestionCount int                `json:"question_count"` // the exam's own questions; drawn bank questions not counted
+	PublishedAt   *time.Time         `json:"published_at"`
+	PublishedBy   *int               `json:"published_by"`
+	CreatedAt     time.Time          `json:"created_at"`
+	Questions     []Question         `json:"questions,omitempty"`
+	Adaptive      *AdaptiveSettings  `json:"adaptive,omitempty"`
+}
+
 type Question struct {
 	ID          int       `json:"id"`
-	ExamID      int       `json:"exam_id" binding:"required"`
+	ExamID      *int      `json:"exam_id"` // nil for questions in the reusable bank
 	QuestionText string   `json:"question_text" binding:"required"`
-	QuestionType string   `json:"question_type"` // multiple_choice, true_false, short_answer, fill_blank, matching, reading_comprehension, writing, speaking
+	QuestionType string   `json:"question_type"` // multiple_choice, multiple_select, true_false, short_answer, fill_blank, matching, reading_comprehension, writing, speaking
 	Options     string    `json:"options"` // JSON string for multiple choice options
 	CorrectAnswer string  `json:"correct_answer" binding:"required"`
 	Points      int       `json:"points"`
@@ -101,20 +173,168 @@ type Question struct {
 	AudioURL    string    `json:"audio_url"` // For speaking questions
 	Explanation string   `json:"explanation"` // Answer explanation
 	GradingRubric string  `json:"grading_rubric"` // JSON string for writing/speaking rubric
+	Skill       string    `json:"skill"` // grammar, vocabulary, reading, listening, writing, speaking
+	CEFRLevel   string    `json:"cefr_level"` // A1-C2
+	Topic       string    `json:"topic"`
+	Difficulty  int       `json:"difficulty"` // 1 (easiest) to 5, 0 if unrated
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// BlueprintSection asks for questions to be drawn from the bank on every
+// attempt, such as 10 B1 grammar multiple-choice items or one reading
+// passage with 4 items. Empty tags match any question.
+type BlueprintSection struct {
+	ID           int       `json:"id"`
+	ExamID       int       `json:"exam_id"`
+	Position     int       `json:"position"`
+	QuestionType string    `json:"question_type"`
+	Skill        string    `json:"skill"`
+	CEFRLevel    string    `json:"cefr_level"`
+	Topic        string    `json:"topic"`
+	Difficulty   int       `json:"difficulty"` // 0 for any
+	ItemCount    int       `json:"item_count"` // items, or items per passage
+	PassageCount int       `json:"passage_count"` // passages to draw; 0 for standalone items
+	Available    int       `json:"available"` // matching items, or passages, in the bank now
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AdaptiveSettings make an exam a computerized adaptive test. Instead of a
+// fixed set of questions each attempt is given calibrated bank items one at
+// a time, chosen for the student's estimated ability.
+type AdaptiveSettings struct {
+	ExamID    int        `json:"exam_id"`
+	Model     string     `json:"model"` // rasch or 2pl
+	Skill     string     `json:"skill"` // only items tagged with this skill; empty for any
+	MinItems  int        `json:"min_items"`
+	MaxItems  int        `json:"max_items"`
+	SETarget  float64    `json:"se_target"`  // stop once the standard error of theta is at most this
+	PassTheta float64    `json:"pass_theta"` // a result passes once theta reaches this
+	LevelCuts []LevelCut `json:"level_cuts"` // in rising order; the defaults when empty
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// LevelCut is the lowest ability estimate placed at a CEFR level.
+type LevelCut struct {
+	Level    string  `json:"level"`
+	MinTheta float64 `json:"min_theta"`
+}
+
+// AdaptiveItem is an item given in an adaptive attempt, with the parameters
+// it was given under and the estimate after its response.
+type AdaptiveItem struct {
+	Position       int        `json:"position"`
+	QuestionID     int        `json:"question_id"`
+	Discrimination float64    `json:"discrimination"`
+	Difficulty     float64    `json:"difficulty"`
+	Correct        *bool      `json:"correct"` // nil until answered
+	Theta          *float64   `json:"theta"`
+	ThetaSE        *float64   `json:"theta_se"`
+	AdministeredAt time.Time  `json:"administered_at"`
+	AnsweredAt     *time.Time `json:"answered_at"`
+}
+
+// AdaptiveState is where an adaptive attempt stands. Students see the
+// ability estimate only once the attempt is over.
+type AdaptiveState struct {
+	ExamResultID  int                `json:"exam_result_id"`
+	Status        string             `json:"status"`
+	ItemsAnswered int                `json:"items_answered"`
+	MaxItems      int                `json:"max_items"`
+	ThetaSE       float64            `json:"theta_se"`
+	Theta         *float64           `json:"theta,omitempty"`
+	AbilityLevel  string             `json:"ability_level,omitempty"`
+	StopReason    string             `json:"stop_reason,omitempty"` // precision, max_items or pool_empty; empty if submitted or timed out first
+	Question      *DeliveredQuestion `json:"question"`              // the item to answer; nil once the attempt is over
+	Items         []AdaptiveItem     `json:"items,omitempty"`       // staff only
+}
+
+// CalibrationRun is one estimation of item parameters from the stored
+// answers. Items lists every item answered, including those skipped.
+type CalibrationRun struct {
+	ID              int               `json:"id"`
+	Model           string            `json:"model"` // rasch or 2pl
+	MinResponses    int               `json:"min_responses"`
+	Respondents     int               `json:"respondents"` // students with a response to a calibrated item
+	Responses       int               `json:"responses"`
+	ItemsCalibrated int               `json:"items_calibrated"`
+	ItemsFlagged    int               `json:"items_flagged"`
+	ItemsSkipped    int               `json:"items_skipped"`
+	Iterations      int               `json:"iterations"`
+	Converged       bool              `json:"converged"`
+	LogLikelihood   float64           `json:"log_likelihood"`
+	TriggeredBy     *int              `json:"triggered_by"` // nil when run from the command line
+	Items           []ItemCalibration `json:"items,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+}
+
+// ItemCalibration is what a calibration estimated for one question, and
+// how well the question fits the model.
+type ItemCalibration struct {
+	QuestionID       int      `json:"question_id"`
+	Status           string   `json:"status"` // calibrated, too_few or extreme
+	Responses        int      `json:"responses"`
+	PValue           float64  `json:"p_value"` // share answered right
+	Difficulty       *float64 `json:"difficulty"`
+	DifficultySE     *float64 `json:"difficulty_se"`
+	Discrimination   *float64 `json:"discrimination"`
+	DiscriminationSE *float64 `json:"discrimination_se"` // nil under Rasch
+	Infit            *float64 `json:"infit"`
+	Outfit           *float64 `json:"outfit"`
+	Flagged          bool     `json:"flagged"`
+	FlagReasons      []string `json:"flag_reasons,omitempty"`
+}
+
+// CalibratedQuestion is a question with the parameters and fit its latest
+// calibration wrote onto it.
+type CalibratedQuestion struct {
+	ItemCalibration
+	ExamID       *int       `json:"exam_id"`
+	QuestionText string     `json:"question_text"`
+	QuestionType string     `json:"question_type"`
+	Skill        string     `json:"skill"`
+	CEFRLevel    string     `json:"cefr_level"`
+	Model        string     `json:"model"`
+	RunID        *int       `json:"run_id"`
+	CalibratedAt time.Time  `json:"calibrated_at"`
+	ReviewedBy   *int       `json:"reviewed_by"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+}
+
+// DeliveredQuestion is a question as sent to a student sitting or reviewing
+// an exam. It has no answer key or rubric fields, so they cannot leak.
+type DeliveredQuestion struct {
+	ID           int    `json:"id"`
+	ExamID       int    `json:"exam_id"`
+	QuestionText string `json:"question_text"`
+	QuestionType string `json:"question_type"`
+	Options      string `json:"options"`
+	Points       int    `json:"points"`
+	Order        int    `json:"order"`
+	Passage      string `json:"passage"`
+	AudioURL     string `json:"audio_url"`
+	Explanation  string `json:"explanation,omitempty"` // only after the result is released
+}
+
 type ExamResult struct {
 	ID           int       `json:"id"`
 	ExamID       int       `json:"exam_id" binding:"required"`
+	ExamVersionID *int     `json:"exam_version_id"` // version delivered; nil for attempts from before versions
 	StudentID    int       `json:"student_id" binding:"required"`
 	Score        float64   `json:"score"`
 	TotalPoints  int       `json:"total_points"`
-	Status       string    `json:"status"` // passed, failed, in_progress
+	Status       string    `json:"status"` // passed, failed, pending (awaiting manual grading), in_progress
 	StartedAt    time.Time `json:"started_at"`
-	CompletedAt  time.Time `json:"completed_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
 	TimeTaken    int       `json:"time_taken"` // in seconds
+	DeadlineAt   *time.Time `json:"deadline_at,omitempty"` // nil for untimed exams
+	AutoSubmitted bool     `json:"auto_submitted"` // closed by the deadline rather than by the student
+	ReleasedAt   *time.Time `json:"released_at,omitempty"` // when the student may see the answer key
+	ShuffleSeed  *int64    `json:"shuffle_seed,omitempty"` // set when the exam is randomised
+	QuestionOrder []int    `json:"question_order,omitempty"` // question ids in the order delivered
+	OptionOrder  map[int][]int `json:"option_order,omitempty"` // per question, stored option indexes in display order
+	AccommodationID *int   `json:"accommodation_id,omitempty"` // accommodation the attempt was taken under
+	Accommodated bool      `json:"accommodated"` // taken under an accommodation, even one since removed
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -125,7 +345,8 @@ type Answer struct {
 	QuestionID    int       `json:"question_id" binding:"required"`
 	SelectedAnswer string  `json:"selected_answer"`
 	IsCorrect     bool     `json:"is_correct"`
-	PointsEarned  int      `json:"points_earned"`
+	PointsEarned  float64  `json:"points_earned"`
+	GradingStatus string   `json:"grading_status"` // auto, pending (awaiting a teacher), graded
 	AudioURL      string    `json:"audio_url"`
 	CreatedAt     time.Time `json:"created_at"`
 }
@@ -140,9 +361,56 @@ type WritingEvaluation struct {
 	Improvements  string    `json:"improvements"`
 	CorrectedText string    `json:"corrected_text"`
 	Suggestions   string    `json:"suggestions"`
+	CriteriaScores string   `json:"criteria_scores"` // JSON object of rubric criterion to points awarded
+	GradedBy      *int      `json:"graded_by"` // user who graded the answer
 	EvaluatedAt   time.Time `json:"evaluated_at"`
 }
 
+// Regrade is the audit entry for one regrade of a question or an exam.
+type Regrade struct {
+	ID         int             `json:"id"`
+	ExamID     *int            `json:"exam_id"` // set when a whole exam was regraded
+	QuestionID *int            `json:"question_id"` // set when one question was regraded
+	Reason     string          `json:"reason"`
+	RegradedBy *int            `json:"regraded_by"`
+	Regraded   int             `json:"regraded"` // results rescored
+	Changes    []RegradeChange `json:"changes"` // results whose score or status moved
+	NowPassed  []RegradeChange `json:"now_passed"`
+	NowFailed  []RegradeChange `json:"now_failed"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type RegradeChange struct {
+	ExamResultID int     `json:"exam_result_id"`
+	ExamID       int     `json:"exam_id"`
+	StudentID    int     `json:"student_id"`
+	StudentName  string  `json:"student_name"`
+	OldScore     float64 `json:"old_score"`
+	NewScore     float64 `json:"new_score"`
+	OldStatus    string  `json:"old_status"`
+	NewStatus    string  `json:"new_status"`
+}
+
+// GradingQueueItem is a writing or speaking answer waiting for a teacher.
+type GradingQueueItem struct {
+	AnswerID       int        `json:"answer_id"`
+	ExamResultID   int        `json:"exam_result_id"`
+	ExamID         int        `json:"exam_id"`
+	ExamTitle      string     `json:"exam_title"`
+	CourseID       *int       `json:"course_id"`
+	StudentID      int        `json:"student_id"`
+	StudentName    string     `json:"student_name"`
+	QuestionID     int        `json:"question_id"`
+	QuestionText   string     `json:"question_text"`
+	QuestionType   string     `json:"question_type"`
+	Passage        string     `json:"passage"`
+	Points         int        `json:"points"`
+	GradingRubric  string     `json:"grading_rubric"`
+	SelectedAnswer string     `json:"selected_answer"`
+	AudioURL       string     `json:"audio_url"`
+	SubmittedAt    *time.Time `json:"submitted_at"`
+}
+
 type StudentChatHistory struct {
 	ID           int       `json:"id"`
 	StudentID    int       `json:"student_id"`
@@ -153,39 +421,160 @@ type StudentChatHistory struct {
 }
 
 type ExamIntegrityLog struct {
-	ID           int       `json:"id"`
-	ExamResultID int       `json:"exam_result_id"`
-	StudentID    int       `json:"student_id"`
-	EventType    string    `json:"event_type"`
-	EventDetails string    `json:"event_details"`
-	Timestamp    time.Time `json:"timestamp"`
-	IPAddress    string    `json:"ip_address"`
+	ID           int        `json:"id"`
+	ExamResultID int        `json:"exam_result_id"`
+	StudentID    int        `json:"student_id"`
+	EventType    string     `json:"event_type"`
+	EventDetails string     `json:"event_details"`
+	DurationMs   int        `json:"duration_ms"` // time out of view, for tab switches and focus loss
+	OccurredAt   *time.Time `json:"occurred_at"` // as reported by the client
+	Timestamp    time.Time  `json:"timestamp"`   // when the server received it
+	IPAddress    string     `json:"ip_address"`
+}
+
+// IntegritySummary counts up an attempt's integrity events and the risk
+// score they give.
+type IntegritySummary struct {
+	Events           int      `json:"events"`
+	TabSwitches      int      `json:"tab_switches"`
+	FocusLostSeconds int      `json:"focus_lost_seconds"`
+	PasteAttempts    int      `json:"paste_attempts"`
+	CopyAttempts     int      `json:"copy_attempts"`
+	DevToolsAttempts int      `json:"devtools_attempts"`
+	IPChanges        int      `json:"ip_changes"`
+	OtherEvents      int      `json:"other_events"`
+	RiskScore        int      `json:"risk_score"`
+	Flagged          bool     `json:"flagged"`
+	Reasons          []string `json:"reasons"`
+}
+
+// IntegrityReview is an attempt on a proctor's review list.
+type IntegrityReview struct {
+	ExamResultID int              `json:"exam_result_id"`
+	ExamID       int              `json:"exam_id"`
+	ExamTitle    string           `json:"exam_title"`
+	StudentID    int              `json:"student_id"`
+	StudentName  string           `json:"student_name"`
+	Status       string           `json:"status"`
+	StartedAt    time.Time        `json:"started_at"`
+	CompletedAt  *time.Time       `json:"completed_at"`
+	ClientIP     string           `json:"client_ip"` // address the attempt was started from
+	Summary      IntegritySummary `json:"summary"`
 }
 
 type ExamAnalytics struct {
-	ID             int       `json:"id"`
-	ExamID         int       `json:"exam_id"`
-	TotalAttempts  int       `json:"total_attempts"`
-	PassCount      int       `json:"pass_count"`
-	FailCount      int       `json:"fail_count"`
-	AverageScore   float64   `json:"average_score"`
-	AverageTime    int       `json:"average_time_taken"`
-	QuestionStats  string    `json:"question_stats"`
-	LastUpdated    time.Time `json:"last_updated"`
+	ID                int            `json:"id"`
+	ExamID            int            `json:"exam_id"`
+	ExamTitle         string         `json:"exam_title,omitempty"`
+	TotalAttempts     int            `json:"total_attempts"` // submitted attempts, graded or not
+	PassCount         int            `json:"pass_count"`
+	FailCount         int            `json:"fail_count"`
+	PendingCount      int            `json:"pending_count"` // awaiting manual grading; left out of the item statistics
+	AverageScore      float64        `json:"average_score"`
+	AverageTime       int            `json:"average_time_taken"`           // in seconds
+	Reliability       *float64       `json:"reliability"`                  // nil when it cannot be computed
+	ReliabilityMethod string         `json:"reliability_method,omitempty"` // kr20 when every item is right/wrong, alpha otherwise
+	ReliabilityItems  int            `json:"reliability_items"`            // items common to every attempt, which reliability is computed over
+	QuestionStats     []QuestionStat `json:"question_stats,omitempty"`
+	LastUpdated       time.Time      `json:"last_updated"`
+}
+
+// QuestionStat is the item analysis of one question over the graded
+// attempts it was delivered in.
+type QuestionStat struct {
+	QuestionID    int              `json:"question_id"`
+	QuestionType  string           `json:"question_type"`
+	Responses     int              `json:"responses"`      // attempts the question was delivered in
+	Omitted       int              `json:"omitted"`        // of those, left unanswered
+	PValue        float64          `json:"p_value"`        // mean share of the points earned; higher is easier
+	PointBiserial *float64         `json:"point_biserial"` // correlation with the score on the rest of the attempt
+	Distractors   []DistractorStat `json:"distractors,omitempty"`
+}
+
+// DistractorStat is how often one option of a choice question was picked.
+type DistractorStat struct {
+	Option     string  `json:"option"`
+	Count      int     `json:"count"`
+	Proportion float64 `json:"proportion"`
+	IsKey      bool    `json:"is_key"`
 }
 
 type StudentAnalytics struct {
-	ID                int       `json:"id"`
-	StudentID         int       `json:"student_id"`
-	TotalExamsTaken   int       `json:"total_exams_taken"`
-	TotalPasses       int       `json:"total_passes"`
-	TotalFails        int       `json:"total_fails"`
-	AverageScore      float64   `json:"average_score"`
-	SkillBreakdown    string    `json:"skill_breakdown"`
-	Weaknesses        string    `json:"weaknesses"`
-	Strengths         string    `json:"strengths"`
-	RecommendedLevel  string    `json:"recommended_level"`
-	LastUpdated       time.Time `json:"last_updated"`
+	ID               int         `json:"id"`
+	StudentID        int         `json:"student_id"`
+	TotalExamsTaken  int         `json:"total_exams_taken"`
+	TotalPasses      int         `json:"total_passes"`
+	TotalFails       int         `json:"total_fails"`
+	AverageScore     float64     `json:"average_score"`
+	SkillBreakdown   []SkillStat `json:"skill_breakdown"`
+	LevelBreakdown   []LevelStat `json:"level_breakdown"`
+	Weaknesses       []string    `json:"weaknesses"`        // weakest skills first
+	Strengths        []string    `json:"strengths"`         // strongest skills first
+	RecommendedLevel string      `json:"recommended_level"` // CEFR level to study next; empty until questions tagged with levels are answered
+	LastUpdated      time.Time   `json:"last_updated"`
+}
+
+// SkillStat is a student's accuracy on one skill, overall and result by
+// result.
+type SkillStat struct {
+	Skill    string       `json:"skill"`
+	Answered int          `json:"answered"`
+	Accuracy float64      `json:"accuracy"` // share of the points available that were earned, 0 to 1
+	Trend    string       `json:"trend"`    // improving, declining, steady, or new
+	History  []SkillPoint `json:"history"`  // oldest first
+}
+
+type SkillPoint struct {
+	ExamResultID int       `json:"exam_result_id"`
+	CompletedAt  time.Time `json:"completed_at"`
+	Accuracy     float64   `json:"accuracy"`
+}
+
+// LevelStat is a student's accuracy on questions tagged with one CEFR level.
+type LevelStat struct {
+	Level    string  `json:"level"`
+	Answered int     `json:"answered"`
+	Accuracy float64 `json:"accuracy"`
+	Mastered bool    `json:"mastered"`
+}
+
+// PlacementBand places a placement exam score of at least MinScore at a
+// CEFR level, up to the next band.
+type PlacementBand struct {
+	ID        int       `json:"id"`
+	ExamID    int       `json:"exam_id"`
+	MinScore  float64   `json:"min_score"` // percentage, 0 to 100
+	CEFRLevel string    `json:"cefr_level"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PlacementSkillWeight struct {
+	Skill  string  `json:"skill"`
+	Weight float64 `json:"weight"` // 0 leaves the skill out of the placement score
+}
+
+// Placement is the level a placement exam result placed a student at and
+// the courses offered at that level.
+type Placement struct {
+	ExamResultID   int                `json:"exam_result_id"`
+	ExamID         int                `json:"exam_id"`
+	StudentID      int                `json:"student_id"`
+	Score          float64            `json:"score"`           // the result's score
+	PlacementScore float64            `json:"placement_score"` // the score after skill weighting
+	SkillScores    map[string]float64 `json:"skill_scores"`    // percentage earned per skill
+	CEFRLevel      string             `json:"cefr_level"`      // empty when the score is below every band
+	StudentLevel   string             `json:"student_level"`   // the student's level now; a newer placement or an admin may have changed it
+	Courses        []CourseOffer      `json:"courses"`
+}
+
+// CourseOffer is an upcoming course with free seats, ranked for a placed
+// student.
+type CourseOffer struct {
+	Course
+	Rank      int  `json:"rank"`
+	FreeSeats *int `json:"free_seats"` // nil when the course has no seat limit
+}
+
 type ClassWithDetails struct {
 	ID             int       `json:"id"`
 	CourseID       int       `json:"course_id"`
@@ -195,6 +584,10 @@ type ClassWithDetails struct {
 	ClassDate      time.Time `json:"class_date"`
 	Duration       int       `json:"duration"`
 	Room           string    `json:"room"`
+	RoomID         *int      `json:"room_id"`
+	SeriesID       *int      `json:"series_id,omitempty"`
+	IsOverride     bool      `json:"is_override"`
+	CancelledAt    *time.Time `json:"cancelled_at,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 	CourseName     string    `json:"course_name"`
@@ -202,6 +595,22 @@ type ClassWithDetails struct {
 	TeacherLastName  string   `json:"teacher_last_name"`
 }
 
+// ScheduleConflict describes an existing class or exam sitting that overlaps
+// a proposed booking. Reason is "teacher" or "room".
+type ScheduleConflict struct {
+	Reason    string    `json:"reason"`
+	EventType string    `json:"event_type"` // class, exam
+	EventID   int       `json:"event_id"`
+	Title     string    `json:"title"`
+	TeacherID *int      `json:"teacher_id,omitempty"`
+	Room      string    `json:"room,omitempty"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	// OccurrenceDate is the proposed occurrence that clashes when a whole
+	// class series is checked.
+	OccurrenceDate string `json:"occurrence_date,omitempty"`
+}
+
 type Event struct {
 	Type            string    `json:"type"`
 	ID              int       `json:"id"`
@@ -212,4 +621,74 @@ type Event struct {
 	CourseName      string    `json:"course_name"`
 	TeacherFirstName string   `json:"teacher_first_name"`
 	TeacherLastName  string   `json:"teacher_last_name"`
+	Cancelled       bool      `json:"cancelled"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type User struct {
+	ID                  int        `json:"id"`
+	Email               string     `json:"email"`
+	PasswordHash        string     `json:"-"`
+	Role                string     `json:"role"` // admin, teacher, student
+	StudentID           *int       `json:"student_id"`
+	TeacherID           *int       `json:"teacher_id"`
+	IsActive            bool       `json:"is_active"`
+	InvitePending       bool       `json:"invite_pending"` // no password set yet
+	FailedLoginAttempts int        `json:"failed_login_attempts"`
+	LockedUntil         *time.Time `json:"locked_until"`
+	LastLoginAt         *time.Time `json:"last_login_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+type AttendanceRosterEntry struct {
+	StudentID int        `json:"student_id"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	Status    string     `json:"status"` // present, absent, late, unmarked
+	Notes     string     `json:"notes"`
+	MarkedAt  *time.Time `json:"marked_at"`
+}
+
+type AttendanceSummary struct {
+	StudentID      int     `json:"student_id,omitempty"`
+	StudentName    string  `json:"student_name,omitempty"`
+	CourseID       int     `json:"course_id,omitempty"`
+	CourseName     string  `json:"course_name,omitempty"`
+	ClassID        int     `json:"class_id,omitempty"`
+	ClassTitle     string  `json:"class_title,omitempty"`
+	Present        int     `json:"present"`
+	Late           int     `json:"late"`
+	Absent         int     `json:"absent"`
+	Marked         int     `json:"marked"`
+	AttendanceRate float64 `json:"attendance_rate"` // (present + late) / marked
+	ChronicAbsence bool    `json:"chronic_absence"`
+}
+
+type ClassSeries struct {
+	ID             int       `json:"id"`
+	CourseID       int       `json:"course_id" binding:"required"`
+	TeacherID      int       `json:"teacher_id" binding:"required"`
+	Title          string    `json:"title" binding:"required"`
+	Description    string    `json:"description"`
+	StartsAt       time.Time `json:"starts_at" binding:"required"` // first occurrence
+	Duration       int       `json:"duration"`
+	Room           string    `json:"room"`
+	RoomID         *int      `json:"room_id"`
+	RRule          string    `json:"rrule" binding:"required"` // e.g. FREQ=WEEKLY;BYDAY=MO,WE;COUNT=24
+	ExceptionDates []string  `json:"exception_dates"`          // YYYY-MM-DD occurrences to skip
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type Room struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name" binding:"required"`
+	Building  string    `json:"building"`
+	Branch    string    `json:"branch"`
+	Capacity  int       `json:"capacity"`
+	Equipment []string  `json:"equipment"` // tags such as audio, projector, whiteboard
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,74 @@
+// Package placement turns a placement exam result into a CEFR level: a
+// placement score, optionally weighted by skill, looked up in the exam's
+// score bands.
+package placement
+
+import (
+	"math"
+	"sort"
+)
+
+// Band places scores from MinScore up to the next band's MinScore at Level.
+type Band struct {
+	MinScore float64
+	Level    string
+}
+
+// Skill is the points earned and available on one skill in a result.
+type Skill struct {
+	Skill  string
+	Earned float64
+	Points float64
+}
+
+// Score works out the placement score, from 0 to 100. With no weights it is
+// the result's own score. With weights it is the weighted mean of the
+// percentage earned on each skill delivered; skills without a weight count
+// once and a weight of 0 leaves a skill out. The percentage on each skill
+// delivered is returned alongside.
+func Score(overall float64, skills []Skill, weights map[string]float64) (float64, map[string]float64) {
+	percents := map[string]float64{}
+	for _, s := range skills {
+		if s.Points > 0 {
+			percents[s.Skill] = round(s.Earned / s.Points * 100)
+		}
+	}
+	if len(weights) == 0 {
+		return overall, percents
+	}
+
+	names := make([]string, 0, len(percents))
+	for name := range percents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sum, total float64
+	for _, name := range names {
+		w, ok := weights[name]
+		if !ok {
+			w = 1
+		}
+		sum += w * percents[name]
+		total += w
+	}
+	if total <= 0 {
+		return overall, percents
+	}
+	return round(sum / total), percents
+}
+
+// Level returns the level of the highest band the score reaches, or "" if
+// it is below every band.
+func Level(bands []Band, score float64) string {
+	level, reached := "", math.Inf(-1)
+	for _, b := range bands {
+		if score >= b.MinScore && b.MinScore > reached {
+			level, reached = b.Level, b.MinScore
+		}
+	}
+	return level
+}
+
+func round(x float64) float64 {
+	return math.Round(x*100) / 100
+}
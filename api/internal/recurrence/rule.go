@@ -0,0 +1,213 @@
+// Package recurrence implements the subset of RFC 5545 recurrence rules used
+// for class series: weekly rules with INTERVAL, BYDAY, UNTIL and COUNT.
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxOccurrences caps how many occurrences a single rule may expand to.
+const MaxOccurrences = 500
+
+const untilLayout = "20060102T150405Z"
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+type Rule struct {
+	Interval  int
+	ByWeekday []time.Weekday
+	Until     *time.Time
+	Count     int
+}
+
+// Parse reads an RRULE value such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=24".
+// An optional "RRULE:" prefix is accepted. Every rule must be bounded by
+// UNTIL or COUNT.
+func Parse(value string) (Rule, error) {
+	r := Rule{Interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return r, fmt.Errorf("rrule is empty")
+	}
+
+	freq := ""
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return r, fmt.Errorf("malformed rrule part %q", part)
+		}
+		key, val := strings.ToUpper(strings.TrimSpace(kv[0])), strings.ToUpper(strings.TrimSpace(kv[1]))
+
+		switch key {
+		case "FREQ":
+			freq = val
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("INTERVAL must be a positive integer")
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("COUNT must be a positive integer")
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(val)
+			if err != nil {
+				return r, err
+			}
+			r.Until = &t
+		case "BYDAY":
+			for _, code := range strings.Split(val, ",") {
+				day, err := ParseWeekday(code)
+				if err != nil {
+					return r, err
+				}
+				r.ByWeekday = append(r.ByWeekday, day)
+			}
+		case "WKST":
+			if val != "MO" {
+				return r, fmt.Errorf("only WKST=MO is supported")
+			}
+		default:
+			return r, fmt.Errorf("unsupported rrule part %s", key)
+		}
+	}
+
+	if freq != "WEEKLY" {
+		return r, fmt.Errorf("only FREQ=WEEKLY is supported")
+	}
+	if r.Count > 0 && r.Until != nil {
+		return r, fmt.Errorf("COUNT and UNTIL cannot both be set")
+	}
+	if r.Count == 0 && r.Until == nil {
+		return r, fmt.Errorf("rrule must end with COUNT or UNTIL")
+	}
+	if r.Count > MaxOccurrences {
+		return r, fmt.Errorf("COUNT may be at most %d", MaxOccurrences)
+	}
+	r.normalize()
+	return r, nil
+}
+
+// ParseWeekday reads a two-letter RFC 5545 weekday code such as "MO".
+func ParseWeekday(code string) (time.Weekday, error) {
+	day, ok := weekdayCodes[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return 0, fmt.Errorf("unknown weekday %q, use MO, TU, WE, TH, FR, SA or SU", code)
+	}
+	return day, nil
+}
+
+// WeekdayCode is the inverse of ParseWeekday.
+func WeekdayCode(d time.Weekday) string {
+	return weekdayNames[d]
+}
+
+func parseUntil(val string) (time.Time, error) {
+	for _, layout := range []string{untilLayout, "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, val); err == nil {
+			if layout == "20060102" {
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("UNTIL must be a date (YYYYMMDD) or date-time (YYYYMMDDTHHMMSSZ)")
+}
+
+// normalize sorts and de-duplicates the weekdays in Monday-first order.
+func (r *Rule) normalize() {
+	seen := map[time.Weekday]bool{}
+	days := r.ByWeekday[:0]
+	for _, d := range r.ByWeekday {
+		if !seen[d] {
+			seen[d] = true
+			days = append(days, d)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return mondayIndex(days[i]) < mondayIndex(days[j]) })
+	r.ByWeekday = days
+}
+
+func mondayIndex(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
+
+// String formats the rule back into RRULE syntax.
+func (r Rule) String() string {
+	parts := []string{"FREQ=WEEKLY"}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByWeekday) > 0 {
+		codes := make([]string, len(r.ByWeekday))
+		for i, d := range r.ByWeekday {
+			codes[i] = WeekdayCode(d)
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Expand returns the occurrence start times of the rule anchored at dtstart,
+// in order. Weeks start on Monday; every Interval-th week counted from the
+// week containing dtstart is used. Without BYDAY the weekday of dtstart is
+// used. As in RFC 5545, COUNT includes occurrences later removed as
+// exception dates.
+func Expand(dtstart time.Time, r Rule) []time.Time {
+	days := r.ByWeekday
+	if len(days) == 0 {
+		days = []time.Weekday{dtstart.Weekday()}
+	}
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	weekStart := dtstart.AddDate(0, 0, -mondayIndex(dtstart.Weekday()))
+	var out []time.Time
+	for week := 0; len(out) < MaxOccurrences; week += interval {
+		for _, d := range days {
+			t := weekStart.AddDate(0, 0, week*7+mondayIndex(d))
+			if t.Before(dtstart) {
+				continue
+			}
+			if r.Until != nil && t.After(*r.Until) {
+				return out
+			}
+			out = append(out, t)
+			if (r.Count > 0 && len(out) >= r.Count) || len(out) >= MaxOccurrences {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// DateKey is the calendar-date key used for exception dates.
+func DateKey(t time.Time) string {
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,105 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string // the rule formatted back; empty when Parse must fail
+		wantErr bool
+	}{
+		{value: "FREQ=WEEKLY;COUNT=3", want: "FREQ=WEEKLY;COUNT=3"},
+		{value: "RRULE:freq=weekly;interval=2;byday=we,mo,we;count=4", want: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=4"},
+		{value: "FREQ=WEEKLY;BYDAY=SU,MO;UNTIL=20240331", want: "FREQ=WEEKLY;BYDAY=MO,SU;UNTIL=20240331T235959Z"},
+		{value: "FREQ=WEEKLY;UNTIL=20240331T090000Z;WKST=MO", want: "FREQ=WEEKLY;UNTIL=20240331T090000Z"},
+		{value: "", wantErr: true},
+		{value: "FREQ=DAILY;COUNT=3", wantErr: true},
+		{value: "FREQ=WEEKLY", wantErr: true},
+		{value: "FREQ=WEEKLY;COUNT=3;UNTIL=20240331", wantErr: true},
+		{value: "FREQ=WEEKLY;COUNT=0", wantErr: true},
+		{value: "FREQ=WEEKLY;COUNT=501", wantErr: true},
+		{value: "FREQ=WEEKLY;INTERVAL=0;COUNT=3", wantErr: true},
+		{value: "FREQ=WEEKLY;BYDAY=XX;COUNT=3", wantErr: true},
+		{value: "FREQ=WEEKLY;UNTIL=2024-03-31", wantErr: true},
+		{value: "FREQ=WEEKLY;WKST=SU;COUNT=3", wantErr: true},
+		{value: "FREQ=WEEKLY;BYMONTH=3;COUNT=3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			r, err := Parse(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse succeeded with %s, want an error", r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	// Wednesday 2024-03-06 at 09:00 UTC.
+	start := time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		rrule string
+		want  []string
+	}{
+		{"count without byday keeps the start weekday", "FREQ=WEEKLY;COUNT=3",
+			[]string{"2024-03-06", "2024-03-13", "2024-03-20"}},
+		{"count skips days before the start", "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=4",
+			[]string{"2024-03-06", "2024-03-08", "2024-03-11", "2024-03-13"}},
+		{"interval counts weeks from the start's week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=3",
+			[]string{"2024-03-06", "2024-03-18", "2024-03-20"}},
+		{"until date includes that whole day", "FREQ=WEEKLY;BYDAY=WE;UNTIL=20240320",
+			[]string{"2024-03-06", "2024-03-13", "2024-03-20"}},
+		{"until time before the class drops that day", "FREQ=WEEKLY;BYDAY=WE;UNTIL=20240320T080000Z",
+			[]string{"2024-03-06", "2024-03-13"}},
+		{"until time at the class keeps that day", "FREQ=WEEKLY;BYDAY=WE;UNTIL=20240320T090000Z",
+			[]string{"2024-03-06", "2024-03-13", "2024-03-20"}},
+		{"until before the start", "FREQ=WEEKLY;UNTIL=20240305", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rrule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, occ := range Expand(start, r) {
+				if occ.Hour() != 9 || occ.Minute() != 0 {
+					t.Errorf("occurrence %s does not keep the start time", occ)
+				}
+				got = append(got, DateKey(occ))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandCap(t *testing.T) {
+	r, err := Parse("FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR,SA,SU;UNTIL=20990101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(Expand(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), r)); got != MaxOccurrences {
+		t.Errorf("got %d occurrences, want the cap of %d", got, MaxOccurrences)
+	}
+}
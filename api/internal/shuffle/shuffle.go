@@ -0,0 +1,96 @@
+// Package shuffle produces the seeded, reproducible orderings used for exam
+// attempts. It carries its own generator so a stored seed gives the same
+// order on every server and Go release.
+package shuffle
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strings"
+)
+
+// maxSeed keeps seeds within the integers a JSON client can hold exactly.
+const maxSeed = 1<<53 - 1
+
+// NewSeed returns a random seed for a new attempt.
+func NewSeed() (int64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b[:]) & maxSeed), nil
+}
+
+// Rand is a splitmix64 generator.
+type Rand struct {
+	state uint64
+}
+
+func New(seed int64) *Rand {
+	return &Rand{state: uint64(seed)}
+}
+
+func (r *Rand) next() uint64 {
+	r.state += 0x9e3779b97f4a7c15
+	z := r.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Intn returns a number in [0, n).
+func (r *Rand) Intn(n int) int {
+	return int(r.next() % uint64(n))
+}
+
+// Perm returns a Fisher-Yates permutation of 0..n-1.
+func (r *Rand) Perm(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j := r.Intn(i + 1)
+		p[i], p[j] = p[j], p[i]
+	}
+	return p
+}
+
+// Item is a question to be ordered. Items with the same non-empty Group,
+// such as the questions on one reading passage, stay together in their
+// original order.
+type Item struct {
+	ID    int
+	Group string
+}
+
+// Order returns the item IDs in shuffled order. Groups take the place of
+// their first item and move as a block.
+func Order(seed int64, items []Item) []int {
+	var blocks [][]int
+	index := map[string]int{}
+	for _, it := range items {
+		group := strings.TrimSpace(it.Group)
+		if group != "" {
+			if i, ok := index[group]; ok {
+				blocks[i] = append(blocks[i], it.ID)
+				continue
+			}
+			index[group] = len(blocks)
+		}
+		blocks = append(blocks, []int{it.ID})
+	}
+
+	order := make([]int, 0, len(items))
+	for _, i := range New(seed).Perm(len(blocks)) {
+		order = append(order, blocks[i]...)
+	}
+	return order
+}
+
+// Options returns the display order of a question's n options. Each
+// question draws from its own stream so adding a question to the exam does
+// not reshuffle the options of the others.
+func Options(seed int64, questionID, n int) []int {
+	return New(seed ^ int64(questionID)*0x5851f42d4c957f2d).Perm(n)
+}
@@ -0,0 +1,204 @@
+// Package skillprofile sums up how a student is doing from their graded
+// answers: accuracy and its trend per skill, accuracy per CEFR level, their
+// weakest and strongest skills and the level to study next. It is plain
+// arithmetic over the answers, so the same answers always give the same
+// profile.
+package skillprofile
+
+import (
+	"math"
+	"sort"
+	"time"
+	"uedu-api/internal/models"
+)
+
+const (
+	// minAnswered is how many answers a skill or level needs before it is
+	// judged a weakness, a strength or mastered.
+	minAnswered = 5
+	// weakBelow and strongFrom bound the accuracy of weak and strong skills.
+	weakBelow  = 0.6
+	strongFrom = 0.8
+	// masteredFrom is the accuracy at which a CEFR level counts as mastered.
+	masteredFrom = 0.7
+	// trendMargin is how far accuracy must move between the earlier and
+	// later results for a trend to show.
+	trendMargin = 0.05
+	// maxListed caps the weaknesses and strengths reported.
+	maxListed = 3
+)
+
+// Trends of a skill's accuracy over time.
+const (
+	TrendImproving = "improving"
+	TrendDeclining = "declining"
+	TrendSteady    = "steady"
+	TrendNew       = "new" // answered in a single result so far
+)
+
+// Answer is one graded answer.
+type Answer struct {
+	ResultID    int
+	CompletedAt time.Time
+	Skill       string
+	Level       string // CEFR level of the question, if tagged
+	Earned      float64
+	Points      float64
+}
+
+// Profile is what Build works out.
+type Profile struct {
+	Skills           []models.SkillStat
+	Levels           []models.LevelStat
+	Weaknesses       []string
+	Strengths        []string
+	RecommendedLevel string
+}
+
+type tally struct {
+	answered       int
+	earned, points float64
+}
+
+func (t *tally) add(a Answer) {
+	t.answered++
+	t.earned += a.Earned
+	t.points += a.Points
+}
+
+func (t tally) accuracy() float64 {
+	if t.points <= 0 {
+		return 0
+	}
+	return math.Round(t.earned/t.points*10000) / 10000
+}
+
+// Build works out the profile from a student's graded answers. levels lists
+// the CEFR levels from lowest to highest.
+func Build(answers []Answer, levels []string) Profile {
+	type resultKey struct {
+		id int
+		at time.Time
+	}
+	skills := map[string]*tally{}
+	perResult := map[string]map[resultKey]*tally{}
+	perLevel := map[string]*tally{}
+	for _, a := range answers {
+		if skills[a.Skill] == nil {
+			skills[a.Skill] = &tally{}
+			perResult[a.Skill] = map[resultKey]*tally{}
+		}
+		skills[a.Skill].add(a)
+		k := resultKey{a.ResultID, a.CompletedAt}
+		if perResult[a.Skill][k] == nil {
+			perResult[a.Skill][k] = &tally{}
+		}
+		perResult[a.Skill][k].add(a)
+		if a.Level != "" {
+			if perLevel[a.Level] == nil {
+				perLevel[a.Level] = &tally{}
+			}
+			perLevel[a.Level].add(a)
+		}
+	}
+
+	p := Profile{Skills: []models.SkillStat{}, Levels: []models.LevelStat{}, Weaknesses: []string{}, Strengths: []string{}}
+	for skill, t := range skills {
+		st := models.SkillStat{Skill: skill, Answered: t.answered, Accuracy: t.accuracy()}
+		keys := make([]resultKey, 0, len(perResult[skill]))
+		for k := range perResult[skill] {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if !keys[i].at.Equal(keys[j].at) {
+				return keys[i].at.Before(keys[j].at)
+			}
+			return keys[i].id < keys[j].id
+		})
+		series := make([]float64, len(keys))
+		for i, k := range keys {
+			series[i] = perResult[skill][k].accuracy()
+			st.History = append(st.History, models.SkillPoint{ExamResultID: k.id, CompletedAt: k.at, Accuracy: series[i]})
+		}
+		st.Trend = trend(series)
+		p.Skills = append(p.Skills, st)
+	}
+	sort.Slice(p.Skills, func(i, j int) bool { return p.Skills[i].Skill < p.Skills[j].Skill })
+
+	// Weakest first, then strongest first; ties go alphabetically.
+	ranked := make([]models.SkillStat, 0, len(p.Skills))
+	for _, st := range p.Skills {
+		if st.Answered >= minAnswered {
+			ranked = append(ranked, st)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Accuracy < ranked[j].Accuracy })
+	for _, st := range ranked {
+		if st.Accuracy < weakBelow && len(p.Weaknesses) < maxListed {
+			p.Weaknesses = append(p.Weaknesses, st.Skill)
+		}
+	}
+	for i := len(ranked) - 1; i >= 0; i-- {
+		if st := ranked[i]; st.Accuracy >= strongFrom && len(p.Strengths) < maxListed {
+			p.Strengths = append(p.Strengths, st.Skill)
+		}
+	}
+
+	// The recommended level is the one after the highest level mastered in
+	// an unbroken run from the bottom. Levels without enough answers do not
+	// break the run.
+	mastered := -1
+	judged := false
+	for i, level := range levels {
+		t, ok := perLevel[level]
+		if !ok {
+			continue
+		}
+		ls := models.LevelStat{Level: level, Answered: t.answered, Accuracy: t.accuracy()}
+		ls.Mastered = ls.Answered >= minAnswered && ls.Accuracy >= masteredFrom
+		p.Levels = append(p.Levels, ls)
+		if ls.Answered < minAnswered || judged {
+			continue
+		}
+		if ls.Mastered {
+			mastered = i
+		} else {
+			judged = true
+		}
+	}
+	switch {
+	case mastered >= 0 && mastered+1 < len(levels):
+		p.RecommendedLevel = levels[mastered+1]
+	case mastered >= 0:
+		p.RecommendedLevel = levels[mastered]
+	case judged:
+		p.RecommendedLevel = levels[0]
+	}
+	return p
+}
+
+// trend compares the mean accuracy of the later half of the results with
+// the earlier half.
+func trend(series []float64) string {
+	if len(series) < 2 {
+		return TrendNew
+	}
+	half := len(series) / 2
+	earlier := mean(series[:half])
+	later := mean(series[len(series)-half:])
+	switch {
+	case later-earlier >= trendMargin:
+		return TrendImproving
+	case earlier-later >= trendMargin:
+		return TrendDeclining
+	}
+	return TrendSteady
+}
+
+func mean(xs []float64) float64 {
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
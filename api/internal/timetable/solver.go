@@ -0,0 +1,373 @@
+// Package timetable builds a weekly class timetable for a term. Each course
+// session is placed in a weekly slot (weekday, start time, room) that repeats
+// every week of the term; the solver keeps slots free of teacher and room
+// double-bookings and prefers placements with short teacher gaps and few
+// room changes. It is deterministic: the same problem always gives the same
+// solution.
+package timetable
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// roomChangeCost is the penalty, in gap minutes, for one room change.
+const roomChangeCost = 60
+
+// maxImprovementPasses bounds the local search after the greedy placement.
+const maxImprovementPasses = 20
+
+type Course struct {
+	ID              int
+	TeacherID       int
+	Seats           int // room capacity needed; 0 fits any room
+	SessionsPerWeek int
+	Duration        int // minutes
+	RoomID          int // 0 lets the solver choose
+}
+
+type Room struct {
+	ID       int
+	Capacity int // 0 means unknown and fits any course
+}
+
+// Window is a weekly period in minutes from midnight.
+type Window struct {
+	Weekday time.Weekday
+	Start   int
+	End     int
+}
+
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+type Problem struct {
+	TermStart time.Time // first date of the term
+	TermEnd   time.Time // last date of the term
+	Weekdays  []time.Weekday
+	DayStart  int // minutes from midnight
+	DayEnd    int
+	Step      int // start-time granularity in minutes
+	Courses   []Course
+	Rooms     []Room
+	// Availability lists the weekly windows each teacher can teach in. A
+	// teacher without entries is available for the whole teaching day.
+	Availability map[int][]Window
+	Blackouts    map[string]bool // dates (YYYY-MM-DD) with no classes
+	// TeacherBusy and RoomBusy hold bookings that already exist in the
+	// term, keyed by teacher and room id.
+	TeacherBusy map[int][]Interval
+	RoomBusy    map[int][]Interval
+}
+
+type Slot struct {
+	CourseID  int
+	TeacherID int
+	RoomID    int
+	Weekday   time.Weekday
+	Start     int // minutes from midnight
+	Duration  int
+}
+
+func (s Slot) End() int {
+	return s.Start + s.Duration
+}
+
+func (s Slot) String() string {
+	return fmt.Sprintf("%d:%d:%d:%d:%d:%d", s.CourseID, s.TeacherID, s.RoomID, s.Weekday, s.Start, s.Duration)
+}
+
+type Unscheduled struct {
+	CourseID int
+	Sessions int
+	Reason   string
+}
+
+type Solution struct {
+	Slots             []Slot
+	Unscheduled       []Unscheduled
+	TeacherGapMinutes int
+	RoomChanges       int
+}
+
+// FirstDate returns the first date of the term that falls on day.
+func (p Problem) FirstDate(day time.Weekday) time.Time {
+	return p.TermStart.AddDate(0, 0, (int(day)-int(p.TermStart.Weekday())+7)%7)
+}
+
+// Dates returns the term dates a slot's classes fall on, skipping blackouts.
+func (p Problem) Dates(s Slot) []time.Time {
+	var dates []time.Time
+	for d := p.FirstDate(s.Weekday); !d.After(p.TermEnd); d = d.AddDate(0, 0, 7) {
+		if !p.Blackouts[d.Format("2006-01-02")] {
+			dates = append(dates, d)
+		}
+	}
+	return dates
+}
+
+// At returns the start time of the slot's class on date.
+func At(date time.Time, minutes int) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, minutes, 0, 0, date.Location())
+}
+
+type solver struct {
+	p       Problem
+	courses map[int]Course
+	rooms   []Room
+	options map[int][]Slot // candidates per course, see candidates
+	placed  []Slot
+}
+
+func Solve(p Problem) Solution {
+	if p.Step <= 0 {
+		p.Step = 30
+	}
+	s := &solver{p: p, courses: map[int]Course{}, options: map[int][]Slot{}}
+
+	s.rooms = append([]Room(nil), p.Rooms...)
+	sort.Slice(s.rooms, func(i, j int) bool {
+		if s.rooms[i].Capacity != s.rooms[j].Capacity {
+			return s.rooms[i].Capacity < s.rooms[j].Capacity
+		}
+		return s.rooms[i].ID < s.rooms[j].ID
+	})
+
+	courses := append([]Course(nil), p.Courses...)
+	for _, c := range courses {
+		s.courses[c.ID] = c
+		s.options[c.ID] = s.candidates(c)
+	}
+	// Place the most constrained courses first.
+	sort.Slice(courses, func(i, j int) bool {
+		a, b := len(s.options[courses[i].ID]), len(s.options[courses[j].ID])
+		if a != b {
+			return a < b
+		}
+		return courses[i].ID < courses[j].ID
+	})
+
+	var unscheduled []Unscheduled
+	for _, c := range courses {
+		missing := 0
+		for n := 0; n < c.SessionsPerWeek; n++ {
+			best, ok := s.best(c, nil)
+			if !ok {
+				missing = c.SessionsPerWeek - n
+				break
+			}
+			s.placed = append(s.placed, best)
+		}
+		if missing > 0 {
+			reason := "no free slot for the teacher and a large enough room"
+			if len(s.options[c.ID]) == 0 {
+				reason = "teacher availability and rooms leave no possible slot"
+			}
+			unscheduled = append(unscheduled, Unscheduled{CourseID: c.ID, Sessions: missing, Reason: reason})
+		}
+	}
+
+	s.improve()
+
+	sort.Slice(s.placed, func(i, j int) bool {
+		a, b := s.placed[i], s.placed[j]
+		if a.Weekday != b.Weekday {
+			return mondayIndex(a.Weekday) < mondayIndex(b.Weekday)
+		}
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		return a.RoomID < b.RoomID
+	})
+	sort.Slice(unscheduled, func(i, j int) bool { return unscheduled[i].CourseID < unscheduled[j].CourseID })
+
+	gaps, changes := s.totals()
+	return Solution{Slots: s.placed, Unscheduled: unscheduled, TeacherGapMinutes: gaps, RoomChanges: changes}
+}
+
+// candidates lists every slot the course could take on its own, ignoring
+// the other sessions of this proposal.
+func (s *solver) candidates(c Course) []Slot {
+	var out []Slot
+	for _, day := range s.p.Weekdays {
+		for start := s.p.DayStart; start+c.Duration <= s.p.DayEnd; start += s.p.Step {
+			if !s.teacherAvailable(c.TeacherID, day, start, start+c.Duration) {
+				continue
+			}
+			for _, r := range s.rooms {
+				if c.RoomID != 0 && r.ID != c.RoomID {
+					continue
+				}
+				if r.Capacity > 0 && c.Seats > r.Capacity {
+					continue
+				}
+				slot := Slot{CourseID: c.ID, TeacherID: c.TeacherID, RoomID: r.ID, Weekday: day, Start: start, Duration: c.Duration}
+				if s.freeOfBookings(slot) {
+					out = append(out, slot)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func (s *solver) teacherAvailable(teacherID int, day time.Weekday, start, end int) bool {
+	windows, ok := s.p.Availability[teacherID]
+	if !ok {
+		return true
+	}
+	for _, w := range windows {
+		if w.Weekday == day && w.Start <= start && end <= w.End {
+			return true
+		}
+	}
+	return false
+}
+
+// freeOfBookings checks the slot against existing bookings on every date it
+// would be held.
+func (s *solver) freeOfBookings(slot Slot) bool {
+	for _, d := range s.p.Dates(slot) {
+		start, end := At(d, slot.Start), At(d, slot.End())
+		for _, b := range s.p.TeacherBusy[slot.TeacherID] {
+			if b.Start.Before(end) && b.End.After(start) {
+				return false
+			}
+		}
+		for _, b := range s.p.RoomBusy[slot.RoomID] {
+			if b.Start.Before(end) && b.End.After(start) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// clashes reports whether slot overlaps a placed slot for the same teacher
+// or room, or repeats its course on a day it already meets when the course
+// could meet on separate days.
+func (s *solver) clashes(slot Slot) bool {
+	spread := s.courses[slot.CourseID].SessionsPerWeek <= len(s.p.Weekdays)
+	for _, other := range s.placed {
+		if other.Weekday != slot.Weekday {
+			continue
+		}
+		if spread && other.CourseID == slot.CourseID {
+			return true
+		}
+		overlap := other.Start < slot.End() && slot.Start < other.End()
+		if overlap && (other.TeacherID == slot.TeacherID || other.RoomID == slot.RoomID) {
+			return true
+		}
+	}
+	return false
+}
+
+// best returns the lowest-cost free slot for the course. current, when set,
+// is the slot being reconsidered; a candidate must beat its cost strictly.
+func (s *solver) best(c Course, current *Slot) (Slot, bool) {
+	var best Slot
+	bestCost, found := 0, false
+	if current != nil {
+		best, bestCost, found = *current, s.costWith(*current), true
+	}
+	for _, cand := range s.options[c.ID] {
+		if current != nil && cand == *current {
+			continue
+		}
+		if s.clashes(cand) {
+			continue
+		}
+		cost := s.costWith(cand)
+		if !found || cost < bestCost {
+			best, bestCost, found = cand, cost, true
+		}
+	}
+	return best, found
+}
+
+// improve moves single sessions to cheaper slots until nothing improves.
+func (s *solver) improve() {
+	for pass := 0; pass < maxImprovementPasses; pass++ {
+		moved := false
+		for i := range s.placed {
+			all, current := s.placed, s.placed[i]
+			s.placed = append(append([]Slot(nil), all[:i]...), all[i+1:]...)
+			next, _ := s.best(s.courses[current.CourseID], &current)
+			s.placed = all
+			if next != current {
+				s.placed[i] = next
+				moved = true
+			}
+		}
+		if !moved {
+			return
+		}
+	}
+}
+
+// costWith is the cost of the teacher's day and the course's rooms if slot
+// were added to the placed slots.
+func (s *solver) costWith(slot Slot) int {
+	var day, course []Slot
+	for _, other := range s.placed {
+		if other.TeacherID == slot.TeacherID && other.Weekday == slot.Weekday {
+			day = append(day, other)
+		}
+		if other.CourseID == slot.CourseID {
+			course = append(course, other)
+		}
+	}
+	gaps, changes := dayCost(append(day, slot))
+	return gaps + roomChangeCost*(changes+distinctRooms(append(course, slot))-1)
+}
+
+func (s *solver) totals() (gaps, changes int) {
+	days := map[[2]int][]Slot{}
+	courses := map[int][]Slot{}
+	for _, slot := range s.placed {
+		key := [2]int{slot.TeacherID, int(slot.Weekday)}
+		days[key] = append(days[key], slot)
+		courses[slot.CourseID] = append(courses[slot.CourseID], slot)
+	}
+	for _, day := range days {
+		g, c := dayCost(day)
+		gaps += g
+		changes += c
+	}
+	for _, course := range courses {
+		changes += distinctRooms(course) - 1
+	}
+	return gaps, changes
+}
+
+// dayCost returns the idle minutes between a teacher's sessions on one day
+// and how often the teacher changes rooms between consecutive sessions.
+func dayCost(day []Slot) (gaps, changes int) {
+	sorted := append([]Slot(nil), day...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	for i := 1; i < len(sorted); i++ {
+		if gap := sorted[i].Start - sorted[i-1].End(); gap > 0 {
+			gaps += gap
+		}
+		if sorted[i].RoomID != sorted[i-1].RoomID {
+			changes++
+		}
+	}
+	return gaps, changes
+}
+
+func distinctRooms(slots []Slot) int {
+	seen := map[int]bool{}
+	for _, s := range slots {
+		seen[s.RoomID] = true
+	}
+	return len(seen)
+}
+
+func mondayIndex(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
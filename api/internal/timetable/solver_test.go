@@ -0,0 +1,162 @@
+package timetable
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	reasonNoSlot = "teacher availability and rooms leave no possible slot"
+	reasonFull   = "no free slot for the teacher and a large enough room"
+)
+
+// termProblem is a four-week term with Monday and Wednesday classes from
+// 09:00 to 12:00 in hour steps.
+func termProblem(courses []Course, rooms []Room) Problem {
+	return Problem{
+		TermStart: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+		TermEnd:   time.Date(2024, 3, 29, 0, 0, 0, 0, time.UTC),
+		Weekdays:  []time.Weekday{time.Monday, time.Wednesday},
+		DayStart:  9 * 60,
+		DayEnd:    12 * 60,
+		Step:      60,
+		Courses:   courses,
+		Rooms:     rooms,
+	}
+}
+
+func TestSolveInfeasible(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(p *Problem)
+		want  []Unscheduled
+	}{
+		{
+			name: "feasible",
+			setup: func(p *Problem) {
+				p.Courses = []Course{{ID: 1, TeacherID: 1, SessionsPerWeek: 2, Duration: 60}}
+			},
+		},
+		{
+			name: "no room large enough",
+			setup: func(p *Problem) {
+				p.Courses = []Course{{ID: 1, TeacherID: 1, Seats: 30, SessionsPerWeek: 2, Duration: 60}}
+			},
+			want: []Unscheduled{{CourseID: 1, Sessions: 2, Reason: reasonNoSlot}},
+		},
+		{
+			name: "session longer than the teaching day",
+			setup: func(p *Problem) {
+				p.Courses = []Course{{ID: 1, TeacherID: 1, SessionsPerWeek: 1, Duration: 240}}
+			},
+			want: []Unscheduled{{CourseID: 1, Sessions: 1, Reason: reasonNoSlot}},
+		},
+		{
+			name: "teacher window shorter than the session",
+			setup: func(p *Problem) {
+				p.Courses = []Course{{ID: 1, TeacherID: 1, SessionsPerWeek: 1, Duration: 120}}
+				p.Availability = map[int][]Window{1: {{Weekday: time.Monday, Start: 9 * 60, End: 10 * 60}}}
+			},
+			want: []Unscheduled{{CourseID: 1, Sessions: 1, Reason: reasonNoSlot}},
+		},
+		{
+			name: "fixed room booked on one of the dates",
+			setup: func(p *Problem) {
+				p.Courses = []Course{{ID: 1, TeacherID: 1, SessionsPerWeek: 1, Duration: 180, RoomID: 10}}
+				p.RoomBusy = map[int][]Interval{10: {
+					{Start: time.Date(2024, 3, 18, 11, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 18, 12, 0, 0, 0, time.UTC)},
+					{Start: time.Date(2024, 3, 27, 9, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 27, 9, 30, 0, 0, time.UTC)},
+				}}
+			},
+			want: []Unscheduled{{CourseID: 1, Sessions: 1, Reason: reasonNoSlot}},
+		},
+		{
+			name: "a blackout frees the booked date",
+			setup: func(p *Problem) {
+				p.Courses = []Course{{ID: 1, TeacherID: 1, SessionsPerWeek: 1, Duration: 180, RoomID: 10}}
+				p.RoomBusy = map[int][]Interval{10: {
+					{Start: time.Date(2024, 3, 18, 11, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 18, 12, 0, 0, 0, time.UTC)},
+				}}
+				p.Blackouts = map[string]bool{"2024-03-18": true}
+			},
+		},
+		{
+			name: "teacher fully booked by other courses",
+			setup: func(p *Problem) {
+				p.Courses = []Course{
+					{ID: 1, TeacherID: 1, SessionsPerWeek: 2, Duration: 180},
+					{ID: 2, TeacherID: 1, SessionsPerWeek: 1, Duration: 60},
+				}
+			},
+			// The three-hour course has fewer options, so it is placed first.
+			want: []Unscheduled{{CourseID: 2, Sessions: 1, Reason: reasonFull}},
+		},
+		{
+			name: "more sessions than the rooms hold",
+			setup: func(p *Problem) {
+				p.Courses = []Course{
+					{ID: 1, TeacherID: 1, SessionsPerWeek: 2, Duration: 180},
+					{ID: 2, TeacherID: 2, SessionsPerWeek: 2, Duration: 180},
+					{ID: 3, TeacherID: 3, SessionsPerWeek: 2, Duration: 180},
+				}
+			},
+			want: []Unscheduled{{CourseID: 3, Sessions: 2, Reason: reasonFull}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := termProblem(nil, []Room{{ID: 10, Capacity: 20}, {ID: 11, Capacity: 25}})
+			tt.setup(&p)
+			sol := Solve(p)
+
+			if !reflect.DeepEqual(sol.Unscheduled, tt.want) {
+				t.Errorf("unscheduled %+v, want %+v", sol.Unscheduled, tt.want)
+			}
+			sessions := 0
+			for _, c := range p.Courses {
+				sessions += c.SessionsPerWeek
+			}
+			for _, u := range tt.want {
+				sessions -= u.Sessions
+			}
+			if len(sol.Slots) != sessions {
+				t.Errorf("placed %d sessions, want %d", len(sol.Slots), sessions)
+			}
+			assertNoClashes(t, sol.Slots)
+		})
+	}
+}
+
+func TestSolveDeterministic(t *testing.T) {
+	p := termProblem([]Course{
+		{ID: 1, TeacherID: 1, SessionsPerWeek: 2, Duration: 60},
+		{ID: 2, TeacherID: 1, SessionsPerWeek: 2, Duration: 60},
+		{ID: 3, TeacherID: 2, SessionsPerWeek: 1, Duration: 120, Seats: 22},
+	}, []Room{{ID: 10, Capacity: 20}, {ID: 11, Capacity: 25}})
+
+	first := Solve(p)
+	if len(first.Unscheduled) != 0 {
+		t.Fatalf("unscheduled %+v", first.Unscheduled)
+	}
+	assertNoClashes(t, first.Slots)
+	for i := 0; i < 5; i++ {
+		if again := Solve(p); !reflect.DeepEqual(again, first) {
+			t.Fatalf("solution changed between runs:\n%+v\n%+v", first, again)
+		}
+	}
+}
+
+func assertNoClashes(t *testing.T, slots []Slot) {
+	t.Helper()
+	for i, a := range slots {
+		for _, b := range slots[i+1:] {
+			if a.Weekday != b.Weekday || a.Start >= b.End() || b.Start >= a.End() {
+				continue
+			}
+			if a.TeacherID == b.TeacherID || a.RoomID == b.RoomID {
+				t.Errorf("%s clashes with %s", a, b)
+			}
+		}
+	}
+}